@@ -0,0 +1,1446 @@
+package fastworktree
+
+import (
+	"bufio"
+	"cmp"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	branchCreate   string
+	branchReset    string
+	noTrack        bool
+	fallback       string
+	backend        string
+	lock           bool
+	reason         string
+	fromFile       string
+	addTemp        bool
+	orphan         string
+	track          bool
+	guessRemote    bool
+	detachHead     bool
+	addForce       int
+	gitArgs        []string
+	defaultBranch  string
+	fetchRemote    string
+	prNumber       int
+	clean          bool
+	carryChanges   bool
+	recurseSubs    bool
+	sparsePaths    []string
+	noFetchMissing bool
+	fromWorktree   string
+	nestedMode     string
+	cloneACLs      bool
+	noXattrs       bool
+	followSymlinks bool
+	headroom       string
+	cloneJobs      int
+	fsmonitorMode  string
+	warm           bool
+	tempTTL        time.Duration
+)
+
+var addCmd = &cobra.Command{
+	Use:   "add [flags] [<path>] [<commit-ish>]",
+	Short: "Create a worktree using copy-on-write cloning",
+	Long: "Creates a worktree using copy-on-write cloning.\n\n" +
+		"Several worktrees can be created at once by passing <branch>:<path> pairs\n" +
+		"instead of a path, or with --from-file. Each pair creates a new branch from\n" +
+		"HEAD; the worktrees are cloned concurrently.\n\n" +
+		"With -b, -B, --orphan, --pr or --issue the path can be left out, and is then\n" +
+		"made from --path-template in --root: ../<repo>-<branch> by default. So can the\n" +
+		"path of a pair, as in feat/x:.",
+	Example: "  git-fast-worktree add ../wt origin/main\n" +
+		"  git-fast-worktree add -b feat/x\n" +
+		"  git-fast-worktree add --issue PROJ-123\n" +
+		"  git-fast-worktree add agent-1:../agent-1 agent-2:../agent-2 agent-3:../agent-3",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		_, err := runAdd(cmd, args)
+		return err
+	},
+}
+
+// runAdd creates the worktrees add's args and flags ask for, returning a
+// report on each if they are wanted.
+func runAdd(cmd *cobra.Command, args []string) (reports []*addReport, err error) {
+	addFlagsUsed = changedFlags(cmd.LocalFlags())
+
+	// Resolve source: git repo root of the current directory, or the
+	// worktree chosen with --from. The first worktree of a bare
+	// repository has nothing to clone and is checked out normally.
+	src, err := sourceWorktree(fromWorktree)
+	noSource := errors.Is(err, errNoSource)
+	if noSource {
+		src, err = gitCommonDir()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// --issue is -b with a branch named after the issue.
+	if issueRef != "" {
+		if branchCreate != "" || branchReset != "" || orphan != "" || prNumber != 0 || addTemp {
+			return nil, fmt.Errorf("fatal: --issue cannot be combined with -b, -B, --orphan, --pr or --temp")
+		}
+		if branchCreate, err = issueBranch(issueRef); err != nil {
+			return nil, err
+		}
+		console.infof("issue:        branch %s", branchCreate)
+	}
+
+	specs, batch, err := parseAddArgs(args)
+	if err != nil {
+		return nil, err
+	}
+
+	// Validate flags
+	if !slices.Contains([]string{"human", "ndjson"}, progress) {
+		return nil, fmt.Errorf("fatal: invalid --progress '%s' (expected human or ndjson)", progress)
+	}
+	if jsonOutput && progress == "ndjson" {
+		return nil, fmt.Errorf("fatal: --json and --progress=ndjson are mutually exclusive")
+	}
+	if jsonOutput || progress == "ndjson" {
+		quiet = true
+	}
+	if branchCreate != "" && branchReset != "" {
+		return nil, fmt.Errorf("fatal: -b and -B are mutually exclusive")
+	}
+	if batch && (branchCreate != "" || branchReset != "") {
+		return nil, fmt.Errorf("fatal: -b and -B cannot be combined with <branch>:<path> pairs")
+	}
+	if orphan != "" && (branchCreate != "" || branchReset != "" || batch) {
+		return nil, fmt.Errorf("fatal: --orphan cannot be combined with -b, -B or <branch>:<path> pairs")
+	}
+	if prNumber != 0 && (branchCreate != "" || branchReset != "" || orphan != "" || detachHead || batch || addTemp || specs[0].commitish != "") {
+		return nil, fmt.Errorf("fatal: --pr cannot be combined with -b, -B, --orphan, --detach, --temp, <branch>:<path> pairs or a <commit-ish>")
+	}
+	if openCommand != "" && batch {
+		return nil, fmt.Errorf("fatal: --open cannot be combined with <branch>:<path> pairs")
+	}
+	if orphan != "" && specs[0].commitish != "" {
+		return nil, fmt.Errorf("fatal: --orphan does not take a <commit-ish>")
+	}
+	if fromPool && (batch || orphan != "" || addTemp || len(sparsePaths) > 0) {
+		return nil, fmt.Errorf("fatal: --from-pool cannot be combined with --orphan, --temp, --sparse or <branch>:<path> pairs")
+	}
+	if _, err := parseWtConfig(wtConfig); err != nil {
+		return nil, err
+	}
+	if clean && carryChanges {
+		return nil, fmt.Errorf("fatal: --clean and --carry-changes are mutually exclusive")
+	}
+	if reason != "" && !lock {
+		return nil, fmt.Errorf("fatal: --reason requires --lock")
+	}
+	if !slices.Contains([]string{"detach", "checkout", "create"}, defaultBranch) {
+		return nil, fmt.Errorf("fatal: invalid --default-branch '%s' (expected detach, checkout or create)", defaultBranch)
+	}
+	if !slices.Contains([]string{"off", "builtin", "watchman"}, fsmonitorMode) {
+		return nil, fmt.Errorf("fatal: invalid --fsmonitor '%s' (expected off, builtin or watchman)", fsmonitorMode)
+	}
+	if !slices.Contains([]string{"warn", "skip", "strip", "clone"}, nestedMode) {
+		return nil, fmt.Errorf("fatal: invalid --nested-repos '%s' (expected warn, skip, strip or clone)", nestedMode)
+	}
+	if cloneJobs < 1 {
+		return nil, fmt.Errorf("fatal: --jobs must be at least 1")
+	}
+	if _, err := parseBytes(headroom); err != nil {
+		return nil, err
+	}
+	if !slices.Contains([]string{"refuse", "evict"}, onQuota) {
+		return nil, fmt.Errorf("fatal: invalid --on-quota '%s' (expected refuse or evict)", onQuota)
+	}
+	if maxUsage != "" {
+		if _, err := parseBytes(maxUsage); err != nil {
+			return nil, err
+		}
+	}
+	if _, ok := fallbacks[fallback]; !ok {
+		return nil, fmt.Errorf("fatal: invalid --fallback '%s' (expected copy, hardlink or error)", fallback)
+	}
+
+	if prNumber != 0 {
+		if err := fetchPullRequest(src, &specs[0]); err != nil {
+			return nil, err
+		}
+	} else if fetchRemote != "" {
+		fetchArgs := []string{"-C", src, "fetch"}
+		if quiet {
+			fetchArgs = append(fetchArgs, "--quiet")
+		}
+		if err := runGit(append(fetchArgs, fetchRemote)...); err != nil {
+			return nil, withExitCode(exitGitFailed, fmt.Errorf("fatal: git fetch %s failed", fetchRemote))
+		}
+	}
+
+	for _, spec := range specs {
+		if err := checkNesting(src, spec.dst); err != nil {
+			return nil, err
+		}
+	}
+
+	if !batch {
+		guessRemoteBranch(cmd, src, &specs[0])
+		if !addTemp {
+			applyDefaultBranch(src, &specs[0])
+		}
+	}
+
+	for i := range specs {
+		if err := checkBranchInUse(src, &specs[i]); err != nil {
+			return nil, err
+		}
+	}
+	if err := enforceQuota(src, len(specs)); err != nil {
+		return nil, err
+	}
+
+	// With --json or --stats-out, or for the package's API, each worktree
+	// gets a report that is printed or written once add is done, whether
+	// or not it succeeded.
+	// --progress=ndjson streams its events as they happen.
+	loggers := make([]logger, len(specs))
+	for i, spec := range specs {
+		if batch {
+			loggers[i].prefix = "[" + filepath.Base(spec.dst) + "] "
+		}
+		if jsonOutput || progress == "ndjson" || statsOut != "" || embedded {
+			loggers[i].report = &addReport{Path: spec.dst, stream: progress == "ndjson"}
+			reports = append(reports, loggers[i].report)
+		}
+	}
+	start := time.Now()
+	defer func() {
+		for _, r := range reports {
+			if !r.finished {
+				r.finish(err, time.Since(start))
+			}
+		}
+		if statsOut != "" {
+			if err := writeStats(statsOut, src, start, reports); err != nil {
+				console.warnf("could not write --stats-out: %v", err)
+			}
+		}
+		if jsonOutput {
+			if jsonErr := printReports(reports, batch); jsonErr != nil && err == nil {
+				err = jsonErr
+			}
+		}
+	}()
+
+	if fromPool {
+		if ok, err := addFromPool(src, specs[0], loggers[0]); ok || err != nil {
+			if err == nil {
+				err = runPostCreate(src, specs[0].dst, loggers[0])
+			}
+			loggers[0].report.finish(err, time.Since(start))
+			if err == nil {
+				recordLastAdd(start, []string{specs[0].dst})
+				recordHistory(historyEntry{Op: "add", Path: specs[0].dst, Branch: currentBranch(specs[0].dst)}, start)
+				printWorktree(specs[0].dst)
+				openWorktree(specs[0].dst)
+				integrateWorktree(specs[0].dst, true, loggers[0])
+			}
+			return reports, err
+		}
+		console.infof("the pool is empty, cloning instead")
+	}
+
+	// Phase 2: Read top-level entries from source (skip .git). This is
+	// shared by every worktree, so it is done before phase 1.
+	var toClone []string
+	var sparse *sparseSpec
+	if noSource {
+		console.infof("no worktree to clone from, checking out normally")
+	} else if toClone, err = sourceEntries(src); err != nil {
+		return reports, err
+	} else if len(sparsePaths) > 0 {
+		if sparse, err = parseSparsePaths(sparsePaths); err != nil {
+			return reports, err
+		}
+		toClone = sparse.entries(src, toClone)
+	} else if sparse, err = sourceSparse(src); err != nil {
+		return reports, err
+	} else if sparse != nil {
+		toClone = sparse.filter(src, toClone)
+	}
+	var nested []string
+	if !noSource {
+		if nested, err = nestedRepos(src); err != nil {
+			return reports, err
+		}
+		if nestedMode == "skip" {
+			toClone = slices.DeleteFunc(toClone, func(name string) bool { return slices.Contains(nested, filepath.ToSlash(name)) })
+		}
+		if nestedMode == "warn" {
+			for _, repo := range nested {
+				console.warnf("%s is a nested git repository and is cloned with its .git; use --nested-repos=skip or strip to leave it out", repo)
+			}
+		}
+	}
+	partial := partialClone(src)
+	for i := range specs {
+		specs[i].nested = nested
+		specs[i].sparse = sparse
+		specs[i].partial = partial
+		specs[i].checkout = noSource
+	}
+
+	handleInterrupts()
+	if !batch {
+		err := addWorktree(src, specs[0], toClone, loggers[0])
+		if err == nil {
+			err = runPostCreate(src, specs[0].dst, loggers[0])
+		}
+		loggers[0].report.finish(err, time.Since(start))
+		if err == nil {
+			recordLastAdd(start, []string{specs[0].dst})
+			recordHistory(historyEntry{Op: "add", Path: specs[0].dst, Branch: currentBranch(specs[0].dst)}, start)
+			printWorktree(specs[0].dst)
+			openWorktree(specs[0].dst)
+			integrateWorktree(specs[0].dst, true, loggers[0])
+		}
+		return reports, err
+	}
+
+	var wg sync.WaitGroup
+	codes := make([]int, len(specs))
+	for i, spec := range specs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			log := loggers[i]
+			err := addWorktree(src, spec, toClone, log)
+			if err == nil {
+				err = runPostCreate(src, spec.dst, log)
+			}
+			log.report.finish(err, time.Since(start))
+			if err != nil {
+				log.printf("%v", err)
+				codes[i] = exitCode(err)
+				return
+			}
+			recordHistory(historyEntry{Op: "add", Path: spec.dst, Branch: currentBranch(spec.dst)}, start)
+			printWorktree(spec.dst)
+			integrateWorktree(spec.dst, false, log)
+		}()
+	}
+	wg.Wait()
+	var created []string
+	for i, spec := range specs {
+		if codes[i] == 0 {
+			created = append(created, spec.dst)
+		}
+	}
+	recordLastAdd(start, created)
+	// The exit code is the failures' own if they all failed alike.
+	failed := slices.DeleteFunc(codes, func(code int) bool { return code == 0 })
+	if len(failed) > 0 {
+		err := fmt.Errorf("%d of %d worktrees failed", len(failed), len(specs))
+		if slices.Min(failed) == slices.Max(failed) {
+			return reports, withExitCode(failed[0], err)
+		}
+		return reports, err
+	}
+	return reports, nil
+}
+
+// worktreeSpec is one worktree for add to create.
+type worktreeSpec struct {
+	dst          string
+	commitish    string
+	branchCreate string
+	branchReset  string
+	orphan       string
+	track        bool
+	attach       bool // check out the branch named by commitish instead of detaching
+	sparse       *sparseSpec
+	partial      bool // the source is a partial clone
+	checkout     bool // there is no source to clone, check out normally
+	nested       []string
+	expires      *time.Time
+}
+
+// parseAddArgs turns add's arguments into the worktrees to create. Batch
+// mode is used when --from-file is given or every argument is a
+// <branch>:<path> pair.
+func parseAddArgs(args []string) (specs []worktreeSpec, batch bool, err error) {
+	if addTemp {
+		if len(args) > 1 {
+			return nil, false, fmt.Errorf("fatal: --temp takes at most a <commit-ish>, the path is chosen automatically")
+		}
+		dst, err := tempWorktreePath()
+		if err != nil {
+			return nil, false, err
+		}
+		expires := time.Now().Add(tempTTL)
+		spec := worktreeSpec{dst: dst, branchCreate: branchCreate, branchReset: branchReset, orphan: orphan, expires: &expires}
+		if len(args) == 1 {
+			spec.commitish = args[0]
+		}
+		return []worktreeSpec{spec}, false, nil
+	}
+
+	if fromFile == "" && len(args) == 0 {
+		// Without a path, the branch names the worktree.
+		branch := cmp.Or(branchCreate, branchReset, orphan)
+		if prNumber != 0 {
+			branch = fmt.Sprintf("pr-%d", prNumber)
+		}
+		if branch == "" {
+			return nil, false, fmt.Errorf("fatal: <path> is required without -b, -B, --orphan or --pr")
+		}
+		dst, err := defaultWorktreePath(branch)
+		if err != nil {
+			return nil, false, err
+		}
+		return []worktreeSpec{{dst: dst, branchCreate: branchCreate, branchReset: branchReset, orphan: orphan}}, false, nil
+	}
+
+	if fromFile == "" && !allPairs(args) {
+		if len(args) > 2 {
+			return nil, false, fmt.Errorf("accepts between 0 and 2 arg(s), received %d", len(args))
+		}
+		dst, err := filepath.Abs(args[0])
+		if err != nil {
+			return nil, false, fmt.Errorf("error resolving destination path: %w", err)
+		}
+		spec := worktreeSpec{dst: dst, branchCreate: branchCreate, branchReset: branchReset, orphan: orphan}
+		if len(args) == 2 {
+			spec.commitish = args[1]
+		}
+		return []worktreeSpec{spec}, false, nil
+	}
+
+	pairs := args
+	if fromFile != "" {
+		lines, err := readPairsFile(fromFile)
+		if err != nil {
+			return nil, false, err
+		}
+		pairs = append(pairs, lines...)
+	}
+	for _, arg := range pairs {
+		spec, ok := parsePair(arg)
+		if !ok {
+			return nil, false, fmt.Errorf("fatal: '%s' is not a <branch>:<path> pair", arg)
+		}
+		if spec.dst == "" {
+			if spec.dst, err = defaultWorktreePath(spec.branchCreate); err != nil {
+				return nil, false, err
+			}
+		}
+		specs = append(specs, spec)
+	}
+	if len(specs) == 0 {
+		return nil, false, fmt.Errorf("fatal: %s contains no <branch>:<path> pairs", fromFile)
+	}
+	return specs, true, nil
+}
+
+// tempWorktreePath returns an unused path under the managed temp root,
+// .git/fast-worktree/tmp in the main repository. Keeping temporary worktrees
+// inside the repository's git directory puts them on the same volume and
+// out of the way.
+func tempWorktreePath() (string, error) {
+	common, err := gitCommonDir()
+	if err != nil {
+		return "", notRepo(err)
+	}
+	root := filepath.Join(common, "fast-worktree", "tmp")
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return "", fmt.Errorf("error creating temp root: %w", err)
+	}
+	// MkdirTemp only reserves a unique name; add needs the destination not
+	// to exist.
+	dst, err := os.MkdirTemp(root, "wt-")
+	if err != nil {
+		return "", fmt.Errorf("error creating temp worktree path: %w", err)
+	}
+	return dst, os.Remove(dst)
+}
+
+// allPairs reports whether args is a non-empty list of <branch>:<path>
+// pairs.
+func allPairs(args []string) bool {
+	for _, arg := range args {
+		if _, ok := parsePair(arg); !ok {
+			return false
+		}
+	}
+	return len(args) > 0
+}
+
+// parsePair parses a <branch>:<path> argument. A single-letter prefix is
+// a Windows drive letter, not a branch. With no path, as in "feat/x:", the
+// spec's dst is left empty for the default path.
+func parsePair(arg string) (worktreeSpec, bool) {
+	branch, path, ok := strings.Cut(arg, ":")
+	if !ok || len(branch) < 2 {
+		return worktreeSpec{}, false
+	}
+	if path == "" {
+		return worktreeSpec{branchCreate: branch}, true
+	}
+	dst, err := filepath.Abs(path)
+	if err != nil {
+		return worktreeSpec{}, false
+	}
+	return worktreeSpec{dst: dst, branchCreate: branch}, true
+}
+
+// readPairsFile reads <branch>:<path> pairs from file, one per line,
+// ignoring blank lines and # comments.
+func readPairsFile(file string) ([]string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", file, err)
+	}
+	defer f.Close()
+
+	var pairs []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		pairs = append(pairs, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", file, err)
+	}
+	return pairs, nil
+}
+
+// sourceEntries returns the top-level entries of the source working tree
+// that are cloned into each new worktree.
+func sourceEntries(src string) ([]string, error) {
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return nil, fmt.Errorf("error reading source directory: %w", err)
+	}
+
+	var toClone []string
+	for _, e := range entries {
+		if e.Name() == ".git" {
+			continue
+		}
+		toClone = append(toClone, e.Name())
+	}
+	return toClone, nil
+}
+
+// symlinkTargets resolves the untracked symlinks among the top-level
+// entries of src, for --follow-symlinks. Tracked symlinks are left alone,
+// since git would see their target in their place as a type change, and so
+// are dangling ones.
+func symlinkTargets(src string, entries []string) (map[string]string, error) {
+	var links []string
+	for _, name := range entries {
+		if info, err := os.Lstat(filepath.Join(src, name)); err == nil && info.Mode()&fs.ModeSymlink != 0 {
+			links = append(links, name)
+		}
+	}
+	if len(links) == 0 {
+		return nil, nil
+	}
+	out, err := gitCommand(append([]string{"-C", src, "ls-files", "-z", "--"}, links...)...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("git ls-files: %w", err)
+	}
+	tracked := make(map[string]bool)
+	for _, path := range strings.Split(string(out), "\x00") {
+		tracked[path] = true
+	}
+	targets := make(map[string]string)
+	for _, name := range links {
+		if tracked[name] {
+			continue
+		}
+		if target, err := filepath.EvalSymlinks(filepath.Join(src, name)); err == nil {
+			targets[name] = target
+		}
+	}
+	return targets, nil
+}
+
+// sourceClone returns what add clones from src without --sparse: its
+// top-level entries, less those outside its sparse-checkout, and that
+// sparse-checkout.
+func sourceClone(src string) ([]string, *sparseSpec, error) {
+	toClone, err := sourceEntries(src)
+	if err != nil {
+		return nil, nil, err
+	}
+	sparse, err := sourceSparse(src)
+	if err != nil {
+		return nil, nil, err
+	}
+	if sparse != nil {
+		toClone = sparse.filter(src, toClone)
+	}
+	return toClone, sparse, nil
+}
+
+// checkNesting refuses a destination inside the source working tree or any
+// other worktree of the repository, which would then show it as untracked
+// files. A direct child of the source can be forced, since the source's
+// entries are listed before anything is created; anything deeper is always
+// refused because cloning its parent entry would recurse into the new
+// worktree as it is being built. The repository's git directory, where
+// --temp puts worktrees, is neither cloned nor shown, so it is allowed.
+func checkNesting(src, dst string) error {
+	dst = realPath(dst)
+	realSrc := realPath(src)
+	if isWithin(realSrc, dst) {
+		return fmt.Errorf("fatal: '%s' contains the source repository '%s'", dst, src)
+	}
+	if out, err := gitCommand("-C", src, "rev-parse", "--path-format=absolute", "--git-common-dir").Output(); err == nil {
+		if common := realPath(strings.TrimSpace(string(out))); isWithin(dst, common) && dst != common {
+			return nil
+		}
+	}
+	entries, err := listWorktrees(src)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.Bare || !isWithin(dst, realPath(e.Path)) {
+			continue
+		}
+		if realPath(e.Path) == realSrc && filepath.Dir(dst) != realSrc {
+			return fmt.Errorf("fatal: '%s' is nested below the source working tree '%s', which would clone it into itself", dst, src)
+		}
+		if addForce == 0 {
+			return fmt.Errorf("fatal: '%s' is inside the worktree '%s'\nhint: use --force to create it anyway", dst, e.Path)
+		}
+		console.warnf("'%s' is inside the worktree '%s' and will show up there as untracked files", dst, e.Path)
+	}
+	return nil
+}
+
+// worktreeAddMu serializes git worktree add. Concurrent invocations race on
+// the repository's ref and worktree locks; everything after it can run in
+// parallel.
+var worktreeAddMu sync.Mutex
+
+// addWorktree creates the worktree described by spec from src, cloning the
+// toClone entries into it. Progress is reported through log.
+func addWorktree(src string, spec worktreeSpec, toClone []string, log logger) (err error) {
+	dst := spec.dst
+	log = log.with("repo", src, "dst", dst)
+	if _, err := os.Stat(dst); err == nil {
+		return withExitCode(exitExists, fmt.Errorf("fatal: '%s' already exists", dst))
+	}
+	if spec.orphan != "" {
+		return addOrphanWorktree(src, spec, log)
+	}
+	if spec.checkout {
+		return addCheckoutWorktree(src, spec, log)
+	}
+
+	// Pick a backend before touching git so an unsupported filesystem
+	// fails without leaving a registered worktree behind.
+	cloner, err := chooseCloner(backend, src, existingAncestor(filepath.Dir(dst)))
+	if err != nil {
+		if backend != "auto" {
+			return withExitCode(exitUnsupported, fmt.Errorf("fatal: %w", err))
+		}
+		fallbackCloner := fallbacks[fallback]
+		if fallbackCloner == nil {
+			return withExitCode(exitUnsupported, fmt.Errorf("fatal: %w\nhint: pass --fallback=copy to copy the files instead", err))
+		}
+		log.warnf("%v\nfalling back to %s", err, fallbackCloner.Name())
+		cloner = fallbackCloner
+	}
+	if err := checkSpace(src, dst, cloner, log); err != nil {
+		return err
+	}
+	if cloneACLs && cloner.Name() != "clonefile" {
+		log.warnf("--acls only applies to the clonefile backend; %s does not clone ACLs", cloner.Name())
+	}
+
+	ignore, err := loadIgnore(src)
+	if err != nil {
+		return err
+	}
+
+	total := time.Now()
+
+	// Phase 3: Clone each top-level entry in parallel into a hidden sibling
+	// of dst, which is only renamed into place once the worktree is
+	// complete.
+	stepStart := log.start("clone")
+	if err := os.MkdirAll(filepath.Dir(dst), 0o777); err != nil {
+		return fmt.Errorf("fatal: %w", err)
+	}
+	tmp, err := os.MkdirTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".tmp-")
+	if err != nil {
+		return fmt.Errorf("fatal: %w", err)
+	}
+	// MkdirTemp creates the directory 0700. It becomes the worktree, so
+	// recreate it with the mode a plain mkdir would give it.
+	os.Remove(tmp)
+	if err := os.Mkdir(tmp, 0o777); err != nil {
+		return fmt.Errorf("fatal: %w", err)
+	}
+
+	queue := newWorkQueue(slices.Clone(toClone))
+	log.progress = startProgress(src, queue, cloner, log)
+
+	// Phase 1: Register the worktree while the clone runs, writing its .git
+	// file into the clone. Cases registerWorktree leaves to git are created
+	// with git worktree add, whose .git file is then moved into the clone.
+	// Rolling back waits for it, so a registration still in flight is
+	// undone too.
+	var registerErr error
+	var registerTime time.Duration
+	registered := make(chan struct{})
+	go func() {
+		defer close(registered)
+		start := log.start("register")
+		defer func() { registerTime = time.Since(start) }()
+		ok, err := registerWorktree(src, spec, tmp, log)
+		if err != nil || ok {
+			registerErr = err
+			return
+		}
+		if registerErr = gitWorktreeAdd(src, spec); registerErr != nil {
+			return
+		}
+		registerErr = os.Rename(filepath.Join(dst, ".git"), filepath.Join(tmp, ".git"))
+	}()
+	defer atInterrupt(func() {
+		<-registered
+		rollbackAdd(tmp, dst)
+	})()
+	defer func() {
+		if err != nil {
+			<-registered
+			rollbackAdd(tmp, dst)
+		}
+	}()
+
+	if p, ok := cloner.(preparer); ok {
+		prepared, cleanup, err := p.Prepare(src)
+		if err != nil {
+			return fmt.Errorf("preparing %s backend: %w", cloner.Name(), err)
+		}
+		defer cleanup()
+		cloner = prepared
+	}
+	var targets map[string]string
+	if followSymlinks {
+		if targets, err = symlinkTargets(src, toClone); err != nil {
+			return err
+		}
+	}
+	var cloned atomic.Int64
+	var cloneErrors sync.Map
+	var noSpace atomic.Bool
+	var skippedMu sync.Mutex
+	var skipped []string
+
+	// srcPath maps an entry, which may be below the top level, to the
+	// path it is cloned from.
+	srcPath := func(name string) string {
+		first, rest, _ := strings.Cut(name, "/")
+		if target, ok := targets[first]; ok {
+			return filepath.Join(target, filepath.FromSlash(rest))
+		}
+		return filepath.Join(src, filepath.FromSlash(name))
+	}
+	counted := countingCloner{cloner, log.progress}
+
+	cloneOne := func(name string) {
+		dstPath := filepath.Join(tmp, filepath.FromSlash(name))
+		start := time.Now()
+		// Sparse checkouts and split directories clone paths below the
+		// top level.
+		if err := os.MkdirAll(filepath.Dir(dstPath), 0o777); err != nil {
+			cloneErrors.Store(name, err)
+			return
+		}
+		if err := cloneEntry(counted, srcPath(name), dstPath, log); err != nil {
+			var skip *skippedError
+			switch {
+			case errors.Is(err, errNoSpace):
+				noSpace.Store(true)
+			case errors.As(err, &skip):
+				log.warnf("skipping %s: %v", name, err)
+				skippedMu.Lock()
+				skipped = append(skipped, name)
+				skippedMu.Unlock()
+			default:
+				cloneErrors.Store(name, err)
+			}
+			return
+		}
+		if noXattrs {
+			n, err := stripXattrs(dstPath)
+			if err != nil {
+				cloneErrors.Store(name, err)
+				return
+			}
+			log.verbosef(2, "  %s: removed %d extended attributes", name, n)
+		}
+		cloned.Add(1)
+		log.verbosef(1, "  %s (%v)", name, time.Since(start).Round(time.Microsecond))
+		log.entryCloned(name, time.Since(start))
+	}
+
+	// While workers would otherwise sit idle, a directory is split into its
+	// children rather than cloned whole, so a repository with only a few
+	// large top-level directories still clones on every CPU. Backends that
+	// clone whole trees in one call only split near the top.
+	const maxSplitDepth = 3
+	var splitMu sync.Mutex
+	var splitDirs []string
+	split := func(name string) bool {
+		if queue.queued() >= cloneJobs || cloner.SupportsDir() && strings.Count(name, "/") >= maxSplitDepth-1 {
+			return false
+		}
+		info, err := os.Lstat(srcPath(name))
+		if err != nil || !info.IsDir() {
+			return false
+		}
+		entries, err := os.ReadDir(srcPath(name))
+		if err != nil || len(entries) == 0 {
+			return false
+		}
+		dstPath := filepath.Join(tmp, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(dstPath), 0o777); err != nil {
+			return false
+		}
+		// Writable until its children are in, like cloneTree.
+		if err := os.Mkdir(dstPath, 0o700); err != nil {
+			return false
+		}
+		children := make([]string, len(entries))
+		for i, e := range entries {
+			children[i] = name + "/" + e.Name()
+		}
+		splitMu.Lock()
+		splitDirs = append(splitDirs, name)
+		splitMu.Unlock()
+		queue.push(children...)
+		return true
+	}
+
+	// Entries left out by the ignore file, --exclude or --include-only are
+	// skipped as they come up, so an ignored directory is never descended
+	// into.
+	ignored := func(name string) bool {
+		if len(ignore) == 0 {
+			return false
+		}
+		info, err := os.Lstat(srcPath(name))
+		if err != nil || !ignore.match(name, info.IsDir()) {
+			return false
+		}
+		log.verbosef(1, "  %s: ignored", name)
+		skippedMu.Lock()
+		skipped = append(skipped, name)
+		skippedMu.Unlock()
+		return true
+	}
+
+	var wg sync.WaitGroup
+	for range cloneJobs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				name, ok := queue.pop()
+				if !ok {
+					return
+				}
+				switch {
+				case runContext.Err() != nil:
+				case ignored(name):
+				case !noSpace.Load() && !split(name):
+					cloneOne(name)
+				}
+				queue.done()
+			}
+		}()
+	}
+	wg.Wait()
+	log.progress.finish()
+	if err := runContext.Err(); err != nil {
+		return err
+	}
+	// Split directories get their mode and times once they are filled in,
+	// deepest first.
+	for _, name := range slices.Backward(splitDirs) {
+		info, err := os.Lstat(srcPath(name))
+		if err == nil {
+			dstPath := filepath.Join(tmp, filepath.FromSlash(name))
+			if err = os.Chmod(dstPath, info.Mode().Perm()); err == nil {
+				err = os.Chtimes(dstPath, info.ModTime(), info.ModTime())
+			}
+		}
+		if err != nil {
+			cloneErrors.Store(name, err)
+		}
+	}
+	log.infof("%-14s%d entries (%v)", cloner.Name()+":", cloned.Load(), time.Since(stepStart).Round(time.Millisecond))
+	log.report.cloned(cloner.Name(), cloned.Load())
+	log.phase("clone", time.Since(stepStart))
+
+	if noSpace.Load() {
+		return withExitCode(exitCloneFailed, fmt.Errorf("fatal: no space left on the volume of '%s'", dst))
+	}
+	var errCount int
+	cloneErrors.Range(func(key, value any) bool {
+		if errCount == 0 {
+			log.printf("")
+		}
+		errCount++
+		log.printf("  %s: %v", key, value)
+		log.report.fail(fmt.Sprintf("%s: %v", key, value))
+		return true
+	})
+	if errCount > 0 {
+		return withExitCode(exitCloneFailed, fmt.Errorf("%d clone errors occurred", errCount))
+	}
+	if err := handleNestedRepos(tmp, spec.nested); err != nil {
+		return fmt.Errorf("nested repositories: %w", err)
+	}
+	if len(ignore) > 0 && !ignore.topLevel() {
+		pruneStart := time.Now()
+		removed, err := ignore.prune(tmp)
+		if err != nil {
+			return fmt.Errorf("fatal: removing ignored files: %w", err)
+		}
+		skipped = append(skipped, removed...)
+		log.infof("ignore:       %d paths removed (%v)", len(removed), time.Since(pruneStart).Round(time.Millisecond))
+	}
+	if len(copyFiles)+len(extraFiles) > 0 || editorSettings || trustTools {
+		copyStart := time.Now()
+		copied, err := cloneExtraFiles(src, tmp, cloner, log)
+		if err != nil {
+			return err
+		}
+		log.infof("copy:         %d extra files (%v)", len(copied), time.Since(copyStart).Round(time.Millisecond))
+	}
+
+	<-registered
+	if registerErr != nil {
+		return registerErr
+	}
+	log.infof("worktree add: (%v)", registerTime.Round(time.Millisecond))
+	log.phase("register", registerTime)
+
+	// Phase 4: Update git index to match HEAD. Starting from a clone of the
+	// source's index keeps the stat information of unchanged entries, so
+	// the reset only has to touch what differs and git status does not
+	// have to read every file.
+	stepStart = log.start("index")
+	indexCloned, err := cloneIndex(src, tmp)
+	if err != nil {
+		return fmt.Errorf("cloning index: %w", err)
+	}
+	if err := runGit("-C", tmp, "reset", "--no-refresh"); err != nil {
+		return fmt.Errorf("git reset: %w", err)
+	}
+	if indexCloned {
+		log.infof("index:        cloned (%v)", time.Since(stepStart).Round(time.Millisecond))
+	} else {
+		log.infof("git reset:    (%v)", time.Since(stepStart).Round(time.Millisecond))
+	}
+	log.phase("index", time.Since(stepStart))
+
+	if n, err := checkPathNames(tmp, log); err != nil {
+		return fmt.Errorf("path names: %w", err)
+	} else if n > 0 {
+		log.infof("names:        %d renamed to match the index", n)
+	}
+	if err := checkCaseSensitivity(tmp); err != nil {
+		log.warnf("%v", err)
+	}
+
+	// Tracked files in skipped and ignored entries are checked out by git
+	// instead.
+	if len(skipped) > 0 {
+		if err := checkoutPaths(tmp, skipped); err != nil {
+			return err
+		}
+	}
+
+	if spec.sparse != nil {
+		stepStart = log.start("sparse")
+		if err := spec.sparse.apply(tmp); err != nil {
+			return err
+		}
+		if err := spec.sparse.checkoutMissing(src, tmp); err != nil {
+			return err
+		}
+		log.infof("sparse:       %d patterns (%v)", len(spec.sparse.patterns), time.Since(stepStart).Round(time.Millisecond))
+		log.phase("sparse", time.Since(stepStart))
+	}
+
+	// Phase 5: The clone is of the source's HEAD; bring across only what
+	// differs when <commit-ish> names another commit.
+	stepStart = log.start("checkout")
+	if n, err := checkoutDelta(src, tmp); err != nil {
+		if spec.partial && noFetchMissing {
+			return fmt.Errorf("checkout: %w\nhint: <commit-ish> needs blobs missing from this partial clone, drop --no-fetch-missing to fetch them", err)
+		}
+		return fmt.Errorf("checkout: %w", err)
+	} else if n > 0 {
+		log.infof("checkout:     %d paths (%v)", n, time.Since(stepStart).Round(time.Millisecond))
+	}
+	log.phase("checkout", time.Since(stepStart))
+	// Files that git converts on checkout are checked out again, unless
+	// they may hold changes being carried over. In a partial clone that
+	// could mean fetching each one's blob, so they are left to git status.
+	if !carryChanges && !spec.partial {
+		stepStart = log.start("filters")
+		n, err := checkoutConverted(src, tmp)
+		if err != nil {
+			return fmt.Errorf("checkout: %w", err)
+		}
+		if n > 0 {
+			log.infof("filters:      %d files (%v)", n, time.Since(stepStart).Round(time.Millisecond))
+		}
+		log.phase("filters", time.Since(stepStart))
+	}
+	if clean {
+		stepStart = log.start("clean")
+		n, err := cleanCheckout(src, tmp)
+		if err != nil {
+			return fmt.Errorf("clean: %w", err)
+		}
+		log.infof("clean:        %d paths (%v)", n, time.Since(stepStart).Round(time.Millisecond))
+		log.phase("clean", time.Since(stepStart))
+	}
+	if carryChanges {
+		stepStart = log.start("carry")
+		n, err := refreshIndex(tmp)
+		if err != nil {
+			return fmt.Errorf("refresh: %w", err)
+		}
+		log.infof("carried:      %d modified paths (%v)", n, time.Since(stepStart).Round(time.Millisecond))
+		log.phase("carry", time.Since(stepStart))
+	}
+
+	if !recurseSubs {
+		if err := emptySubmodules(tmp); err != nil {
+			return fmt.Errorf("submodules: %w", err)
+		}
+	}
+
+	// Swap the completed worktree in for the empty directory git created.
+	if err := os.Remove(dst); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		return err
+	}
+
+	var workspace string
+	if codeWorkspace {
+		if workspace, err = writeCodeWorkspace(src, dst); err != nil {
+			log.warnf("%v", err)
+		}
+	}
+	recordMetadata(dst, worktreeMetadata{Created: time.Now(), Source: src, SourceCommit: headCommit(src), Backend: cloner.Name(), NewBranch: spec.branchCreate != "", Expires: spec.expires, Workspace: workspace}, log)
+	if err := applyWtConfig(dst, log); err != nil {
+		return err
+	}
+	checkHooks(src, dst, log)
+	trustWorktree(dst, log)
+	excludeWorktree(dst, log)
+
+	// Submodule worktrees are registered with the final paths, so they are
+	// set up once the worktree is in place. A failure leaves the worktree
+	// itself intact.
+	if recurseSubs {
+		if err := setupSubmodules(src, dst, log); err != nil {
+			log.warnf("%v", err)
+		}
+	}
+
+	if err := setupFsmonitor(dst, fsmonitorMode, log); err != nil {
+		log.warnf("fsmonitor: %v", err)
+	}
+	if warm {
+		if err := warmWorktree(dst, log); err != nil {
+			log.warnf("%v", err)
+		}
+	}
+
+	log.infof("\ntotal: %v", time.Since(total).Round(time.Millisecond))
+	return nil
+}
+
+// rollbackAdd undoes a failed or interrupted addWorktree: it deletes the
+// partial clone in tmp, the destination, and, if git has registered the
+// worktree, its administrative directory, which is all git worktree prune
+// would remove. The .git file naming it is in dst or, once moved, in tmp.
+//
+// The clone is moved out of the way before it is deleted, so clones still
+// in flight when interrupted cannot recreate entries under tmp.
+func rollbackAdd(tmp, dst string) {
+	for _, dir := range []string{tmp, dst} {
+		if gitdir, err := worktreeGitdir(dir); err == nil {
+			os.RemoveAll(gitdir)
+		}
+	}
+	if err := trashDir(tmp); err != nil {
+		os.RemoveAll(tmp)
+	}
+	os.RemoveAll(dst)
+}
+
+// guessRemoteBranch applies git worktree add's remote branch DWIM to a
+// spec that neither creates a branch nor asks to --detach:
+//
+//   - add <path> <branch>, where <branch> only exists on one remote, creates
+//     <branch> tracking <remote>/<branch>;
+//   - with --guess-remote (or worktree.guessRemote), add <path> does the same
+//     for the branch named after the basename of <path>.
+func guessRemoteBranch(cmd *cobra.Command, src string, spec *worktreeSpec) {
+	if spec.branchCreate != "" || spec.branchReset != "" || spec.orphan != "" || detachHead {
+		return
+	}
+	if !cmd.Flags().Changed("guess-remote") {
+		out, _ := gitCommand("-C", src, "config", "--bool", "worktree.guessRemote").Output()
+		guessRemote = strings.TrimSpace(string(out)) == "true"
+	}
+
+	name := spec.commitish
+	if name == "" {
+		if !guessRemote {
+			return
+		}
+		name = filepath.Base(spec.dst)
+	} else if localBranchExists(src, name) {
+		return
+	}
+
+	if remote, ok := uniqueRemoteBranch(src, name); ok {
+		spec.branchCreate = name
+		spec.commitish = remote
+		spec.track = true
+	}
+}
+
+// applyDefaultBranch decides what a spec that neither creates a branch nor
+// asks to --detach checks out, according to --default-branch:
+//
+//   - detach always detaches HEAD at <commit-ish>;
+//   - checkout checks out <commit-ish> when it names a local branch;
+//   - create also does, and without <commit-ish> checks out or creates a
+//     branch named after the basename of <path>, like git worktree add.
+func applyDefaultBranch(src string, spec *worktreeSpec) {
+	if spec.branchCreate != "" || spec.branchReset != "" || spec.orphan != "" || detachHead || defaultBranch == "detach" {
+		return
+	}
+	name := spec.commitish
+	if name == "" {
+		if defaultBranch != "create" {
+			return
+		}
+		name = filepath.Base(spec.dst)
+		if !localBranchExists(src, name) {
+			spec.branchCreate = name
+			return
+		}
+		spec.commitish = name
+	}
+	spec.attach = localBranchExists(src, name)
+}
+
+// checkBranchInUse catches git worktree add refusing to check out a branch
+// that is already checked out in another worktree, before anything is
+// cloned. Interactively, the user can choose to detach HEAD at the branch
+// instead; otherwise the error explains the options. --force skips the
+// check, since git then allows it.
+func checkBranchInUse(src string, spec *worktreeSpec) error {
+	if addForce > 0 {
+		return nil
+	}
+	branch := spec.branchReset
+	if spec.attach {
+		branch = spec.commitish
+	}
+	if branch == "" {
+		return nil
+	}
+	entries, err := listWorktrees(src)
+	if err != nil {
+		return err
+	}
+	i := slices.IndexFunc(entries, func(e worktreeEntry) bool { return !e.Bare && e.Branch == branch })
+	if i < 0 {
+		return nil
+	}
+	path := entries[i].Path
+	if spec.branchReset != "" {
+		return fmt.Errorf("fatal: cannot reset branch '%s', it is checked out at '%s'\nhint: use --force to reset it anyway", branch, path)
+	}
+	if !embedded && isTerminal(os.Stdin) && isTerminal(os.Stderr) {
+		fmt.Fprintf(os.Stderr, "'%s' is already checked out at '%s'. Detach HEAD at it instead? [y/N] ", branch, path)
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if strings.HasPrefix(strings.ToLower(strings.TrimSpace(answer)), "y") {
+			spec.attach = false
+			return nil
+		}
+	}
+	return fmt.Errorf("fatal: '%s' is already checked out at '%s'\n"+
+		"hint: a branch can only be checked out in one worktree at a time. Use --detach to\n"+
+		"hint: create the worktree at the same commit with a detached HEAD, -b <new-branch>\n"+
+		"hint: to start a new branch there, or --force to check it out here as well", branch, path)
+}
+
+// isTerminal reports whether f is a terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// localBranchExists reports whether src has a branch called name.
+func localBranchExists(src, name string) bool {
+	return gitCommand("-C", src, "show-ref", "--verify", "-q", "refs/heads/"+name).Run() == nil
+}
+
+// uniqueRemoteBranch returns <remote>/<name> if exactly one remote has a
+// branch called name. Like git, checkout.defaultRemote breaks ties.
+func uniqueRemoteBranch(src, name string) (string, bool) {
+	out, err := gitCommand("-C", src, "remote").Output()
+	if err != nil {
+		return "", false
+	}
+	var found []string
+	for _, remote := range strings.Fields(string(out)) {
+		if gitCommand("-C", src, "show-ref", "--verify", "-q", "refs/remotes/"+remote+"/"+name).Run() == nil {
+			found = append(found, remote)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return "", false
+	case 1:
+		return found[0] + "/" + name, true
+	}
+	out, _ = gitCommand("-C", src, "config", "checkout.defaultRemote").Output()
+	if def := strings.TrimSpace(string(out)); slices.Contains(found, def) {
+		return def + "/" + name, true
+	}
+	return "", false
+}
+
+// gitWorktreeAdd registers the worktree described by spec with git without
+// checking anything out.
+func gitWorktreeAdd(src string, spec worktreeSpec) error {
+	worktreeArgs := []string{"-C", src, "worktree", "add", "--no-checkout"}
+	for range addForce {
+		worktreeArgs = append(worktreeArgs, "--force")
+	}
+	if quiet {
+		worktreeArgs = append(worktreeArgs, "--quiet")
+	}
+	if spec.branchCreate != "" {
+		worktreeArgs = append(worktreeArgs, "-b", spec.branchCreate)
+	} else if spec.branchReset != "" {
+		worktreeArgs = append(worktreeArgs, "-B", spec.branchReset)
+	} else if !spec.attach {
+		worktreeArgs = append(worktreeArgs, "--detach")
+	}
+	if spec.track || track {
+		worktreeArgs = append(worktreeArgs, "--track")
+	}
+	if noTrack {
+		worktreeArgs = append(worktreeArgs, "--no-track")
+	}
+	// Locking as part of worktree add leaves no window in which a
+	// concurrent git worktree prune could drop the new worktree.
+	if lock {
+		worktreeArgs = append(worktreeArgs, "--lock")
+		if reason != "" {
+			worktreeArgs = append(worktreeArgs, "--reason", reason)
+		}
+	}
+	worktreeArgs = append(worktreeArgs, gitArgs...)
+	worktreeArgs = append(worktreeArgs, spec.dst)
+	if spec.commitish != "" {
+		worktreeArgs = append(worktreeArgs, spec.commitish)
+	}
+
+	worktreeAddMu.Lock()
+	defer worktreeAddMu.Unlock()
+	if err := runGit(worktreeArgs...); err != nil {
+		return gitFailed("git worktree add")
+	}
+	return nil
+}
+
+// addOrphanWorktree creates an empty worktree on a new unborn branch. There
+// is nothing to clone, so this is git worktree add --orphan, done in a way
+// that also works with git older than 2.42: register a detached worktree
+// without checking anything out, leaving the index and tree empty, then
+// point its HEAD at the unborn branch.
+func addOrphanWorktree(src string, spec worktreeSpec, log logger) error {
+	ref := "refs/heads/" + spec.orphan
+	if err := gitCommand("-C", src, "check-ref-format", ref).Run(); err != nil {
+		return fmt.Errorf("fatal: '%s' is not a valid branch name", spec.orphan)
+	}
+	if err := gitCommand("-C", src, "rev-parse", "--verify", "-q", ref).Run(); err == nil {
+		return fmt.Errorf("fatal: a branch named '%s' already exists", spec.orphan)
+	}
+
+	total := log.start("orphan")
+	if err := gitWorktreeAdd(src, spec); err != nil {
+		return err
+	}
+	if err := runGit("-C", spec.dst, "symbolic-ref", "HEAD", ref); err != nil {
+		return gitFailed("git symbolic-ref")
+	}
+	recordMetadata(spec.dst, worktreeMetadata{Created: time.Now(), Source: src, SourceCommit: headCommit(src), NewBranch: true, Expires: spec.expires}, log)
+	if err := applyWtConfig(spec.dst, log); err != nil {
+		return err
+	}
+
+	if err := setupFsmonitor(spec.dst, fsmonitorMode, log); err != nil {
+		log.warnf("fsmonitor: %v", err)
+	}
+
+	log.infof("orphan:       %s (%v)", spec.orphan, time.Since(total).Round(time.Millisecond))
+	log.phase("orphan", time.Since(total))
+	return nil
+}
+
+// addCheckoutWorktree creates a worktree of repo with a normal checkout. It
+// is used for the first worktree of a bare repository, which has no working
+// tree to clone.
+func addCheckoutWorktree(repo string, spec worktreeSpec, log logger) error {
+	total := log.start("checkout")
+	if err := gitWorktreeAdd(repo, spec); err != nil {
+		return err
+	}
+	if err := runGit("-C", spec.dst, "reset", "--hard", "--quiet"); err != nil {
+		return gitFailed("git reset --hard")
+	}
+	recordMetadata(spec.dst, worktreeMetadata{Created: time.Now(), Backend: "checkout", NewBranch: spec.branchCreate != "", Expires: spec.expires}, log)
+	if err := applyWtConfig(spec.dst, log); err != nil {
+		return err
+	}
+	trustWorktree(spec.dst, log)
+	excludeWorktree(spec.dst, log)
+
+	if err := setupFsmonitor(spec.dst, fsmonitorMode, log); err != nil {
+		log.warnf("fsmonitor: %v", err)
+	}
+	if warm {
+		if err := warmWorktree(spec.dst, log); err != nil {
+			log.warnf("%v", err)
+		}
+	}
+
+	log.infof("checkout:     (%v)", time.Since(total).Round(time.Millisecond))
+	log.report.cloned("checkout", 0)
+	log.phase("checkout", time.Since(total))
+	return nil
+}
+
+// recordMetadata writes meta for the worktree at dst, with what it has
+// checked out and how add was run, warning rather than failing since the
+// worktree itself is complete.
+func recordMetadata(dst string, meta worktreeMetadata, log logger) {
+	if out, err := gitCommand("-C", dst, "symbolic-ref", "--short", "-q", "HEAD").Output(); err == nil {
+		meta.Branch = strings.TrimSpace(string(out))
+	}
+	meta.Commit, meta.Flags, meta.Version = headCommit(dst), addFlagsUsed, toolVersion()
+	gitdir, err := worktreeGitdir(dst)
+	if err == nil {
+		err = writeMetadata(gitdir, meta)
+	}
+	if err != nil {
+		log.warnf("could not record worktree metadata: %v", err)
+	}
+}
+
+func init() {
+	addCmd.Flags().StringVarP(&branchCreate, "branch", "b", "", "create a new branch")
+	addCmd.Flags().StringVarP(&branchReset, "force-branch", "B", "", "create or reset a branch")
+	addCmd.Flags().StringVar(&defaultBranch, "default-branch", "detach", "without -b or -B: detach, checkout an existing <commit-ish> branch, or also create one named after <path> (default: fastworktree.defaultBranch)")
+	addCmd.Flags().StringVar(&fetchRemote, "fetch", "", "run git fetch on `remote` before creating the worktree")
+	addCmd.Flags().Lookup("fetch").NoOptDefVal = "origin"
+	addCmd.Flags().StringVar(&issueRef, "issue", "", "create a branch for this issue `key`, number or URL (PROJ-123, #123, https://...), named by --issue-template")
+	addCmd.Flags().StringVar(&issueTemplate, "issue-template", "{{.Key}}{{with .Title}}-{{slug .}}{{end}}", "Go template of --issue's branch name, from .Key, .Title and .URL, with slug, sanitize, lower and upper")
+	addCmd.Flags().StringVar(&issueCommand, "issue-command", "", "shell command that prints the title of issue $GFW_ISSUE ($GFW_ISSUE_URL), for --issue-template")
+	addCmd.Flags().IntVar(&prNumber, "pr", 0, "check out pull/merge request `number` on a pr-<number> branch, fetched from the --fetch remote (default origin)")
+	addCmd.Flags().BoolVar(&clean, "clean", false, "restore modified files and delete untracked and ignored files, so the worktree matches the commit exactly")
+	addCmd.Flags().BoolVar(&carryChanges, "carry-changes", false, "keep the source's uncommitted changes and refresh the index so git status shows them as modified")
+	addCmd.Flags().BoolVar(&recurseSubs, "recurse-submodules", false, "set up submodules, reusing the source's cloned submodule working trees")
+	addCmd.Flags().StringSliceVar(&sparsePaths, "sparse", nil, "only clone and check out these directories, as a cone mode sparse-checkout")
+	addCmd.Flags().StringArrayVar(&excludePatterns, "exclude", nil, "do not clone what this gitignore pattern matches, as if it were in "+ignoreFile+"; may be repeated")
+	addCmd.Flags().StringArrayVar(&wtConfig, "wt-config", nil, "set this <key>=<value> in the new worktree's own git config, enabling extensions.worktreeConfig if needed; may be repeated")
+	addCmd.Flags().BoolVar(&installHooks, "install-hooks", false, "run the install step of the worktree's hook manager (lefthook, husky or pre-commit) once it is created")
+	addCmd.Flags().StringVar(&openCommand, "open", "", "open the new worktree with this editor (code, cursor, idea, zed...) or shell command using $GFW_WORKTREE")
+	addCmd.Flags().BoolVar(&excludeTimeMachine, "exclude-time-machine", true, "exclude the new worktree from Time Machine backups, as tmutil addexclusion does (macOS)")
+	addCmd.Flags().BoolVar(&excludeSpotlight, "exclude-spotlight", false, "keep Spotlight from indexing the new worktree with a "+spotlightMarker+" file, ignored in info/exclude (macOS)")
+	addCmd.Flags().BoolVar(&trustTools, "trust", false, "clone .envrc, .tool-versions and mise.toml even if ignored, and run direnv allow and mise trust in the new worktree")
+	addCmd.Flags().BoolVar(&tmuxSession, "tmux", false, "start a tmux session named after the branch in the new worktree, switching to it inside tmux")
+	addCmd.Flags().BoolVar(&zoxideAdd, "zoxide", false, "add the new worktree to zoxide's database")
+	addCmd.Flags().BoolVar(&editorSettings, "editor-settings", false, "clone the source's .vscode, .idea, .fleet and .zed directories even if they are excluded")
+	addCmd.Flags().BoolVar(&codeWorkspace, "code-workspace", false, "write a VS Code workspace file next to the new worktree, titled with its branch")
+	addCmd.Flags().StringArrayVar(&postCreate, "post-create", nil, "run this shell command in the new worktree once it is created, with GFW_WORKTREE, GFW_BRANCH, GFW_COMMIT and GFW_SOURCE set; may be repeated")
+	addCmd.Flags().StringArrayVar(&copyFiles, "copy", nil, "clone this file, or glob, even if it is ignored, excluded or outside --sparse, such as .env; may be repeated")
+	addCmd.Flags().StringArrayVar(&extraFiles, "extra-files", nil, "files to --copy into every worktree, for the config")
+	addCmd.Flags().MarkHidden("extra-files")
+	addCmd.Flags().StringArrayVar(&includeOnly, "include-only", nil, "only clone this top-level entry (a name or glob), leaving git to check out the tracked files of the rest; may be repeated")
+	addCmd.Flags().BoolVar(&noFetchMissing, "no-fetch-missing", false, "in a partial clone, fail instead of fetching missing blobs from the promisor remote (git 2.44+)")
+	addCmd.Flags().StringVar(&fromWorktree, "from", "", "clone the files of another worktree: main, a worktree path, or a branch checked out in one (default: the current worktree)")
+	addCmd.Flags().StringVar(&nestedMode, "nested-repos", "warn", "untracked nested git repositories: warn and clone them, skip them, strip their .git, or clone them silently")
+	addCmd.Flags().BoolVar(&cloneACLs, "acls", false, "also clone access control lists (clonefile backend only)")
+	addCmd.Flags().BoolVar(&noXattrs, "no-xattrs", false, "remove extended attributes, such as quarantine and provenance flags, from the cloned files")
+	addCmd.Flags().BoolVar(&followSymlinks, "follow-symlinks", false, "clone what untracked top-level symlinks point to rather than the links themselves")
+	addCmd.Flags().IntVarP(&cloneJobs, "jobs", "j", runtime.NumCPU(), "number of entries to clone in parallel")
+	addCmd.Flags().StringVar(&fsmonitorMode, "fsmonitor", "off", "start a filesystem monitor in the new worktree: builtin, watchman or off (default: fastworktree.fsmonitor)")
+	addCmd.Flags().Lookup("fsmonitor").NoOptDefVal = "builtin"
+	addCmd.Flags().BoolVar(&jsonOutput, "json", false, "print a JSON summary of each worktree on stdout instead of progress: path, branch, commit, backend, phase timings and errors")
+	addCmd.Flags().StringVar(&statsOut, "stats-out", "", "append this run's phase timings, entry counts, sizes and errors to a file, as CSV if it ends in .csv and JSON lines otherwise")
+	addCmd.Flags().StringVar(&progress, "progress", "human", "progress output: human-readable lines on stderr, or ndjson events on stdout as they happen")
+	addCmd.Flags().BoolVar(&warm, "warm", false, "enable the untracked cache and run git status in the background, so the first one is fast")
+	addCmd.Flags().BoolVar(&useGit, "use-git", false, "register the worktree with git worktree add instead of writing its administrative files directly")
+	addCmd.Flags().BoolVar(&fromPool, "from-pool", false, "take a worktree from the pool (see pool fill) instead of cloning one, if there is one")
+	addCmd.Flags().StringVar(&headroom, "headroom", "1G", "warn unless this much space is left for changes once the worktree is created")
+	addCmd.Flags().StringArrayVar(&gitArgs, "git-arg", nil, "pass an extra argument to git worktree add; may be repeated")
+	addCmd.Flags().CountVarP(&addForce, "force", "f", "add even if the branch is checked out elsewhere, the path is a stale worktree or the volume looks too full; give twice for a locked one")
+	addCmd.Flags().StringVar(&orphan, "orphan", "", "create an empty worktree on a new unborn branch")
+	addCmd.Flags().BoolVar(&track, "track", false, "set up tracking mode (see git-branch(1))")
+	addCmd.Flags().BoolVar(&noTrack, "no-track", false, "do not set up tracking mode")
+	addCmd.Flags().BoolVar(&guessRemote, "guess-remote", false, "without <commit-ish>, base the new branch on a remote branch named after <path> (default: worktree.guessRemote)")
+	addCmd.Flags().BoolVar(&detachHead, "detach", false, "detach HEAD even when <commit-ish> names a remote branch")
+	addCmd.Flags().BoolVar(&lock, "lock", false, "keep the worktree locked after creation (git worktree add --lock)")
+	addCmd.Flags().StringVar(&reason, "reason", "", "reason for locking (git worktree add --reason)")
+	addCmd.Flags().StringVar(&backend, "backend", "auto", "copy-on-write backend to use, or auto to pick one")
+	addCmd.Flags().StringVar(&fallback, "fallback", "copy", "what to do without copy-on-write support: copy, hardlink or error")
+	addCmd.Flags().BoolVar(&addTemp, "temp", false, "create a temporary worktree under .git/fast-worktree/tmp that prune --expired removes")
+	addCmd.Flags().DurationVar(&tempTTL, "ttl", 24*time.Hour, "how long a --temp worktree lives")
+	addCmd.Flags().IntVar(&maxWorktrees, "max-worktrees", 0, "most worktrees created by this tool to keep, 0 for no limit")
+	addCmd.Flags().StringVar(&maxUsage, "max-usage", "", "most private disk usage, e.g. 50G, of the worktrees created by this tool")
+	addCmd.Flags().StringVar(&onQuota, "on-quota", "refuse", "over --max-worktrees or --max-usage: refuse, or evict the least recently used clean worktrees")
+	addCmd.Flags().StringVar(&fromFile, "from-file", "", "read <branch>:<path> pairs to create from a file, one per line")
+	addCmd.Flags().StringVar(&worktreeRoot, "root", "..", "directory worktrees are created in when no <path> is given, relative to the main worktree")
+	addCmd.Flags().StringVar(&pathTemplate, "path-template", "{{.Repo}}-{{.Branch | sanitize}}", "name of a worktree created without a <path>, as a Go template of .Repo and .Branch with sanitize and lower functions")
+}
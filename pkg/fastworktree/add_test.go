@@ -0,0 +1,91 @@
+package fastworktree
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestRepo creates a repository with one commit in a temporary
+// directory and returns its path.
+func newTestRepo(t *testing.T) string {
+	t.Helper()
+	dir := filepath.Join(t.TempDir(), "repo")
+	runTestGit(t, "init", "-q", dir)
+	runTestGit(t, "-C", dir, "-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "--allow-empty", "-m", "initial")
+	return dir
+}
+
+// runTestGit runs git with args, failing the test if it fails.
+func runTestGit(t *testing.T, args ...string) {
+	t.Helper()
+	if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+}
+
+func TestCheckNesting(t *testing.T) {
+	src := newTestRepo(t)
+	tests := []struct {
+		name string
+		dst  string
+		err  string // a substring of the error, or "" for none
+	}{
+		{"sibling", filepath.Join(src, "..", "wt"), ""},
+		{"temp", filepath.Join(src, ".git", "fast-worktree", "tmp", "wt-1"), ""},
+		{"child", filepath.Join(src, "wt"), "is inside the worktree"},
+		{"nested", filepath.Join(src, "sub", "wt"), "is nested below the source working tree"},
+		{"parent", filepath.Dir(src), "contains the source repository"},
+		{"git dir", filepath.Join(src, ".git"), "is inside the worktree"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkNesting(src, tt.dst)
+			switch {
+			case tt.err == "" && err != nil:
+				t.Errorf("checkNesting(%s) = %v, want nil", tt.dst, err)
+			case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+				t.Errorf("checkNesting(%s) = %v, want an error containing %q", tt.dst, err, tt.err)
+			}
+		})
+	}
+}
+
+// TestBatchAdd creates two worktrees at once, whose clones run
+// concurrently; run it with -race.
+func TestBatchAdd(t *testing.T) {
+	repo := newTestRepo(t)
+	writeFiles(t, repo, map[string]string{"tracked.txt": "t", ".gitignore": "ignored/\n"})
+	commitAll(t, repo, "files")
+	writeFiles(t, repo, map[string]string{"ignored/dep.txt": "d"})
+
+	parent := filepath.Dir(repo)
+	pairs := []string{"feat/a:" + filepath.Join(parent, "a"), "feat/b:" + filepath.Join(parent, "b")}
+	var reports []*addReport
+	err := call(context.Background(), repo, nil, nil, nil, func(string) error {
+		var err error
+		reports, err = runAdd(addCmd, pairs)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 2 {
+		t.Fatalf("batch add reported %d worktrees, want 2", len(reports))
+	}
+	for _, name := range []string{"a", "b"} {
+		dst := filepath.Join(parent, name)
+		if data, err := os.ReadFile(filepath.Join(dst, "ignored", "dep.txt")); err != nil || string(data) != "d" {
+			t.Errorf("%s: ignored/dep.txt = %q, %v", name, data, err)
+		}
+		if branch := currentBranch(dst); branch != "feat/"+name {
+			t.Errorf("%s is on branch %s, want feat/%s", name, branch, name)
+		}
+		if status := gitStatus(t, dst); status != "!! ignored/" {
+			t.Errorf("git status in %s:\n%s", name, status)
+		}
+	}
+}
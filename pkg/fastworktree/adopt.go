@@ -0,0 +1,100 @@
+package fastworktree
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var adoptFrom string
+
+var adoptCmd = &cobra.Command{
+	Use:   "adopt [flags] <worktree>",
+	Short: "Manage a worktree created by git worktree add",
+	Long: "Records the metadata add would have for a worktree created some other way, such\n" +
+		"as with git worktree add, so list, info, status, prune and the rest treat it as\n" +
+		"created by this tool. The add config applies to it as if add had created it:\n" +
+		"the files of --copy, extra-files and --trust that it lacks are cloned from\n" +
+		"--from, and --wt-config, --trust, --fsmonitor, --code-workspace and\n" +
+		"--post-create are applied.",
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dst, err := findWorktree(args[0])
+		if err != nil {
+			return err
+		}
+		gitdir, err := worktreeGitdir(dst)
+		if err != nil {
+			return fmt.Errorf("fatal: %w", err)
+		}
+		if _, ok := readMetadata(gitdir); ok {
+			return fmt.Errorf("fatal: '%s' is already managed by git-fast-worktree", dst)
+		}
+		src, err := sourceWorktree(adoptFrom)
+		if err != nil {
+			return err
+		}
+		// What add does to a new worktree comes from add's flags, so its
+		// config is what applies here.
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		if err := applyConfig(addCmd, cfg); err != nil {
+			return err
+		}
+		return adoptWorktree(src, dst, gitdir, console)
+	},
+}
+
+// adoptWorktree does for the worktree at dst, administered in gitdir, what
+// add does once it has cloned a worktree's files from src.
+func adoptWorktree(src, dst, gitdir string, log logger) error {
+	start := time.Now()
+	if len(copyFiles)+len(extraFiles) > 0 || editorSettings || trustTools {
+		cloner, err := chooseCloner(backend, src, dst)
+		if err != nil {
+			cloner = fallbacks["copy"]
+		}
+		copied, err := cloneExtraFiles(src, dst, cloner, log)
+		if err != nil {
+			return err
+		}
+		log.infof("copy:         %d extra files", len(copied))
+	}
+	var workspace string
+	if codeWorkspace {
+		var err error
+		if workspace, err = writeCodeWorkspace(src, dst); err != nil {
+			log.warnf("%v", err)
+		}
+	}
+	// git writes commondir once, when it creates the worktree.
+	created := time.Now()
+	if info, err := os.Stat(filepath.Join(gitdir, "commondir")); err == nil {
+		created = info.ModTime()
+	}
+	recordMetadata(dst, worktreeMetadata{Created: created, Source: src, Backend: "adopted", Workspace: workspace}, log)
+	if err := applyWtConfig(dst, log); err != nil {
+		return err
+	}
+	checkHooks(src, dst, log)
+	trustWorktree(dst, log)
+	excludeWorktree(dst, log)
+	if err := setupFsmonitor(dst, fsmonitorMode, log); err != nil {
+		log.warnf("fsmonitor: %v", err)
+	}
+	if err := runPostCreate(src, dst, log); err != nil {
+		return err
+	}
+	recordHistory(historyEntry{Op: "adopt", Path: dst, Branch: currentBranch(dst)}, start)
+	log.infof("adopted: %s", dst)
+	return nil
+}
+
+func init() {
+	adoptCmd.Flags().StringVar(&adoptFrom, "from", "main", "worktree to clone missing --copy files from: main, a worktree path, or a branch checked out in one")
+}
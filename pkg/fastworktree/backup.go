@@ -0,0 +1,81 @@
+package fastworktree
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+var (
+	excludeTimeMachine bool
+	excludeSpotlight   bool
+)
+
+// spotlightMarker is the file that tells Spotlight not to index the
+// directory it is in.
+const spotlightMarker = ".metadata_never_index"
+
+// excludeWorktree keeps the new worktree at dst out of backups with
+// --exclude-time-machine, and out of Spotlight's index with
+// --exclude-spotlight: it is a copy of one that is backed up and indexed
+// already, and backing up or indexing each worktree would take as long as
+// the original. Both are macOS only, and failures are only warnings.
+func excludeWorktree(dst string, log logger) {
+	if runtime.GOOS != "darwin" {
+		return
+	}
+	if excludeTimeMachine {
+		if err := excludeFromBackups(dst); err != nil {
+			log.warnf("could not exclude %s from Time Machine: %v", dst, err)
+		} else {
+			log.verbosef(1, "time machine: excluded %s", dst)
+		}
+	}
+	if excludeSpotlight {
+		if err := excludeFromSpotlight(dst); err != nil {
+			log.warnf("could not exclude %s from Spotlight: %v", dst, err)
+		} else {
+			log.verbosef(1, "spotlight: excluded %s", dst)
+		}
+	}
+}
+
+// excludeFromSpotlight writes the Spotlight marker into the worktree at dst
+// and adds it to the repository's info/exclude, so git status does not
+// show it.
+func excludeFromSpotlight(dst string) error {
+	if err := os.WriteFile(filepath.Join(dst, spotlightMarker), nil, 0o644); err != nil {
+		return err
+	}
+	out, err := gitCommand("-C", dst, "rev-parse", "--path-format=absolute", "--git-path", "info/exclude").Output()
+	if err != nil {
+		return err
+	}
+	exclude := strings.TrimSpace(string(out))
+	pattern := "/" + spotlightMarker
+	data, err := os.ReadFile(exclude)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) == pattern {
+			return nil
+		}
+	}
+	if len(data) > 0 && !strings.HasSuffix(string(data), "\n") {
+		pattern = "\n" + pattern
+	}
+	if err := os.MkdirAll(filepath.Dir(exclude), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(exclude, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(pattern + "\n"); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
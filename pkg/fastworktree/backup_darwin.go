@@ -0,0 +1,20 @@
+//go:build darwin
+
+package fastworktree
+
+import "golang.org/x/sys/unix"
+
+// backupExcludeXattr is the extended attribute tmutil addexclusion sets on
+// an item to keep it out of Time Machine backups. Unlike an exclusion by
+// path, it moves with the item.
+const backupExcludeXattr = "com.apple.metadata:com_apple_backup_excludeItem"
+
+// backupExcludeValue is the attribute's value: a binary property list of
+// the string com.apple.backupd.
+var backupExcludeValue = []byte("bplist00_\x10\x11com.apple.backupd\x08\x00\x00\x00\x00\x00\x00\x01\x01\x00\x00\x00\x00\x00\x00\x00\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x1c")
+
+// excludeFromBackups keeps path out of Time Machine backups, as tmutil
+// addexclusion does, without running it.
+func excludeFromBackups(path string) error {
+	return unix.Setxattr(path, backupExcludeXattr, backupExcludeValue, 0)
+}
@@ -0,0 +1,8 @@
+//go:build !darwin
+
+package fastworktree
+
+// excludeFromBackups is not called: only macOS has Time Machine.
+func excludeFromBackups(path string) error {
+	return nil
+}
@@ -0,0 +1,118 @@
+package fastworktree
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var benchRuns int
+
+var benchCmd = &cobra.Command{
+	Use:   "bench [flags] [<commit-ish>]",
+	Short: "Compare creating a worktree with git worktree add",
+	Long: "Creates worktrees at <commit-ish> (default HEAD) both by cloning and with plain\n" +
+		"git worktree add, next to the repository so they are on the same volume, and\n" +
+		"reports how long each took. Every worktree is removed again.",
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if benchRuns < 1 {
+			return fmt.Errorf("fatal: --runs must be at least 1")
+		}
+		commitish := "HEAD"
+		if len(args) == 1 {
+			commitish = args[0]
+		}
+		src, err := gitToplevel()
+		if err != nil {
+			return notRepo(err)
+		}
+		toClone, sparse, err := sourceClone(src)
+		if err != nil {
+			return err
+		}
+		spec := worktreeSpec{commitish: commitish, sparse: sparse, partial: partialClone(src)}
+
+		handleInterrupts()
+		var fast, plain []time.Duration
+		for run := 1; run <= benchRuns; run++ {
+			console.infof("run %d/%d", run, benchRuns)
+
+			spec.dst, err = benchPath(src)
+			if err != nil {
+				return err
+			}
+			start := time.Now()
+			// The per-step output of add would drown the results.
+			saved := quiet
+			quiet = true
+			err = addWorktree(src, spec, toClone, console)
+			quiet = saved
+			if err != nil {
+				return err
+			}
+			fast = append(fast, time.Since(start))
+			if err := benchRemove(spec.dst); err != nil {
+				return err
+			}
+
+			dst, err := benchPath(src)
+			if err != nil {
+				return err
+			}
+			cancel := atInterrupt(func() { benchRemove(dst) })
+			start = time.Now()
+			err = gitCommand("-C", src, "worktree", "add", "--quiet", "--detach", dst, commitish).Run()
+			plain = append(plain, time.Since(start))
+			cancel()
+			if err != nil {
+				benchRemove(dst)
+				return gitFailed("git worktree add")
+			}
+			if err := benchRemove(dst); err != nil {
+				return err
+			}
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "METHOD\tMIN\tMEDIAN\tMAX")
+		for _, row := range []struct {
+			method string
+			times  []time.Duration
+		}{{"git-fast-worktree", fast}, {"git worktree add", plain}} {
+			slices.Sort(row.times)
+			fmt.Fprintf(w, "%s\t%v\t%v\t%v\n", row.method,
+				row.times[0].Round(time.Millisecond), row.times[len(row.times)/2].Round(time.Millisecond), row.times[len(row.times)-1].Round(time.Millisecond))
+		}
+		w.Flush()
+		fmt.Printf("\n%.1fx faster (median)\n", float64(plain[len(plain)/2])/float64(fast[len(fast)/2]))
+		return nil
+	},
+}
+
+// benchPath returns an unused path next to the repository at src.
+func benchPath(src string) (string, error) {
+	dst, err := os.MkdirTemp(filepath.Dir(src), "."+filepath.Base(src)+"-bench-")
+	if err != nil {
+		return "", fmt.Errorf("error creating benchmark worktree path: %w", err)
+	}
+	return dst, os.Remove(dst)
+}
+
+// benchRemove removes a worktree created by bench.
+func benchRemove(dst string) error {
+	gitdir, err := worktreeGitdir(dst)
+	if err != nil {
+		return os.RemoveAll(dst)
+	}
+	return removeWorktree(dst, gitdir)
+}
+
+func init() {
+	benchCmd.Flags().IntVarP(&benchRuns, "runs", "n", 3, "number of times to create a worktree each way")
+}
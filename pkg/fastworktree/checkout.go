@@ -0,0 +1,309 @@
+package fastworktree
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// checkoutDelta makes the files cloned from src match the commit checked out
+// at dst, once dst's index has been reset to it. The clone reflects src's
+// HEAD, so only the paths that differ between the two commits need to be
+// deleted or rewritten. It returns the number of paths updated.
+func checkoutDelta(src, dst string) (int, error) {
+	srcHead, err := gitCommand("-C", src, "rev-parse", "--verify", "-q", "HEAD").Output()
+	if err != nil {
+		return 0, fmt.Errorf("resolving HEAD of %s: %w", src, err)
+	}
+	dstHead, err := gitCommand("-C", dst, "rev-parse", "--verify", "-q", "HEAD").Output()
+	if err != nil {
+		return 0, fmt.Errorf("resolving HEAD of %s: %w", dst, err)
+	}
+	if bytes.Equal(srcHead, dstHead) {
+		return 0, nil
+	}
+
+	out, err := gitCommand("-C", dst, "diff", "--name-status", "-z", "--no-renames",
+		strings.TrimSpace(string(srcHead)), "HEAD").Output()
+	if err != nil {
+		return 0, fmt.Errorf("git diff: %w", err)
+	}
+
+	// Deletions are applied first so a path that changes between file and
+	// directory is free for checkout-index.
+	var update bytes.Buffer
+	var n int
+	for _, change := range parseNameStatus(string(out)) {
+		status, path := change[0], change[1]
+		full := filepath.Join(dst, filepath.FromSlash(path))
+		n++
+		// A directory here is a submodule's clone, which is removed whole
+		// when the submodule is deleted or replaced by a file.
+		if status == "D" || status == "T" {
+			if info, err := os.Lstat(full); err == nil && info.IsDir() {
+				if err := os.RemoveAll(full); err != nil {
+					return n, err
+				}
+			}
+		}
+		if status != "D" {
+			update.WriteString(path + "\x00")
+			continue
+		}
+		if err := removeFile(dst, full); err != nil {
+			return n, err
+		}
+	}
+
+	if update.Len() > 0 {
+		cmd := gitCommand("-C", dst, "checkout-index", "--force", "-z", "--stdin")
+		cmd.Stdin = &update
+		cmd.Stderr = stderr
+		if err := cmd.Run(); err != nil {
+			return n, fmt.Errorf("git checkout-index: %w", err)
+		}
+	}
+	return n, nil
+}
+
+// parseNameStatus parses the output of git diff --name-status -z
+// --no-renames, whose records are <status>\0<path>\0, into status and
+// path pairs.
+func parseNameStatus(out string) [][2]string {
+	var changes [][2]string
+	fields := strings.Split(strings.TrimSuffix(out, "\x00"), "\x00")
+	for i := 0; i+1 < len(fields); i += 2 {
+		changes = append(changes, [2]string{fields[i], fields[i+1]})
+	}
+	return changes
+}
+
+// removeFile deletes path and then any parent directories below root that
+// are left empty, as git does when a checkout drops the last file in one.
+func removeFile(root, path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for dir := filepath.Dir(path); dir != root && len(dir) > len(root); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+// cleanCheckout removes what the clone carried over from the source's
+// working tree beyond its HEAD, once dst's index has been reset: modified,
+// deleted and staged tracked files are restored from dst's HEAD, and
+// untracked and ignored files are deleted. It returns the number of paths
+// cleaned.
+func cleanCheckout(src, dst string) (int, error) {
+	out, err := gitCommand("-C", src, "status", "--porcelain", "-z", "--ignored", "--untracked-files=normal").Output()
+	if err != nil {
+		return 0, fmt.Errorf("git status: %w", err)
+	}
+
+	remove, restore := parseStatus(string(out))
+	cleaned := len(remove) + len(restore)
+
+	// Paths that only exist in the source's index have nothing to restore.
+	var update bytes.Buffer
+	if len(restore) > 0 {
+		var query bytes.Buffer
+		for _, path := range restore {
+			query.WriteString("HEAD:" + path + "\n")
+		}
+		// Only asking for the object name resolves the path without
+		// reading the object, which in a partial clone could fetch it.
+		cmd := gitCommand("-C", dst, "cat-file", "--batch-check=%(objectname)")
+		cmd.Stdin = &query
+		out, err := cmd.Output()
+		if err != nil {
+			return 0, fmt.Errorf("git cat-file: %w", err)
+		}
+		for i, line := range strings.Split(strings.TrimSuffix(string(out), "\n"), "\n") {
+			if strings.HasSuffix(line, " missing") {
+				remove = append(remove, restore[i])
+			} else {
+				update.WriteString(restore[i] + "\x00")
+			}
+		}
+	}
+
+	for _, path := range remove {
+		if err := os.RemoveAll(filepath.Join(dst, filepath.FromSlash(strings.TrimSuffix(path, "/")))); err != nil {
+			return 0, err
+		}
+	}
+	if update.Len() > 0 {
+		cmd := gitCommand("-C", dst, "checkout-index", "--force", "-z", "--stdin")
+		cmd.Stdin = &update
+		cmd.Stderr = stderr
+		if err := cmd.Run(); err != nil {
+			return 0, fmt.Errorf("git checkout-index: %w", err)
+		}
+	}
+	return cleaned, nil
+}
+
+// parseStatus parses the output of git status --porcelain -z --ignored
+// into the untracked and ignored paths to remove and the tracked ones to
+// restore. Records are "XY <path>\0", followed by "<orig path>\0" for
+// renames and copies. Untracked and ignored directories are listed once,
+// with a trailing slash.
+func parseStatus(out string) (remove, restore []string) {
+	fields := strings.Split(strings.TrimSuffix(out, "\x00"), "\x00")
+	for i := 0; i < len(fields); i++ {
+		if len(fields[i]) < 4 {
+			continue
+		}
+		xy, path := fields[i][:2], fields[i][3:]
+		if xy == "??" || xy == "!!" {
+			remove = append(remove, path)
+			continue
+		}
+		restore = append(restore, path)
+		if (xy[0] == 'R' || xy[0] == 'C') && i+1 < len(fields) {
+			i++
+			restore = append(restore, fields[i])
+		}
+	}
+	return remove, restore
+}
+
+// refreshIndex brings the stat information in dst's freshly reset index up
+// to date with the cloned files, so git status is fast and shows the
+// uncommitted changes carried over from the source as modified. It returns
+// the number of modified tracked paths.
+func refreshIndex(dst string) (int, error) {
+	if err := runGit("-C", dst, "update-index", "-q", "--refresh"); err != nil {
+		return 0, fmt.Errorf("git update-index: %w", err)
+	}
+	out, err := gitCommand("-C", dst, "diff-files", "--name-only", "-z").Output()
+	if err != nil {
+		return 0, fmt.Errorf("git diff-files: %w", err)
+	}
+	return bytes.Count(out, []byte{0}), nil
+}
+
+// convertedAttrs are the attributes that make a checkout rewrite a file's
+// contents rather than copy the blob verbatim.
+var convertedAttrs = []string{"filter", "working-tree-encoding", "ident", "eol"}
+
+// checkoutConverted checks out again the files in dst whose attributes run
+// them through a filter (git lfs, ...) or a conversion, once dst's index has
+// been reset. Git cannot tell that the cloned copies are what it would have
+// written, so without this git status re-runs the clean filter on each one
+// and may report spurious modifications. Files with uncommitted changes in
+// src are left alone. It returns the number of files checked out.
+func checkoutConverted(src, dst string) (int, error) {
+	if !hasAttributes(dst) {
+		return 0, nil
+	}
+	files, err := gitCommand("-C", dst, "ls-files", "-z").Output()
+	if err != nil {
+		return 0, fmt.Errorf("git ls-files: %w", err)
+	}
+	cmd := gitCommand(append([]string{"-C", dst, "check-attr", "-z", "--stdin"}, convertedAttrs...)...)
+	cmd.Stdin = bytes.NewReader(files)
+	out, err := cmd.Output()
+	if err != nil {
+		return 0, fmt.Errorf("git check-attr: %w", err)
+	}
+
+	// Records are <path>\0<attribute>\0<value>\0, one per path and
+	// attribute, grouped by path.
+	var converted []string
+	fields := strings.Split(strings.TrimSuffix(string(out), "\x00"), "\x00")
+	for i := 0; i+2 < len(fields); i += 3 {
+		path, value := fields[i], fields[i+2]
+		if value == "unspecified" || value == "unset" || len(converted) > 0 && converted[len(converted)-1] == path {
+			continue
+		}
+		converted = append(converted, path)
+	}
+	if len(converted) == 0 {
+		return 0, nil
+	}
+
+	out, err = gitCommand("-C", src, "status", "--porcelain", "-z", "--untracked-files=no").Output()
+	if err != nil {
+		return 0, fmt.Errorf("git status: %w", err)
+	}
+	dirty := make(map[string]bool)
+	for _, record := range strings.Split(string(out), "\x00") {
+		if len(record) > 3 {
+			dirty[record[3:]] = true
+		}
+	}
+	var update bytes.Buffer
+	var n int
+	for _, path := range converted {
+		if !dirty[path] {
+			update.WriteString(path + "\x00")
+			n++
+		}
+	}
+	if n == 0 {
+		return 0, nil
+	}
+
+	cmd = gitCommand("-C", dst, "checkout-index", "--force", "--index", "-z", "--stdin")
+	cmd.Stdin = &update
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		return 0, fmt.Errorf("git checkout-index: %w", err)
+	}
+	return n, nil
+}
+
+// hasAttributes reports whether any gitattributes apply in dst: a tracked
+// .gitattributes file, $GIT_DIR/info/attributes or a global attributes file.
+func hasAttributes(dst string) bool {
+	out, _ := gitCommand("-C", dst, "ls-files", "--", ".gitattributes", "*/.gitattributes").Output()
+	if len(out) > 0 {
+		return true
+	}
+	out, _ = gitCommand("-C", dst, "rev-parse", "--git-path", "info/attributes").Output()
+	if path := strings.TrimSpace(string(out)); path != "" {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dst, path)
+		}
+		if _, err := os.Stat(path); err == nil {
+			return true
+		}
+	}
+	out, _ = gitCommand("-C", dst, "config", "--path", "core.attributesFile").Output()
+	if path := strings.TrimSpace(string(out)); path != "" {
+		_, err := os.Stat(path)
+		return err == nil
+	}
+	config := os.Getenv("XDG_CONFIG_HOME")
+	if config == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return false
+		}
+		config = filepath.Join(home, ".config")
+	}
+	_, err := os.Stat(filepath.Join(config, "git", "attributes"))
+	return err == nil
+}
+
+// checkoutPaths checks out the tracked files under paths in the worktree at
+// dst from its index.
+func checkoutPaths(dst string, paths []string) error {
+	files, err := gitCommand(append([]string{"-C", dst, "ls-files", "-z", "--"}, paths...)...).Output()
+	if err != nil {
+		return fmt.Errorf("git ls-files: %w", err)
+	}
+	cmd := gitCommand("-C", dst, "checkout-index", "--force", "--index", "-z", "--stdin")
+	cmd.Stdin = strings.NewReader(string(files))
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("git checkout-index: %w", err)
+	}
+	return nil
+}
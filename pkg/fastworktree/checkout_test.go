@@ -0,0 +1,154 @@
+package fastworktree
+
+import (
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseNameStatus(t *testing.T) {
+	tests := []struct {
+		out  string
+		want [][2]string
+	}{
+		{"", nil},
+		{"M\x00a.go\x00", [][2]string{{"M", "a.go"}}},
+		{"D\x00dir/b\x00A\x00c d\x00T\x00link\x00", [][2]string{{"D", "dir/b"}, {"A", "c d"}, {"T", "link"}}},
+	}
+	for _, tt := range tests {
+		if got := parseNameStatus(tt.out); !slices.Equal(got, tt.want) {
+			t.Errorf("parseNameStatus(%q) = %q, want %q", tt.out, got, tt.want)
+		}
+	}
+}
+
+func TestParseStatus(t *testing.T) {
+	tests := []struct {
+		out                  string
+		wantRemove, wantRest []string
+	}{
+		{"", nil, nil},
+		{"?? new.txt\x00!! build/\x00", []string{"new.txt", "build/"}, nil},
+		{" M a.go\x00MM b.go\x00 D gone\x00", nil, []string{"a.go", "b.go", "gone"}},
+		// A rename is followed by the path it was renamed from, which
+		// must not be read as a record of its own.
+		{"R  new.go\x00old.go\x00?? x\x00", []string{"x"}, []string{"new.go", "old.go"}},
+		{"C  copy.go\x00orig.go\x00", nil, []string{"copy.go", "orig.go"}},
+	}
+	for _, tt := range tests {
+		remove, restore := parseStatus(tt.out)
+		if !slices.Equal(remove, tt.wantRemove) || !slices.Equal(restore, tt.wantRest) {
+			t.Errorf("parseStatus(%q) = %q, %q, want %q, %q", tt.out, remove, restore, tt.wantRemove, tt.wantRest)
+		}
+	}
+}
+
+// writeFiles writes files, relative paths to contents, below dir.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// commitAll commits everything in the repository at dir.
+func commitAll(t *testing.T, dir, msg string) {
+	t.Helper()
+	runTestGit(t, "-C", dir, "add", "-A")
+	runTestGit(t, "-C", dir, "-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", msg)
+}
+
+// cloneForTest sets up what add leaves before checkoutDelta and
+// cleanCheckout run: a worktree at commitish holding a copy of src's
+// files, with its index reset to its HEAD.
+func cloneForTest(t *testing.T, src, commitish string) string {
+	t.Helper()
+	dst := filepath.Join(filepath.Dir(src), "dst")
+	runTestGit(t, "-C", src, "worktree", "add", "-q", "--no-checkout", "--detach", dst, commitish)
+	err := filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || path == src {
+			return err
+		}
+		if d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		rel, _ := filepath.Rel(src, path)
+		if d.IsDir() {
+			return os.MkdirAll(filepath.Join(dst, rel), 0o755)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(filepath.Join(dst, rel), data, 0o644)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	runTestGit(t, "-C", dst, "reset", "-q")
+	return dst
+}
+
+// gitStatus returns git status --porcelain --ignored in dir.
+func gitStatus(t *testing.T, dir string) string {
+	t.Helper()
+	out, err := exec.Command("git", "-C", dir, "status", "--porcelain", "--ignored").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func TestCheckoutDelta(t *testing.T) {
+	src := newTestRepo(t)
+	writeFiles(t, src, map[string]string{"a.txt": "1", "gone.txt": "x", "dir/kept.txt": "k"})
+	commitAll(t, src, "first")
+	runTestGit(t, "-C", src, "rm", "-q", "gone.txt")
+	writeFiles(t, src, map[string]string{"a.txt": "2", "new/file.txt": "n"})
+	commitAll(t, src, "second")
+
+	// The clone is of the second commit; the worktree is at the first.
+	dst := cloneForTest(t, src, "HEAD~")
+	n, err := checkoutDelta(src, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Errorf("checkoutDelta updated %d paths, want 3", n)
+	}
+	if status := gitStatus(t, dst); status != "" {
+		t.Errorf("git status after checkoutDelta:\n%s", status)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "new")); !os.IsNotExist(err) {
+		t.Errorf("directory emptied by checkoutDelta was left behind")
+	}
+}
+
+func TestCleanCheckout(t *testing.T) {
+	src := newTestRepo(t)
+	writeFiles(t, src, map[string]string{"a.txt": "1", "b.txt": "b", ".gitignore": "*.log\n"})
+	commitAll(t, src, "first")
+	writeFiles(t, src, map[string]string{"a.txt": "changed", "untracked.txt": "u", "build/out.log": "l"})
+	runTestGit(t, "-C", src, "mv", "b.txt", "renamed.txt")
+
+	dst := cloneForTest(t, src, "HEAD")
+	if _, err := cleanCheckout(src, dst); err != nil {
+		t.Fatal(err)
+	}
+	if status := gitStatus(t, dst); status != "" {
+		t.Errorf("git status after cleanCheckout:\n%s", status)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dst, "a.txt")); string(data) != "1" {
+		t.Errorf("a.txt = %q after cleanCheckout, want it restored to %q", data, "1")
+	}
+}
@@ -0,0 +1,102 @@
+package fastworktree
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	cleanPatterns []string
+	cleanDryRun   bool
+)
+
+var cleanCmd = &cobra.Command{
+	Use:   "clean --pattern <glob> [flags]",
+	Short: "Remove the worktrees whose branch or directory matches a pattern",
+	Long: "Removes every worktree created by this tool whose branch or directory name\n" +
+		"matches a --pattern glob, as long as it holds no work: no uncommitted changes,\n" +
+		"and no commits that are neither pushed nor in the default branch. Locked\n" +
+		"worktrees and the current one are skipped too, and a summary says which were\n" +
+		"skipped and why.",
+	Example: "  git-fast-worktree clean --pattern 'review-*' --dry-run",
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(cleanPatterns) == 0 {
+			return fmt.Errorf("fatal: clean needs a --pattern")
+		}
+		for _, pattern := range cleanPatterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("fatal: invalid --pattern '%s': %w", pattern, err)
+			}
+		}
+		managed, err := managedWorktrees()
+		if err != nil {
+			return fmt.Errorf("fatal: %w", err)
+		}
+		current, _ := gitToplevel()
+		base := defaultBase()
+
+		verb := "removed"
+		if cleanDryRun {
+			verb = "would remove"
+		}
+		var removed int
+		var skipped [][2]string
+		for _, e := range managed {
+			if isPooled(e.Path) || !matchesAny(cleanPatterns, e.Branch, filepath.Base(e.Path)) {
+				continue
+			}
+			var reason string
+			switch {
+			case e.Locked:
+				reason = "locked"
+			case current != "" && realPath(e.Path) == realPath(current):
+				reason = "the current worktree"
+			default:
+				reason = unfinishedWork(e, base, false)
+			}
+			if reason != "" {
+				skipped = append(skipped, [2]string{e.Path, reason})
+				continue
+			}
+			if !cleanDryRun {
+				start := time.Now()
+				if err := removeWorktree(e.Path, e.gitdir); err != nil {
+					skipped = append(skipped, [2]string{e.Path, err.Error()})
+					continue
+				}
+				recordHistory(historyEntry{Op: "clean", Path: e.Path, Branch: e.Branch}, start)
+			}
+			removed++
+			console.infof("%s: %s", verb, e.Path)
+		}
+
+		console.infof("%s %d worktrees, skipped %d", verb, removed, len(skipped))
+		for _, s := range skipped {
+			console.infof("  skipped: %s (%s)", s[0], s[1])
+		}
+		return nil
+	},
+}
+
+// matchesAny reports whether any of names, skipping empty ones, matches one
+// of patterns.
+func matchesAny(patterns []string, names ...string) bool {
+	for _, pattern := range patterns {
+		for _, name := range names {
+			if ok, _ := path.Match(pattern, name); ok && name != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func init() {
+	cleanCmd.Flags().StringArrayVar(&cleanPatterns, "pattern", nil, "remove worktrees whose branch or directory name matches this glob, e.g. 'review-*'; may be repeated")
+	cleanCmd.Flags().BoolVarP(&cleanDryRun, "dry-run", "n", false, "only report what would be removed")
+}
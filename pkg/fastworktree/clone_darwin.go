@@ -0,0 +1,51 @@
+//go:build darwin
+
+package fastworktree
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+var cloners = []Cloner{clonefileCloner{}}
+
+// cloneACL is CLONE_ACL from <sys/clonefile.h>, which x/sys/unix does not
+// define.
+const cloneACL = 0x0004
+
+// clonefileCloner clones with clonefile(2). APFS clones directories
+// recursively, so top-level entries never need to be walked.
+type clonefileCloner struct{}
+
+func (clonefileCloner) Name() string      { return "clonefile" }
+func (clonefileCloner) SupportsDir() bool { return true }
+
+// Clone clones src to dst with clonefile(2). If that fails (EPERM on a
+// protected file, an xattr APFS refuses, ...) the entry is retried with
+// copyfile(3), so one bad file does not leave a whole directory missing.
+func (clonefileCloner) Clone(src, dst string) error {
+	flags := unix.CLONE_NOFOLLOW
+	if cloneACLs {
+		flags |= cloneACL
+	}
+	err := unix.Clonefile(src, dst, flags)
+	if err == nil {
+		return nil
+	}
+	if cerr := copyfileCloneTree(src, dst); cerr != nil {
+		return fmt.Errorf("clonefile: %w; copyfile: %w", err, cerr)
+	}
+	return nil
+}
+
+func (clonefileCloner) Probe(volume string) error {
+	var st unix.Statfs_t
+	if err := unix.Statfs(volume, &st); err != nil {
+		return err
+	}
+	if fstype := unix.ByteSliceToString(st.Fstypename[:]); fstype != "apfs" {
+		return fmt.Errorf("%s is on %s, not APFS", volume, fstype)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+//go:build freebsd
+
+package fastworktree
+
+import (
+	"io"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// sysCopyFileRange is copy_file_range(2), added in FreeBSD 13.
+const sysCopyFileRange = 569
+
+// On FreeBSD only ZFS can share blocks between files.
+var cloners = []Cloner{zfsCloner{}}
+
+// zfsDataset returns the ZFS dataset backing path, which FreeBSD reports
+// directly as the mount source.
+func zfsDataset(path string) (string, bool) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return "", false
+	}
+	if unix.ByteSliceToString(st.Fstypename[:]) != "zfs" {
+		return "", false
+	}
+	return unix.ByteSliceToString(st.Mntfromname[:]), true
+}
+
+// copyFileRange copies size bytes from in to out with copy_file_range,
+// falling back to a plain read/write copy on kernels that lack it.
+func copyFileRange(out, in *os.File, size int64) error {
+	for size > 0 {
+		n, _, errno := syscall.Syscall6(sysCopyFileRange, in.Fd(), 0, out.Fd(), 0, uintptr(min(size, 1<<30)), 0)
+		if errno != 0 {
+			if errno == syscall.ENOSYS || errno == syscall.EXDEV {
+				_, err := io.Copy(out, in)
+				return err
+			}
+			return errno
+		}
+		if n == 0 {
+			break
+		}
+		size -= int64(n)
+	}
+	return nil
+}
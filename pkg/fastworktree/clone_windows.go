@@ -0,0 +1,146 @@
+//go:build windows
+
+package fastworktree
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// fileSupportsBlockRefcounting is the FILE_SUPPORTS_BLOCK_REFCOUNTING volume
+// flag, set on ReFS and Dev Drive volumes that can duplicate extents.
+const fileSupportsBlockRefcounting = 0x08000000
+
+// maxDuplicateChunk bounds a single FSCTL_DUPLICATE_EXTENTS_TO_FILE request,
+// which must stay below 4GiB.
+const maxDuplicateChunk = 1 << 31
+
+type duplicateExtentsData struct {
+	FileHandle       windows.Handle
+	SourceFileOffset int64
+	TargetFileOffset int64
+	ByteCount        int64
+}
+
+type integrityInformation struct {
+	ChecksumAlgorithm        uint16
+	Reserved                 uint16
+	Flags                    uint32
+	ChecksumChunkSizeInBytes uint32
+	ClusterSizeInBytes       uint32
+}
+
+// blockCloneVolumes caches supportsBlockClone results by volume path.
+var blockCloneVolumes sync.Map
+
+var cloners = []Cloner{blockCloner{}}
+
+// blockCloner duplicates each file's extents with
+// FSCTL_DUPLICATE_EXTENTS_TO_FILE. Windows has no directory-level clone, so
+// the tree is always walked.
+type blockCloner struct{}
+
+func (blockCloner) Name() string      { return "block-clone" }
+func (blockCloner) SupportsDir() bool { return false }
+
+func (blockCloner) Probe(volume string) error {
+	if !supportsBlockClone(volume) {
+		return fmt.Errorf("%s is not on a volume that supports block cloning (ReFS, Dev Drive)", volume)
+	}
+	return nil
+}
+
+// Clone duplicates the extents of src into a new file at dst. The target
+// must already be the right size, match the source's sparseness and
+// integrity settings, and the requests must be cluster aligned.
+func (blockCloner) Clone(src, dst string) error {
+	in, out, info, err := openPair(src, dst, os.O_RDWR)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	if err := duplicateExtents(out, in, info); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// supportsBlockClone reports whether the volume containing path advertises
+// block refcounting, i.e. is ReFS or a Dev Drive.
+func supportsBlockClone(path string) bool {
+	root, err := volumeRoot(path)
+	if err != nil {
+		return false
+	}
+	volume := windows.UTF16PtrToString(root)
+	if v, ok := blockCloneVolumes.Load(volume); ok {
+		return v.(bool)
+	}
+
+	var flags uint32
+	err = windows.GetVolumeInformation(root, nil, 0, nil, nil, &flags, nil, 0)
+	ok := err == nil && flags&fileSupportsBlockRefcounting != 0
+	blockCloneVolumes.Store(volume, ok)
+	return ok
+}
+
+func duplicateExtents(out, in *os.File, info fs.FileInfo) error {
+	srcHandle := windows.Handle(in.Fd())
+	dstHandle := windows.Handle(out.Fd())
+	var n uint32
+
+	var integrity integrityInformation
+	if err := windows.DeviceIoControl(srcHandle, windows.FSCTL_GET_INTEGRITY_INFORMATION, nil, 0,
+		(*byte)(unsafe.Pointer(&integrity)), uint32(unsafe.Sizeof(integrity)), &n, nil); err != nil {
+		return err
+	}
+
+	if attrs, ok := info.Sys().(*syscall.Win32FileAttributeData); ok && attrs.FileAttributes&windows.FILE_ATTRIBUTE_SPARSE_FILE != 0 {
+		if err := windows.DeviceIoControl(dstHandle, windows.FSCTL_SET_SPARSE, nil, 0, nil, 0, &n, nil); err != nil {
+			return err
+		}
+	}
+	if integrity.ChecksumAlgorithm != 0 {
+		set := struct {
+			ChecksumAlgorithm uint16
+			Reserved          uint16
+			Flags             uint32
+		}{integrity.ChecksumAlgorithm, 0, integrity.Flags}
+		if err := windows.DeviceIoControl(dstHandle, windows.FSCTL_SET_INTEGRITY_INFORMATION,
+			(*byte)(unsafe.Pointer(&set)), uint32(unsafe.Sizeof(set)), nil, 0, &n, nil); err != nil {
+			return err
+		}
+	}
+
+	size := info.Size()
+	if err := out.Truncate(size); err != nil {
+		return err
+	}
+
+	cluster := int64(integrity.ClusterSizeInBytes)
+	if cluster == 0 {
+		cluster = 4096
+	}
+	aligned := (size + cluster - 1) &^ (cluster - 1)
+	for offset := int64(0); offset < aligned; offset += maxDuplicateChunk {
+		data := duplicateExtentsData{
+			FileHandle:       srcHandle,
+			SourceFileOffset: offset,
+			TargetFileOffset: offset,
+			ByteCount:        min(aligned-offset, maxDuplicateChunk),
+		}
+		if err := windows.DeviceIoControl(dstHandle, windows.FSCTL_DUPLICATE_EXTENTS_TO_FILE,
+			(*byte)(unsafe.Pointer(&data)), uint32(unsafe.Sizeof(data)), nil, 0, &n, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
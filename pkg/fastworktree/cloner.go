@@ -0,0 +1,142 @@
+package fastworktree
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Cloner is a copy-on-write backend used to populate a new worktree from the
+// source working tree.
+type Cloner interface {
+	// Name identifies the backend in output.
+	Name() string
+	// Clone clones src to dst. Backends that do not support directories are
+	// only ever given regular files; the caller recreates the tree around them.
+	Clone(src, dst string) error
+	// SupportsDir reports whether Clone can clone a whole directory tree in
+	// a single call.
+	SupportsDir() bool
+	// Probe returns an error describing why the backend cannot clone files
+	// on the volume containing path, or nil if it can.
+	Probe(volume string) error
+}
+
+// preparer is implemented by backends that need setting up against the
+// source before cloning. Prepare returns the Cloner to clone with, which
+// carries the setup, and a cleanup func that undoes it once the clone phase
+// is over.
+type preparer interface {
+	Prepare(src string) (prepared Cloner, cleanup func(), err error)
+}
+
+// sourceMapper is implemented by backends that clone from somewhere other
+// than the live source, so that a fallback copy reads from there too.
+type sourceMapper interface {
+	sourcePath(src string) string
+}
+
+// explicitCloners are backends that are never auto-selected and are only
+// used when named with --backend.
+var explicitCloners []Cloner
+
+// probeCache, while set, keeps chooseCloner's answers for the daemon, which
+// would otherwise probe the same volumes for every worktree it creates.
+var probeCache *sync.Map
+
+// probed is a cached answer of chooseCloner.
+type probed struct {
+	cloner Cloner
+	err    error
+}
+
+// chooseCloner resolves the --backend flag: "auto" picks the best backend
+// for the volumes involved, anything else names a backend explicitly.
+// Options.Cloner takes precedence over either.
+func chooseCloner(name, src, dst string) (c Cloner, err error) {
+	if clonerOverride != nil {
+		return clonerOverride, nil
+	}
+	if probeCache != nil {
+		key := [3]string{name, src, dst}
+		if p, ok := probeCache.Load(key); ok {
+			return p.(probed).cloner, p.(probed).err
+		}
+		defer func() { probeCache.Store(key, probed{c, err}) }()
+	}
+	if name == "auto" {
+		return selectCloner(src, dst)
+	}
+
+	var names []string
+	for _, c := range slices.Concat(cloners, explicitCloners, []Cloner{copyCloner{}, hardlinkCloner{}}) {
+		if c.Name() != name {
+			names = append(names, c.Name())
+			continue
+		}
+		if err := c.Probe(src); err != nil {
+			return nil, err
+		}
+		if err := c.Probe(dst); err != nil {
+			return nil, err
+		}
+		return c, nil
+	}
+	return nil, fmt.Errorf("unknown backend '%s' (expected auto, %s)", name, strings.Join(names, ", "))
+}
+
+// selectCloner returns the first backend for this platform that can clone
+// on both the source and destination volumes.
+func selectCloner(src, dst string) (Cloner, error) {
+	// Network and legacy filesystems, and pairs of different volumes, rule
+	// out every backend, so there is no point probing them individually.
+	for _, path := range []string{src, dst} {
+		if err := checkVolume(path); err != nil {
+			return nil, err
+		}
+	}
+	if same, err := sameVolume(src, dst); err == nil && !same {
+		return nil, fmt.Errorf("destination %s is on a different volume from %s; copy-on-write clones cannot cross volumes\n"+
+			"hint: create the worktree on the same volume, e.g. next to the repository", dst, src)
+	}
+
+	var reasons []string
+	for _, c := range cloners {
+		err := c.Probe(src)
+		if err == nil {
+			err = c.Probe(dst)
+		}
+		if err == nil {
+			return c, nil
+		}
+		reasons = append(reasons, fmt.Sprintf("  %s: %v", c.Name(), err))
+	}
+	return nil, fmt.Errorf("no copy-on-write backend can clone %s to %s\n%s", src, dst, strings.Join(reasons, "\n"))
+}
+
+// cloneWith clones src to dst with c, walking the tree itself when the
+// backend can only clone individual files.
+func cloneWith(c Cloner, src, dst string) error {
+	if c.SupportsDir() {
+		return c.Clone(src, dst)
+	}
+	return cloneTree(src, dst, c.Clone)
+}
+
+// existingAncestor returns the closest ancestor of path that exists, which
+// is what gets probed for a destination that has not been created yet.
+func existingAncestor(path string) string {
+	for {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return path
+		}
+		path = parent
+	}
+}
@@ -0,0 +1,161 @@
+package fastworktree
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+)
+
+// fakeCloner is a backend for tests: it probes as told and copies the
+// files it is asked to clone, recording them.
+type fakeCloner struct {
+	name  string
+	probe error
+
+	mu     sync.Mutex
+	cloned []string
+}
+
+func (c *fakeCloner) Name() string              { return c.name }
+func (c *fakeCloner) SupportsDir() bool         { return false }
+func (c *fakeCloner) Probe(volume string) error { return c.probe }
+
+func (c *fakeCloner) Clone(src, dst string) error {
+	c.mu.Lock()
+	c.cloned = append(c.cloned, filepath.Base(src))
+	c.mu.Unlock()
+	return copyCloner{}.Clone(src, dst)
+}
+
+// snapshotFake stands in for a backend that clones from a snapshot but
+// cannot clone off it, as clonefile may not across mounts.
+type snapshotFake struct {
+	fakeCloner
+	live, snapshot string
+}
+
+func (c *snapshotFake) Clone(src, dst string) error { return syscall.EXDEV }
+
+func (c *snapshotFake) sourcePath(src string) string {
+	rel, _ := filepath.Rel(c.live, src)
+	return filepath.Join(c.snapshot, rel)
+}
+
+// withCloners makes cs the platform's backends for the rest of the test.
+func withCloners(t *testing.T, cs ...Cloner) {
+	saved := cloners
+	t.Cleanup(func() { cloners = saved })
+	cloners = cs
+}
+
+func TestSelectCloner(t *testing.T) {
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+	unsupported := &fakeCloner{name: "unsupported", probe: errors.New("not here")}
+	supported := &fakeCloner{name: "supported"}
+	second := &fakeCloner{name: "second"}
+
+	withCloners(t, unsupported, supported, second)
+	c, err := selectCloner(src, dst)
+	if err != nil || c != supported {
+		t.Errorf("selectCloner() = %v, %v, want the first backend whose probe passes", c, err)
+	}
+
+	withCloners(t, unsupported)
+	_, err = selectCloner(src, dst)
+	if err == nil || !strings.Contains(err.Error(), "unsupported: not here") {
+		t.Errorf("selectCloner() with no usable backend = %v, want each backend's reason", err)
+	}
+}
+
+func TestChooseCloner(t *testing.T) {
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+	unsupported := &fakeCloner{name: "unsupported", probe: errors.New("not here")}
+	supported := &fakeCloner{name: "supported"}
+	withCloners(t, unsupported, supported)
+
+	tests := []struct {
+		backend string
+		want    string // the backend's name, or a substring of the error
+	}{
+		{"auto", "supported"},
+		{"supported", "supported"},
+		{"copy", "copy"},
+		{"hardlink", "hardlink"},
+		{"unsupported", "not here"},
+		{"nonsense", "unknown backend 'nonsense'"},
+	}
+	for _, tt := range tests {
+		c, err := chooseCloner(tt.backend, src, dst)
+		switch {
+		case err != nil && !strings.Contains(err.Error(), tt.want):
+			t.Errorf("chooseCloner(%s) = %v, want %s", tt.backend, err, tt.want)
+		case err == nil && c.Name() != tt.want:
+			t.Errorf("chooseCloner(%s) = %s, want %s", tt.backend, c.Name(), tt.want)
+		}
+	}
+
+	// Options.Cloner wins over --backend.
+	override := &fakeCloner{name: "override"}
+	clonerOverride = override
+	t.Cleanup(func() { clonerOverride = nil })
+	if c, err := chooseCloner("nonsense", src, dst); err != nil || c != override {
+		t.Errorf("chooseCloner() with an override = %v, %v, want the override", c, err)
+	}
+}
+
+func TestAddWithCloner(t *testing.T) {
+	repo := newTestRepo(t)
+	writeFiles(t, repo, map[string]string{"tracked.txt": "t", ".gitignore": "ignored/\n"})
+	commitAll(t, repo, "files")
+	writeFiles(t, repo, map[string]string{"ignored/dep.txt": "d", "untracked.txt": "u"})
+
+	c := &fakeCloner{name: "fake"}
+	dst := filepath.Join(filepath.Dir(repo), "wt")
+	var log bytes.Buffer
+	result, err := Add(context.Background(), Options{Repo: repo, Path: dst, Cloner: c, Logger: slog.New(slog.NewTextHandler(&log, nil))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Backend != "fake" {
+		t.Errorf("Add() backend = %s, want fake", result.Backend)
+	}
+	for _, name := range []string{"tracked.txt", "dep.txt", "untracked.txt"} {
+		if !strings.Contains(strings.Join(c.cloned, " "), name) {
+			t.Errorf("%s was not cloned with the Cloner (cloned %v)", name, c.cloned)
+		}
+	}
+	if data, err := os.ReadFile(filepath.Join(dst, "ignored", "dep.txt")); err != nil || string(data) != "d" {
+		t.Errorf("ignored/dep.txt in the new worktree = %q, %v", data, err)
+	}
+	if status := gitStatus(t, dst); status != "?? untracked.txt\n!! ignored/" {
+		t.Errorf("git status in the new worktree:\n%s", status)
+	}
+	if !strings.Contains(log.String(), "dst="+dst) {
+		t.Errorf("Options.Logger got no messages about the worktree:\n%s", log.String())
+	}
+}
+
+func TestCloneEntryFallbackFromSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	live, snapshot := filepath.Join(dir, "live"), filepath.Join(dir, "snapshot")
+	writeFiles(t, live, map[string]string{"f.txt": "rewritten"})
+	writeFiles(t, snapshot, map[string]string{"f.txt": "snapshotted"})
+	c := &snapshotFake{fakeCloner: fakeCloner{name: "snapshot"}, live: live, snapshot: snapshot}
+
+	dst := filepath.Join(dir, "dst.txt")
+	if err := cloneEntry(countingCloner{c, nil}, filepath.Join(live, "f.txt"), dst, logger{}); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(dst); err != nil || string(data) != "snapshotted" {
+		t.Errorf("fallback copy = %q, %v, want the snapshot's copy", data, err)
+	}
+}
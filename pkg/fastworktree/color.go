@@ -0,0 +1,43 @@
+package fastworktree
+
+import (
+	"os"
+	"regexp"
+)
+
+// noColor turns colors off even on a terminal.
+var noColor bool
+
+const (
+	colorRed    = "\033[31m"
+	colorYellow = "\033[33m"
+	colorBold   = "\033[1m"
+	colorDim    = "\033[2m"
+	colorReset  = "\033[0m"
+)
+
+// timing matches a duration in parentheses, as infof lines end with.
+var timing = regexp.MustCompile(`\((\d+h)?(\d+m)?[\d.]+(ns|µs|ms|s)\)`)
+
+// useColor reports whether output to f should be colored: it is a
+// terminal, and neither --no-color nor NO_COLOR (https://no-color.org) is
+// set.
+func useColor(f *os.File) bool {
+	return !noColor && os.Getenv("NO_COLOR") == "" && os.Getenv("TERM") != "dumb" && isTerminal(f)
+}
+
+// colorize wraps s in color if output to f is colored.
+func colorize(f *os.File, color, s string) string {
+	if !useColor(f) {
+		return s
+	}
+	return color + s + colorReset
+}
+
+// dimTimings dims the durations in a line of progress on stderr.
+func dimTimings(s string) string {
+	if !useColor(os.Stderr) {
+		return s
+	}
+	return timing.ReplaceAllString(s, colorDim+"$0"+colorReset)
+}
@@ -0,0 +1,130 @@
+package fastworktree
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// Dynamic shell completion. cobra provides the completion command that
+// generates the scripts; these complete the arguments that name branches
+// and worktrees, and the flags that take one of a few values.
+
+// completeWorktrees completes the paths of the repository's linked
+// worktrees, relative to the current directory unless an absolute path is
+// being typed.
+func completeWorktrees(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	entries, err := listWorktrees(".")
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	cwd, _ := os.Getwd()
+	var paths []string
+	for _, e := range entries[1:] {
+		path := e.Path
+		if rel, err := filepath.Rel(cwd, path); err == nil && !filepath.IsAbs(toComplete) {
+			path = rel
+		}
+		paths = append(paths, path)
+	}
+	return paths, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeRefs completes local and remote branch and tag names.
+func completeRefs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	out, err := gitCommand("for-each-ref", "--format=%(refname:short)", "refs/heads", "refs/remotes", "refs/tags").Output()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	refs := strings.Fields(string(out))
+	return slices.DeleteFunc(refs, func(ref string) bool { return strings.HasSuffix(ref, "/HEAD") }), cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeBranches completes local branch names.
+func completeBranches(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	out, err := gitCommand("for-each-ref", "--format=%(refname:short)", "refs/heads").Output()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return strings.Fields(string(out)), cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeAddArgs completes add's <path> as a file name and its
+// <commit-ish> as a ref.
+func completeAddArgs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	switch len(args) {
+	case 0:
+		return nil, cobra.ShellCompDirectiveFilterDirs
+	case 1:
+		return completeRefs(cmd, args, toComplete)
+	}
+	return nil, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeFirstWorktree completes the <worktree> argument of commands that
+// take one, and nothing after it.
+func completeFirstWorktree(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveFilterDirs
+	}
+	return completeWorktrees(cmd, args, toComplete)
+}
+
+// completeProfiles completes the profile names defined in the config.
+func completeProfiles(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	var names []string
+	for key := range cfg {
+		rest, ok := strings.CutPrefix(strings.TrimPrefix(key, gitKeyPrefix), "profile.")
+		if name, _, _ := strings.Cut(rest, "."); ok && !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeBackends completes --backend with the backends built for this
+// platform.
+func completeBackends(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	names := []string{"auto"}
+	for _, c := range slices.Concat(cloners, explicitCloners, []Cloner{copyCloner{}, hardlinkCloner{}}) {
+		names = append(names, c.Name())
+	}
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
+
+func init() {
+	addCmd.ValidArgsFunction = completeAddArgs
+	for _, cmd := range []*cobra.Command{removeCmd, moveCmd, lockCmd, unlockCmd, verifyCmd, infoCmd, adoptCmd} {
+		cmd.ValidArgsFunction = completeFirstWorktree
+	}
+	withCmd.ValidArgsFunction = func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) == 0 {
+			return completeRefs(cmd, args, toComplete)
+		}
+		return nil, cobra.ShellCompDirectiveDefault
+	}
+	addCmd.RegisterFlagCompletionFunc("backend", completeBackends)
+	addCmd.RegisterFlagCompletionFunc("fallback", cobra.FixedCompletions([]string{"copy", "hardlink", "error"}, cobra.ShellCompDirectiveNoFileComp))
+	addCmd.RegisterFlagCompletionFunc("default-branch", cobra.FixedCompletions([]string{"detach", "checkout", "create"}, cobra.ShellCompDirectiveNoFileComp))
+	addCmd.RegisterFlagCompletionFunc("fsmonitor", cobra.FixedCompletions([]string{"off", "builtin", "watchman"}, cobra.ShellCompDirectiveNoFileComp))
+	addCmd.RegisterFlagCompletionFunc("nested-repos", cobra.FixedCompletions([]string{"warn", "skip", "strip", "clone"}, cobra.ShellCompDirectiveNoFileComp))
+	addCmd.RegisterFlagCompletionFunc("progress", cobra.FixedCompletions([]string{"human", "ndjson"}, cobra.ShellCompDirectiveNoFileComp))
+	addCmd.RegisterFlagCompletionFunc("from", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		paths, directive := completeWorktrees(cmd, args, toComplete)
+		return append([]string{"main"}, paths...), directive
+	})
+	addCmd.RegisterFlagCompletionFunc("open", cobra.FixedCompletions([]string{"code", "cursor", "idea", "zed", "subl", "vim"}, cobra.ShellCompDirectiveNoFileComp))
+	addCmd.RegisterFlagCompletionFunc("force-branch", completeBranches)
+	addCmd.RegisterFlagCompletionFunc("fetch", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		out, _ := gitCommand("remote").Output()
+		return strings.Fields(string(out)), cobra.ShellCompDirectiveNoFileComp
+	})
+}
@@ -0,0 +1,355 @@
+package fastworktree
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// repoConfigFile is the name of the per-repository config file, at the
+// top of the worktree.
+const repoConfigFile = ".git-fast-worktree.toml"
+
+// repoConfigKeys are the flags the repository's config file may set
+// without --trust-repo-config. It is committed to the repository, so
+// anyone who can push to it writes it: flags that run commands, such as
+// post-create, open, issue-command and trust, that set git config, as
+// wt-config does, or that choose where on disk worktrees are written, as
+// root and path-template do, are only taken from it once the user trusts
+// it.
+var repoConfigKeys = map[string]bool{
+	"backend":              true,
+	"code-workspace":       true,
+	"copy":                 true,
+	"default-branch":       true,
+	"editor-settings":      true,
+	"exclude":              true,
+	"exclude-spotlight":    true,
+	"exclude-time-machine": true,
+	"extra-files":          true,
+	"fallback":             true,
+	"follow-symlinks":      true,
+	"include-only":         true,
+	"issue-template":       true,
+	"jobs":                 true,
+	"sparse":               true,
+}
+
+// trustRepoConfig lets the repository's config file set any flag.
+var trustRepoConfig bool
+
+// untrustedKeyPrefix marks the keys of the repository's config file that
+// were left out because it is not trusted, so checkConfig can say so.
+const untrustedKeyPrefix = "untrusted:"
+
+// configValue is a value from a config file, with where it came from for
+// error messages.
+type configValue struct {
+	values []string // one, or the elements of an array
+	source string
+}
+
+// profile names the config table of flag values to use, as with
+// --profile review.
+var profile string
+
+// config maps "<command>.<flag>" to its value, where <command> is the
+// command's path below the root with spaces replaced by dots ("add",
+// "pool.fill"), "profile.<name>" for a profile's keys, or "" for keys
+// outside any table, which apply to every command with that flag. Keys
+// from git config are kept apart under gitKeyPrefix, with the flag named as
+// git does (see gitName).
+type config map[string]configValue
+
+// gitKeyPrefix marks the keys of a config that came from git config.
+const gitKeyPrefix = "git:"
+
+// gitName is a flag's name as a git config variable: git ignores case in
+// variable names and does not allow dashes in the ones we document, so
+// --default-branch is fastworktree.defaultBranch.
+func gitName(flag string) string {
+	return strings.ToLower(strings.ReplaceAll(flag, "-", ""))
+}
+
+// globalConfigPath returns the path of the user's config file,
+// $XDG_CONFIG_HOME/git-fast-worktree/config.toml.
+func globalConfigPath() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "git-fast-worktree", "config.toml")
+}
+
+// loadConfig reads the fastworktree.* git config keys, the global config
+// file and then the repository's, whose keys override the global ones.
+// Unless it is trusted, only the repoConfigKeys of the repository's file
+// are kept. Missing files are skipped.
+func loadConfig() (config, error) {
+	cfg := config{}
+	loadGitConfig(cfg)
+	if err := readConfigFile(cfg, globalConfigPath()); err != nil {
+		return nil, err
+	}
+	top, err := gitToplevel()
+	if err != nil {
+		return cfg, nil
+	}
+	repo := config{}
+	if err := readConfigFile(repo, filepath.Join(top, repoConfigFile)); err != nil {
+		return nil, err
+	}
+	trusted := trustRepoConfig || configTrue(cfg, ".trust-repo-config") || configTrue(cfg, gitKeyPrefix+".trustrepoconfig")
+	for key, v := range repo {
+		if !trusted && !repoConfigKeys[key[strings.LastIndexByte(key, '.')+1:]] {
+			key = untrustedKeyPrefix + key
+		}
+		cfg[key] = v
+	}
+	return cfg, nil
+}
+
+// readConfigFile parses the config file at path into cfg, if there is one.
+func readConfigFile(cfg config, path string) error {
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("fatal: reading config: %w", err)
+	}
+	return parseConfig(cfg, path, string(data))
+}
+
+// configTrue reports whether key is set to true in cfg, as git config or
+// a config file would write it.
+func configTrue(cfg config, key string) bool {
+	v, ok := cfg[key]
+	return ok && len(v.values) > 0 && gitBool(v.values[len(v.values)-1]) == "true"
+}
+
+// loadGitConfig adds the fastworktree.* keys of git config to cfg:
+// fastworktree.<flag> for every command and fastworktree.<command>.<flag>,
+// or "fastworktree.pool fill.<flag>" as git writes subsections, for one.
+// A key given more than once, as in both the global and the repository's
+// config, sets the flag once for each.
+func loadGitConfig(cfg config) {
+	out, err := gitCommand("config", "-z", "--get-regexp", `^fastworktree\.`).Output()
+	if err != nil {
+		return // no keys, or not even git config to read
+	}
+	for _, entry := range strings.Split(strings.TrimSuffix(string(out), "\x00"), "\x00") {
+		name, value, ok := strings.Cut(entry, "\n")
+		if !ok {
+			value = "true" // a bare key is a true boolean in git config
+		}
+		name = strings.TrimPrefix(name, "fastworktree.")
+		table, flag := "", name
+		if i := strings.LastIndexByte(name, '.'); i >= 0 {
+			table, flag = strings.ReplaceAll(name[:i], " ", "."), name[i+1:]
+		}
+		key := gitKeyPrefix + table + "." + flag
+		v := cfg[key]
+		v.values = append(v.values, value)
+		v.source = "git config fastworktree." + name
+		cfg[key] = v
+	}
+}
+
+// gitBool maps the booleans git config accepts beyond true and false to
+// ones a flag does.
+func gitBool(value string) string {
+	switch strings.ToLower(value) {
+	case "yes", "on":
+		return "true"
+	case "no", "off", "":
+		return "false"
+	}
+	return value
+}
+
+// applyConfig sets each flag of cmd that was not given on the command line
+// to its value from cfg. The --profile table wins over the rest, then a key
+// in cmd's own table over one outside any table, and config files over git
+// config.
+func applyConfig(cmd *cobra.Command, cfg config) error {
+	table := strings.ReplaceAll(strings.TrimPrefix(cmd.CommandPath(), cmd.Root().Name()+" "), " ", ".")
+	if cmd == cmd.Root() {
+		table = ""
+	}
+	var errs []string
+	apply := func(f *pflag.Flag) {
+		if f.Changed {
+			return
+		}
+		var keys []string
+		if profile != "" {
+			keys = append(keys, "profile."+profile+"."+f.Name, gitKeyPrefix+"profile."+profile+"."+gitName(f.Name))
+		}
+		keys = append(keys,
+			table+"."+f.Name,
+			"."+f.Name,
+			gitKeyPrefix+table+"."+gitName(f.Name),
+			gitKeyPrefix+"."+gitName(f.Name),
+		)
+		var v configValue
+		var ok bool
+		for _, key := range keys {
+			if v, ok = cfg[key]; ok {
+				break
+			}
+		}
+		if !ok {
+			return
+		}
+		for _, value := range v.values {
+			if f.Value.Type() == "bool" && strings.HasPrefix(v.source, "git config") {
+				value = gitBool(value)
+			}
+			if err := f.Value.Set(value); err != nil {
+				errs = append(errs, fmt.Sprintf("%s: invalid %s '%s': %v", v.source, f.Name, value, err))
+				return
+			}
+		}
+		f.Changed = true
+	}
+
+	// The profile can itself come from config, and picks the other values.
+	if f := cmd.Flags().Lookup("profile"); f != nil {
+		apply(f)
+	}
+	if profile != "" && !hasProfile(cfg, profile) {
+		return fmt.Errorf("fatal: no profile '%s' in the config (expected a [profile.%s] table)", profile, profile)
+	}
+	cmd.Flags().VisitAll(apply)
+	if len(errs) > 0 {
+		return fmt.Errorf("fatal: %s", strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+// hasProfile reports whether cfg defines any key of the named profile.
+func hasProfile(cfg config, name string) bool {
+	for key := range cfg {
+		if strings.HasPrefix(strings.TrimPrefix(key, gitKeyPrefix), "profile."+name+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// checkConfig warns about keys in cfg that no command has a flag for, such
+// as misspellings.
+func checkConfig(root *cobra.Command, cfg config) {
+	known := map[string]bool{}
+	var visit func(cmd *cobra.Command)
+	visit = func(cmd *cobra.Command) {
+		table := strings.ReplaceAll(strings.TrimPrefix(cmd.CommandPath(), root.Name()+" "), " ", ".")
+		flags := func(f *pflag.Flag) {
+			known["."+f.Name] = true
+			known[gitKeyPrefix+"."+gitName(f.Name)] = true
+			if cmd != root {
+				known[table+"."+f.Name] = true
+				known[gitKeyPrefix+table+"."+gitName(f.Name)] = true
+			}
+		}
+		cmd.Flags().VisitAll(flags)
+		cmd.PersistentFlags().VisitAll(flags)
+		for _, sub := range cmd.Commands() {
+			visit(sub)
+		}
+	}
+	visit(root)
+	var unknown []string
+	for key, v := range cfg {
+		// A profile's keys may be any command's flags.
+		flagKey := key
+		if rest, ok := strings.CutPrefix(key, "profile."); ok {
+			_, flag, _ := strings.Cut(rest, ".")
+			flagKey = "." + flag
+		} else if rest, ok := strings.CutPrefix(key, gitKeyPrefix+"profile."); ok {
+			_, flag, _ := strings.Cut(rest, ".")
+			flagKey = gitKeyPrefix + "." + flag
+		}
+		switch {
+		case strings.HasPrefix(key, untrustedKeyPrefix):
+			unknown = append(unknown, fmt.Sprintf("%s: ignoring '%s' in the repository's config, which may only set it with --trust-repo-config", v.source, strings.TrimPrefix(strings.TrimPrefix(key, untrustedKeyPrefix), ".")))
+		case known[flagKey]:
+		case strings.HasPrefix(key, gitKeyPrefix):
+			unknown = append(unknown, fmt.Sprintf("unknown git config key '%s'", strings.TrimPrefix(v.source, "git config ")))
+		default:
+			unknown = append(unknown, fmt.Sprintf("%s: unknown key '%s'", v.source, strings.TrimPrefix(key, ".")))
+		}
+	}
+	slices.Sort(unknown)
+	for _, msg := range unknown {
+		console.warnf("%s", msg)
+	}
+}
+
+// parseConfig parses the TOML config file data, read from path, into cfg.
+// Tables, inline or not, name the command their keys apply to, and every
+// value is a string, a number, a boolean or an array of those.
+func parseConfig(cfg config, path, data string) error {
+	var tables map[string]any
+	if _, err := toml.Decode(data, &tables); err != nil {
+		return fmt.Errorf("fatal: %s: %v", path, err)
+	}
+	return flattenConfig(cfg, path, "", tables)
+}
+
+// flattenConfig adds the keys of table, whose dotted name is name, and of
+// the tables in it to cfg.
+func flattenConfig(cfg config, path, name string, table map[string]any) error {
+	for key, value := range table {
+		if sub, ok := value.(map[string]any); ok {
+			if err := flattenConfig(cfg, path, strings.TrimPrefix(name+"."+key, "."), sub); err != nil {
+				return err
+			}
+			continue
+		}
+		elems, ok := value.([]any)
+		if !ok {
+			elems = []any{value}
+		}
+		var values []string
+		for _, elem := range elems {
+			v, err := configString(elem)
+			if err != nil {
+				return fmt.Errorf("fatal: %s: %s: %v", path, strings.TrimPrefix(name+"."+key, "."), err)
+			}
+			values = append(values, v)
+		}
+		cfg[name+"."+key] = configValue{values, path}
+	}
+	return nil
+}
+
+// configString returns a decoded TOML value as a flag value.
+func configString(value any) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), nil
+	}
+	return "", fmt.Errorf("invalid value %v (expected a string, number or boolean, or an array of those)", value)
+}
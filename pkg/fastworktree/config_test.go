@@ -0,0 +1,106 @@
+package fastworktree
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+// newConfigTestCmd returns an add command below a root, with a jobs flag
+// to set from config.
+func newConfigTestCmd() (*cobra.Command, *int) {
+	root := &cobra.Command{Use: "git-fast-worktree"}
+	add := &cobra.Command{Use: "add"}
+	root.AddCommand(add)
+	jobs := new(int)
+	add.Flags().IntVar(jobs, "jobs", 1, "")
+	return add, jobs
+}
+
+func TestApplyConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		toml    string
+		git     map[string]string // git config keys as loadGitConfig stores them
+		args    []string
+		profile string
+		want    int
+	}{
+		{"default", "", nil, nil, "", 1},
+		{"git config", "", map[string]string{".jobs": "2"}, nil, "", 2},
+		{"git config table over top level", "", map[string]string{".jobs": "2", "add.jobs": "3"}, nil, "", 3},
+		{"file over git config", "jobs = 4\n", map[string]string{"add.jobs": "3"}, nil, "", 4},
+		{"table over top level", "jobs = 4\n[add]\njobs = 5\n", nil, nil, "", 5},
+		{"profile over table", "[add]\njobs = 5\n[profile.fast]\njobs = 6\n", nil, nil, "fast", 6},
+		{"git profile over file", "[add]\njobs = 5\n", map[string]string{"profile.fast.jobs": "7"}, nil, "fast", 7},
+		{"command line over all", "[add]\njobs = 5\n[profile.fast]\njobs = 6\n", nil, []string{"--jobs", "8"}, "fast", 8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config{}
+			for key, value := range tt.git {
+				cfg[gitKeyPrefix+key] = configValue{[]string{value}, "git config fastworktree." + key}
+			}
+			if err := parseConfig(cfg, "config.toml", tt.toml); err != nil {
+				t.Fatal(err)
+			}
+			saved := profile
+			profile = tt.profile
+			t.Cleanup(func() { profile = saved })
+
+			cmd, jobs := newConfigTestCmd()
+			if err := cmd.Flags().Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+			if err := applyConfig(cmd, cfg); err != nil {
+				t.Fatal(err)
+			}
+			if *jobs != tt.want {
+				t.Errorf("jobs = %d, want %d", *jobs, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfigRepoTrust(t *testing.T) {
+	repo := newTestRepo(t)
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("GIT_CONFIG_GLOBAL", os.DevNull)
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	t.Chdir(repo)
+	writeFiles(t, repo, map[string]string{repoConfigFile: "[add]\njobs = 4\npost-create = [\"touch pwned\"]\n"})
+
+	tests := []struct {
+		name    string
+		trusted func()
+		want    bool // whether post-create is applied
+	}{
+		{"untrusted", func() {}, false},
+		{"flag", func() { trustRepoConfig = true }, true},
+		{"git config", func() { runTestGit(t, "-C", repo, "config", "fastworktree.trustRepoConfig", "true") }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saved := trustRepoConfig
+			t.Cleanup(func() {
+				trustRepoConfig = saved
+				exec.Command("git", "-C", repo, "config", "--unset-all", "fastworktree.trustRepoConfig").Run()
+			})
+			tt.trusted()
+			cfg, err := loadConfig()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := cfg["add.jobs"]; !ok {
+				t.Errorf("jobs was not loaded from the repository's config")
+			}
+			_, applied := cfg["add.post-create"]
+			_, ignored := cfg[untrustedKeyPrefix+"add.post-create"]
+			if applied != tt.want || ignored == tt.want {
+				t.Errorf("post-create applied = %v, ignored = %v, want applied = %v", applied, ignored, tt.want)
+			}
+		})
+	}
+}
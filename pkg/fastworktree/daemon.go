@@ -0,0 +1,263 @@
+package fastworktree
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	daemonSocket string
+	daemonPool   int
+)
+
+var daemonCmd = &cobra.Command{
+	Use:   "daemon [flags]",
+	Short: "Serve create, remove and list requests on a Unix socket",
+	Long: "Listens on a Unix socket, .git/fast-worktree/daemon.sock by default, for\n" +
+		"newline-delimited JSON-RPC 2.0 requests from editor plugins and orchestration\n" +
+		"tools: create, remove, list and ping. While a worktree is created the daemon\n" +
+		"sends progress notifications with add's --progress=ndjson events, tagged with\n" +
+		"the request's id. With --pool it keeps that many worktrees ready and creates\n" +
+		"from them, refilling the pool after each create. Requests are served in the\n" +
+		"daemon's own process, one at a time.",
+	Example: "  git-fast-worktree daemon --pool 2 &\n" +
+		"  echo '{\"jsonrpc\":\"2.0\",\"id\":1,\"method\":\"create\",\"params\":{\"branch\":\"feat/x\"}}' |\n" +
+		"    socat - UNIX-CONNECT:.git/fast-worktree/daemon.sock",
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		src, err := gitToplevel()
+		if err != nil {
+			return notRepo(err)
+		}
+		socket := daemonSocket
+		if socket == "" {
+			common, err := gitCommonDir()
+			if err != nil {
+				return notRepo(err)
+			}
+			socket = filepath.Join(common, "fast-worktree", "daemon.sock")
+		}
+		ln, err := listenSocket(socket)
+		if err != nil {
+			return err
+		}
+		handleInterrupts()
+		atInterrupt(func() { os.Remove(socket) })
+		console.infof("listening on %s", socket)
+
+		// Every create is on the same volumes, so they are only probed
+		// once.
+		probeCache = new(sync.Map)
+		d := &daemon{dir: src}
+		if daemonPool > 0 {
+			go d.refillPool()
+		}
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return fmt.Errorf("fatal: %w", err)
+			}
+			go d.serve(conn)
+		}
+	},
+}
+
+// listenSocket listens on the Unix socket at path, replacing a socket left
+// behind by a daemon that is no longer running.
+func listenSocket(path string) (net.Listener, error) {
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("fatal: a daemon is already listening on %s", path)
+	}
+	os.Remove(path)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("fatal: %w", err)
+	}
+	// Anyone who can connect can create and delete worktrees.
+	ln, err := listenPrivate(path)
+	if err != nil {
+		return nil, fmt.Errorf("fatal: %w", err)
+	}
+	return ln, nil
+}
+
+// rpcServerError is the JSON-RPC error code for a request that failed.
+const rpcServerError = -32000
+
+// daemon runs requests for the repository at dir through the package's API,
+// which serializes them.
+type daemon struct {
+	dir string
+}
+
+// serve answers the requests on conn until the client closes it.
+func (d *daemon) serve(conn net.Conn) {
+	defer conn.Close()
+	var mu sync.Mutex
+	send := func(msg rpcMessage) {
+		msg.JSONRPC = "2.0"
+		data, err := json.Marshal(msg)
+		if err != nil {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		conn.Write(append(data, '\n'))
+	}
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	var wg sync.WaitGroup
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var msg rpcMessage
+		if err := json.Unmarshal(line, &msg); err != nil {
+			send(rpcMessage{ID: json.RawMessage("null"), Error: &rpcError{rpcParseError, err.Error()}})
+			continue
+		}
+		if msg.ID == nil {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			progress := func(event json.RawMessage) {
+				send(rpcMessage{Method: "progress", Params: withRequest(event, msg.ID)})
+			}
+			result, rpcErr := d.handle(msg.Method, msg.Params, progress)
+			send(rpcResponse(msg.ID, result, rpcErr))
+		}()
+	}
+	wg.Wait()
+}
+
+// withRequest adds the id of the request event belongs to as its "request"
+// field, so that clients with several creates in flight can tell their
+// progress apart.
+func withRequest(event, id json.RawMessage) json.RawMessage {
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(event, &fields) != nil {
+		return event
+	}
+	fields["request"] = id
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return event
+	}
+	return data
+}
+
+// handle runs one request, passing create's progress events to progress.
+func (d *daemon) handle(method string, params json.RawMessage, progress func(json.RawMessage)) (any, *rpcError) {
+	var r worktreeRequest
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &r); err != nil {
+			return nil, &rpcError{rpcInvalidParams, err.Error()}
+		}
+	}
+	switch method {
+	case "ping":
+		return map[string]any{}, nil
+	case "list":
+		worktrees, err := List(context.Background(), ListOptions{Repo: d.dir})
+		if err != nil {
+			return nil, &rpcError{rpcServerError, err.Error()}
+		}
+		return worktrees, nil
+	case "remove":
+		if r.Path == "" {
+			return nil, &rpcError{rpcInvalidParams, "path is required"}
+		}
+		opts := RemoveOptions{Repo: d.dir, Path: r.Path}
+		if r.Force {
+			opts.Force = 1
+		}
+		if err := Remove(context.Background(), opts); err != nil {
+			return nil, &rpcError{rpcServerError, err.Error()}
+		}
+		return map[string]any{"path": r.Path}, nil
+	case "create":
+		return d.create(r, progress)
+	}
+	return nil, &rpcError{rpcMethodNotFound, fmt.Sprintf("unknown method '%s'", method)}
+}
+
+// create adds the requested worktree, taking it from the pool if there is
+// one, and returns add's report. Unlike Add, it applies the config files
+// and the requested profile, as add would.
+func (d *daemon) create(r worktreeRequest, progress func(json.RawMessage)) (any, *rpcError) {
+	args, err := r.addArgs()
+	if err != nil {
+		return nil, &rpcError{rpcInvalidParams, err.Error()}
+	}
+	flags := []string{"--progress=ndjson"}
+	if daemonPool > 0 && len(r.Sparse) == 0 {
+		flags = append(flags, "--from-pool")
+	}
+	args = append(flags, args...)
+
+	var report *addReport
+	err = call(context.Background(), d.dir, nil, nil, slogger, func(string) error {
+		saved := profile
+		defer func() { profile, events = saved, os.Stdout }()
+		profile, events = r.Profile, eventWriter(progress)
+		if err := addCmd.Flags().Parse(args); err != nil {
+			return err
+		}
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		if err := applyConfig(addCmd, cfg); err != nil {
+			return err
+		}
+		reports, err := runAdd(addCmd, addCmd.Flags().Args())
+		if len(reports) > 0 {
+			report = reports[0]
+		}
+		return err
+	})
+	if daemonPool > 0 {
+		go d.refillPool()
+	}
+	if err != nil {
+		return nil, &rpcError{rpcServerError, err.Error()}
+	}
+	return report, nil
+}
+
+// eventWriter passes each line of ndjson progress written to it on to the
+// func.
+type eventWriter func(json.RawMessage)
+
+func (w eventWriter) Write(p []byte) (int, error) {
+	w(bytes.Clone(bytes.TrimSpace(p)))
+	return len(p), nil
+}
+
+// refillPool tops the pool up to --pool worktrees.
+func (d *daemon) refillPool() {
+	err := call(context.Background(), d.dir, nil, nil, slogger, func(dir string) error {
+		return fillPool(dir, daemonPool)
+	})
+	if err != nil {
+		console.warnf("filling the pool: %v", err)
+	}
+}
+
+func init() {
+	daemonCmd.Flags().StringVar(&daemonSocket, "socket", "", "path of the Unix socket to listen on (default .git/fast-worktree/daemon.sock)")
+	daemonCmd.Flags().IntVar(&daemonPool, "pool", 0, "keep this many worktrees ready in the pool and create from it")
+}
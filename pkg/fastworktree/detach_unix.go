@@ -0,0 +1,14 @@
+//go:build !windows
+
+package fastworktree
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// detach makes cmd run in its own session so it outlives this process and
+// is not killed by a Ctrl-C aimed at the terminal's foreground job.
+func detach(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+}
@@ -0,0 +1,18 @@
+//go:build windows
+
+package fastworktree
+
+import (
+	"os/exec"
+	"syscall"
+
+	"golang.org/x/sys/windows"
+)
+
+// detach makes cmd run without a console in its own process group so it
+// outlives this process and ignores Ctrl-C sent to the console.
+func detach(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		CreationFlags: windows.CREATE_NEW_PROCESS_GROUP | windows.DETACHED_PROCESS,
+	}
+}
@@ -0,0 +1,156 @@
+package fastworktree
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// minGitVersion is the oldest git with every worktree subcommand this tool
+// relies on (add --no-checkout, move, remove).
+var minGitVersion = [2]int{2, 17}
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check that this environment can create fast worktrees",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var failed int
+		report := func(err error, ok, hint string) {
+			if err == nil {
+				console.printf("[ok]   %s", ok)
+				return
+			}
+			failed++
+			console.printf("[fail] %v", err)
+			if hint != "" {
+				console.printf("       hint: %s", hint)
+			}
+		}
+
+		version, err := gitVersion()
+		if err == nil && (version[0] < minGitVersion[0] || version[0] == minGitVersion[0] && version[1] < minGitVersion[1]) {
+			err = fmt.Errorf("git %d.%d is too old", version[0], version[1])
+		}
+		report(err, fmt.Sprintf("git %d.%d", version[0], version[1]),
+			fmt.Sprintf("install git %d.%d or newer", minGitVersion[0], minGitVersion[1]))
+
+		src, err := gitToplevel()
+		report(err, "repository: "+src, "run doctor from inside a git repository")
+		if err != nil {
+			return fmt.Errorf("%d checks failed", failed)
+		}
+
+		// Worktrees are usually created next to the repository.
+		dstDir := filepath.Dir(src)
+
+		cloner, err := selectCloner(src, dstDir)
+		if err == nil {
+			report(nil, fmt.Sprintf("%s supports the %s backend", src, cloner.Name()), "")
+		} else {
+			report(err, "", "move the repository to a copy-on-write volume (APFS, btrfs, XFS, ZFS, ReFS), or rely on --fallback=copy")
+		}
+
+		same, err := sameVolume(src, dstDir)
+		if err == nil && !same {
+			err = fmt.Errorf("%s is on a different volume from %s", dstDir, src)
+		}
+		report(err, dstDir+" is on the same volume as the repository", "create worktrees on the same volume as the repository")
+
+		if cloner != nil {
+			report(probeClone(cloner, dstDir), cloner.Name()+" clone works in "+dstDir,
+				"check that "+dstDir+" is writable and on the same volume as the repository")
+		}
+
+		report(checkCaseSensitivity(src), "core.ignorecase matches the volume's case sensitivity",
+			"run git config core.ignorecase to match the volume, or recreate the repository on this volume")
+
+		if failed > 0 {
+			return fmt.Errorf("%d checks failed", failed)
+		}
+		return nil
+	},
+}
+
+// gitVersion returns the major and minor version of the git on PATH.
+func gitVersion() ([2]int, error) {
+	out, err := gitCommand("--version").Output()
+	if err != nil {
+		return [2]int{}, fmt.Errorf("git not found: %w", err)
+	}
+	// git version 2.43.0 (Apple Git-146)
+	fields := strings.Fields(string(out))
+	if len(fields) < 3 {
+		return [2]int{}, fmt.Errorf("unexpected git --version output: %s", out)
+	}
+	parts := strings.SplitN(fields[2], ".", 3)
+	var version [2]int
+	for i := 0; i < 2 && i < len(parts); i++ {
+		version[i], _ = strconv.Atoi(parts[i])
+	}
+	return version, nil
+}
+
+// probeClone clones a scratch file inside dir with c and checks that the
+// clone has the same contents.
+func probeClone(c Cloner, dir string) error {
+	tmp, err := os.MkdirTemp(dir, ".git-fast-worktree-doctor-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	data := []byte("git-fast-worktree doctor\n")
+	src := filepath.Join(tmp, "src")
+	if err := os.WriteFile(src, data, 0o644); err != nil {
+		return err
+	}
+	dst := filepath.Join(tmp, "dst")
+	if err := cloneWith(c, src, dst); err != nil {
+		return fmt.Errorf("%s clone failed in %s: %w", c.Name(), dir, err)
+	}
+	got, err := os.ReadFile(dst)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(got, data) {
+		return fmt.Errorf("%s clone in %s produced different contents", c.Name(), dir)
+	}
+	return nil
+}
+
+// checkCaseSensitivity compares the repository's core.ignorecase with how
+// the volume actually behaves. A mismatch makes git miss renames that only
+// change case and report phantom changes in cloned worktrees.
+func checkCaseSensitivity(src string) error {
+	insensitive, err := caseInsensitive(src)
+	if err != nil {
+		return err
+	}
+	out, _ := gitCommand("-C", src, "config", "--bool", "core.ignorecase").Output()
+	ignoreCase := strings.TrimSpace(string(out)) == "true"
+	if ignoreCase != insensitive {
+		return fmt.Errorf("core.ignorecase is %t but the volume is case-%s", ignoreCase, map[bool]string{true: "insensitive", false: "sensitive"}[insensitive])
+	}
+	return nil
+}
+
+// caseInsensitive reports whether the volume containing dir treats file
+// names case-insensitively, by creating a file and looking it up with
+// different case.
+func caseInsensitive(dir string) (bool, error) {
+	f, err := os.CreateTemp(dir, ".git-fast-worktree-case-")
+	if err != nil {
+		return false, err
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	_, err = os.Stat(filepath.Join(dir, strings.ToUpper(filepath.Base(f.Name()))))
+	return err == nil, nil
+}
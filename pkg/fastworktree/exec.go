@@ -0,0 +1,142 @@
+package fastworktree
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sync"
+
+	"github.com/spf13/cobra"
+)
+
+var execJobs int
+
+var execCmd = &cobra.Command{
+	Use:     "exec [flags] -- <command> [<args>...]",
+	Aliases: []string{"foreach"},
+	Short:   "Run a command in every worktree created by this tool",
+	Long: "Runs a command in every worktree created by this tool, in parallel. Output is\n" +
+		"prefixed with the worktree's name. A single argument is run with the shell,\n" +
+		"several are run directly. Exits with the highest exit code of any run.",
+	Example: "  git-fast-worktree exec -- 'git pull --ff-only && make'\n" +
+		"  git-fast-worktree exec -j 2 -- go test ./...",
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		managed, err := managedWorktrees()
+		if err != nil {
+			return fmt.Errorf("fatal: %w", err)
+		}
+		// Commands are for the worktrees in use, not idle pool slots.
+		managed = slices.DeleteFunc(managed, func(e managedWorktree) bool { return isPooled(e.Path) })
+		if len(managed) == 0 {
+			return fmt.Errorf("no worktrees created by git-fast-worktree")
+		}
+
+		var mu sync.Mutex
+		codes := make([]int, len(managed))
+		sem := make(chan struct{}, max(execJobs, 1))
+		var wg sync.WaitGroup
+		for i, wt := range managed {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				sem <- struct{}{}
+				defer func() { <-sem }()
+
+				prefix := "[" + filepath.Base(wt.Path) + "] "
+				stdout := &prefixWriter{mu: &mu, w: os.Stdout, prefix: prefix}
+				stderr := &prefixWriter{mu: &mu, w: os.Stderr, prefix: prefix}
+				run := shellCommand(args)
+				run.Dir = wt.Path
+				run.Stdout, run.Stderr = stdout, stderr
+				err := run.Run()
+				stdout.Flush()
+				stderr.Flush()
+
+				var exitErr *exec.ExitError
+				switch {
+				case errors.As(err, &exitErr):
+					codes[i] = exitErr.ExitCode()
+				case err != nil:
+					fmt.Fprintf(stderr, "%v\n", err)
+					stderr.Flush()
+					codes[i] = 1
+				}
+			}()
+		}
+		wg.Wait()
+
+		var failed, code int
+		for i, c := range codes {
+			if c != 0 {
+				failed++
+				code = max(code, c)
+				console.printf("failed: %s (exit status %d)", managed[i].Path, c)
+			}
+		}
+		if failed > 0 {
+			console.printf("%d of %d worktrees failed", failed, len(managed))
+			cmd.SilenceErrors, cmd.SilenceUsage = true, true
+			return &exitCodeError{code: code}
+		}
+		return nil
+	},
+}
+
+// shellCommand runs a single argument through the shell and several
+// arguments directly.
+func shellCommand(args []string) *exec.Cmd {
+	if len(args) > 1 {
+		return exec.Command(args[0], args[1:]...)
+	}
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", args[0])
+	}
+	return exec.Command("sh", "-c", args[0])
+}
+
+// prefixWriter writes each complete line to w with prefix in front of it.
+// Lines from several writers sharing mu are never interleaved.
+type prefixWriter struct {
+	mu     *sync.Mutex
+	w      io.Writer
+	prefix string
+	buf    []byte
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.buf = append(p.buf, b...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			return len(b), nil
+		}
+		p.writeLine(p.buf[:i+1])
+		p.buf = p.buf[i+1:]
+	}
+}
+
+// Flush writes out a trailing partial line.
+func (p *prefixWriter) Flush() {
+	if len(p.buf) > 0 {
+		p.writeLine(append(p.buf, '\n'))
+		p.buf = nil
+	}
+}
+
+func (p *prefixWriter) writeLine(line []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	io.WriteString(p.w, p.prefix)
+	p.w.Write(line)
+}
+
+func init() {
+	execCmd.Flags().IntVarP(&execJobs, "jobs", "j", runtime.NumCPU(), "number of worktrees to run in at once")
+}
@@ -0,0 +1,60 @@
+package fastworktree
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+)
+
+// Exit codes for failures scripts may want to tell apart, documented in
+// the README. Anything else exits 1.
+const (
+	exitNotRepo     = 2 // not run in a git repository
+	exitExists      = 3 // the destination already exists
+	exitUnsupported = 4 // no copy-on-write support, and no fallback allowed
+	exitCloneFailed = 5 // entries failed to clone, or the volume filled up
+	exitGitFailed   = 6 // a git command failed
+)
+
+// codedError is an error that exits with code.
+type codedError struct {
+	code int
+	err  error
+}
+
+func (e *codedError) Error() string { return e.err.Error() }
+func (e *codedError) Unwrap() error { return e.err }
+
+func withExitCode(code int, err error) error {
+	return &codedError{code, err}
+}
+
+// notRepo is the error for not finding a repository, with the git error
+// that said so.
+func notRepo(err error) error {
+	return withExitCode(exitNotRepo, fmt.Errorf("not a git repository (or any parent): %w", err))
+}
+
+// gitFailed is the error for a git command that failed, whose own error
+// message git has already printed.
+func gitFailed(command string) error {
+	return withExitCode(exitGitFailed, fmt.Errorf("%s failed", command))
+}
+
+// exitCode returns the code the process exits with for err. Errors from a
+// git command that are passed up as they are count as git failures.
+func exitCode(err error) int {
+	var exitErr *exitCodeError
+	if errors.As(err, &exitErr) {
+		return exitErr.code
+	}
+	var coded *codedError
+	if errors.As(err, &coded) {
+		return coded.code
+	}
+	var gitErr *exec.ExitError
+	if errors.As(err, &gitErr) {
+		return exitGitFailed
+	}
+	return 1
+}
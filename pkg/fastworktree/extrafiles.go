@@ -0,0 +1,68 @@
+package fastworktree
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+var (
+	copyFiles  []string
+	extraFiles []string
+)
+
+// cloneExtraFiles clones the files named by --copy and extra-files, with
+// --editor-settings the editor directories and with --trust the tool
+// config files, from src into dst if they are not there yet, which they
+// would not be if they were ignored, excluded or outside a
+// sparse-checkout. Names are paths relative to the top of the worktree and
+// may be globs. It returns the paths cloned.
+func cloneExtraFiles(src, dst string, cloner Cloner, log logger) ([]string, error) {
+	var cloned []string
+	patterns := slices.Concat(copyFiles, extraFiles)
+	if editorSettings {
+		patterns = append(patterns, editorDirs...)
+	}
+	if trustTools {
+		patterns = append(patterns, toolFiles...)
+	}
+	for _, pattern := range patterns {
+		rel := filepath.Clean(filepath.FromSlash(pattern))
+		if filepath.IsAbs(rel) || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return cloned, fmt.Errorf("fatal: --copy takes paths inside the worktree, not '%s'", pattern)
+		}
+		matches, err := filepath.Glob(filepath.Join(src, rel))
+		if err != nil {
+			return cloned, fmt.Errorf("fatal: invalid --copy pattern '%s': %w", pattern, err)
+		}
+		// extra-files are defaults for every worktree, so they need not
+		// all exist; a --copy that matches nothing is a mistake.
+		if len(matches) == 0 && slices.Contains(copyFiles, pattern) {
+			log.warnf("--copy %s: no such file in %s", pattern, src)
+		}
+		for _, match := range matches {
+			name, err := filepath.Rel(src, match)
+			if err != nil {
+				return cloned, err
+			}
+			if name == ".git" || strings.HasPrefix(name, ".git"+string(filepath.Separator)) {
+				continue
+			}
+			target := filepath.Join(dst, name)
+			if _, err := os.Lstat(target); err == nil {
+				continue
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0o777); err != nil {
+				return cloned, fmt.Errorf("fatal: %w", err)
+			}
+			if err := cloneEntry(cloner, match, target, log); err != nil {
+				return cloned, fmt.Errorf("fatal: cloning %s: %w", filepath.ToSlash(name), err)
+			}
+			log.verbosef(1, "  %s: copied", filepath.ToSlash(name))
+			cloned = append(cloned, filepath.ToSlash(name))
+		}
+	}
+	return cloned, nil
+}
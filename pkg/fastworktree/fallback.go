@@ -0,0 +1,46 @@
+package fastworktree
+
+import "os"
+
+// fallbacks maps --fallback values to the backend used when no
+// copy-on-write backend supports the source and destination. A nil entry
+// means the add should fail instead.
+var fallbacks = map[string]Cloner{
+	"copy":     copyCloner{},
+	"hardlink": hardlinkCloner{},
+	"error":    nil,
+}
+
+// copyCloner copies every file. It works on any filesystem, at the cost of
+// duplicating all data.
+type copyCloner struct{}
+
+func (copyCloner) Name() string              { return "copy" }
+func (copyCloner) SupportsDir() bool         { return false }
+func (copyCloner) Probe(volume string) error { return nil }
+func (copyCloner) Clone(src, dst string) error {
+	return copyFile(src, dst)
+}
+
+// hardlinkCloner hardlinks read-only files, such as build artifacts and
+// vendored dependencies, and copies everything else. Writable files are
+// never linked, since an edit in the new worktree would also change the
+// source.
+type hardlinkCloner struct{}
+
+func (hardlinkCloner) Name() string              { return "hardlink" }
+func (hardlinkCloner) SupportsDir() bool         { return false }
+func (hardlinkCloner) Probe(volume string) error { return nil }
+
+func (hardlinkCloner) Clone(src, dst string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	// Linking fails across volumes or past the filesystem's link limit;
+	// either way a copy is still correct.
+	if info.Mode().Perm()&0o222 == 0 && os.Link(src, dst) == nil {
+		return nil
+	}
+	return copyFile(src, dst)
+}
@@ -0,0 +1,294 @@
+// Package fastworktree creates git worktrees using copy-on-write cloning,
+// so a new worktree starts with the untracked and ignored files of an
+// existing one, such as dependencies and build outputs, already in place.
+//
+// It is the git-fast-worktree command: Main runs its command line, and Add,
+// Remove and List do what its add, remove and list commands do for Go
+// programs that would rather embed it than run the binary. The command
+// keeps its flags in package variables, so calls are serialized and run one
+// at a time. Config files and profiles do not apply to them, and their
+// structured logs go to Options.Logger, not slog's default logger.
+package fastworktree
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+var (
+	// apiMu serializes calls through the API.
+	apiMu sync.Mutex
+	// embedded is set while a call through the API runs, and turns off
+	// what only makes sense for the command line: printing the new
+	// worktree's path, prompts, signal handling and background processes.
+	embedded bool
+	// runContext is the context of that call: git and cloning stop once it
+	// is done.
+	runContext = context.Background()
+	// clonerOverride is Options.Cloner.
+	clonerOverride Cloner
+)
+
+// GitRunner returns the command that runs git with args, for programs that
+// run it differently, such as with another binary or environment. The
+// command's Dir is set to the repository unless the runner sets one. By
+// default it is exec.CommandContext(ctx, "git", args...).
+type GitRunner func(ctx context.Context, args ...string) *exec.Cmd
+
+// Options says where and how Add creates a worktree.
+type Options struct {
+	// Repo is a directory in the repository, the current directory if
+	// empty. Relative paths are relative to it.
+	Repo string
+	// Path is where to create the worktree. If it is empty and Branch is
+	// set, it is made from the branch, as with add -b.
+	Path string
+	// Branch is a new branch to create for the worktree.
+	Branch string
+	// Commitish is the commit, branch or tag to check out, HEAD if empty.
+	Commitish string
+	// From is the worktree to clone files from: main, an absolute path or a
+	// branch checked out in one. It is the worktree Repo is in if empty.
+	From string
+	// Sparse only clones and checks out these directories.
+	Sparse []string
+	// Exclude are gitignore patterns of files not to clone.
+	Exclude []string
+	// Backend is the copy-on-write backend to use, as with --backend, and
+	// Fallback what to do without one: copy (the default), hardlink or
+	// error.
+	Backend  string
+	Fallback string
+	// Cloner, if set, clones the files instead of any backend.
+	Cloner Cloner
+	// Git runs git.
+	Git GitRunner
+	// Log receives the progress lines and warnings add prints, which are
+	// dropped if it is nil.
+	Log io.Writer
+	// Logger receives the same messages as a structured log, with the
+	// worktree and timings as attributes. It is discarded if nil.
+	Logger *slog.Logger
+}
+
+// Result describes the worktree Add created.
+type Result struct {
+	Path   string
+	Branch string
+	Commit string
+	// Backend is the name of the backend that cloned the files, and
+	// Entries how many files and directories it cloned.
+	Backend  string
+	Entries  int64
+	Phases   []Phase
+	Duration time.Duration
+	Warnings []string
+}
+
+// Phase is how long one step of Add took.
+type Phase struct {
+	Name     string
+	Duration time.Duration
+}
+
+// Add creates a worktree as add does. If ctx is cancelled while the files
+// are cloned, the worktree is rolled back.
+func Add(ctx context.Context, opts Options) (Result, error) {
+	var result Result
+	err := call(ctx, opts.Repo, opts.Git, opts.Log, opts.Logger, func(dir string) error {
+		clonerOverride = opts.Cloner
+		flags := addCmd.Flags()
+		for name, value := range map[string]string{"b": opts.Branch, "from": opts.From, "backend": opts.Backend, "fallback": opts.Fallback} {
+			if value == "" {
+				continue
+			}
+			if f := flags.ShorthandLookup(name); f != nil {
+				name = f.Name
+			}
+			if err := flags.Set(name, value); err != nil {
+				return err
+			}
+		}
+		if len(opts.Sparse) > 0 {
+			if err := flags.Set("sparse", strings.Join(opts.Sparse, ",")); err != nil {
+				return err
+			}
+		}
+		for _, pattern := range opts.Exclude {
+			if err := flags.Set("exclude", pattern); err != nil {
+				return err
+			}
+		}
+		var args []string
+		if opts.Path != "" {
+			path := opts.Path
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(dir, path)
+			}
+			args = append(args, path)
+			if opts.Commitish != "" {
+				args = append(args, opts.Commitish)
+			}
+		} else if opts.Commitish != "" {
+			// add only makes up the path when it has no arguments.
+			if opts.Branch == "" {
+				return fmt.Errorf("fatal: a Path is required without a Branch")
+			}
+			path, err := defaultWorktreePath(opts.Branch)
+			if err != nil {
+				return err
+			}
+			args = append(args, path, opts.Commitish)
+		}
+
+		reports, err := runAdd(addCmd, args)
+		if len(reports) > 0 {
+			r := reports[0]
+			result = Result{
+				Path:     r.Path,
+				Branch:   r.Branch,
+				Commit:   r.Commit,
+				Backend:  r.Backend,
+				Entries:  r.Entries,
+				Duration: time.Duration(r.TotalMs * float64(time.Millisecond)),
+				Warnings: r.Warnings,
+			}
+			for _, p := range r.Phases {
+				result.Phases = append(result.Phases, Phase{p.Name, time.Duration(p.Ms * float64(time.Millisecond))})
+			}
+		}
+		return err
+	})
+	return result, err
+}
+
+// RemoveOptions says which worktree Remove removes.
+type RemoveOptions struct {
+	// Repo is a directory in the repository, the current directory if
+	// empty. Relative paths are relative to it.
+	Repo string
+	// Path is the worktree to remove.
+	Path string
+	// Force is how many times remove's --force is given: once to remove a
+	// worktree with uncommitted changes, stashes or unpushed commits, twice
+	// to remove a locked one.
+	Force  int
+	Git    GitRunner
+	Log    io.Writer
+	Logger *slog.Logger
+}
+
+// Remove removes a worktree and deletes its files, as remove does, except
+// that they are deleted before it returns.
+func Remove(ctx context.Context, opts RemoveOptions) error {
+	return call(ctx, opts.Repo, opts.Git, opts.Log, opts.Logger, func(dir string) error {
+		removeForce = opts.Force
+		path := opts.Path
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		return runRemove(path)
+	})
+}
+
+// ListOptions says whose worktrees List lists.
+type ListOptions struct {
+	// Repo is a directory in the repository, the current directory if
+	// empty.
+	Repo string
+	// Usage measures each worktree's disk usage, which means walking it.
+	Usage bool
+	Git   GitRunner
+}
+
+// List returns the repository's worktrees, the main one first, as list
+// --json does.
+func List(ctx context.Context, opts ListOptions) ([]Worktree, error) {
+	var worktrees []Worktree
+	err := call(ctx, opts.Repo, opts.Git, nil, nil, func(dir string) error {
+		listUsage = opts.Usage
+		var err error
+		worktrees, err = describeWorktrees()
+		return err
+	})
+	return worktrees, err
+}
+
+// call runs fn, given the absolute path of repo, as a call through the
+// API: after any other call is done, with the command's flags at their
+// defaults, git run by git in repo, output going to log and the structured
+// log to structured.
+func call(ctx context.Context, repo string, git GitRunner, log io.Writer, structured *slog.Logger, fn func(dir string) error) error {
+	apiMu.Lock()
+	defer apiMu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	dir, err := filepath.Abs(repo)
+	if err != nil {
+		return err
+	}
+	for _, flags := range []*pflag.FlagSet{addCmd.Flags(), removeCmd.Flags(), listCmd.Flags()} {
+		resetFlags(flags)
+	}
+	if git == nil {
+		git = func(ctx context.Context, args ...string) *exec.Cmd {
+			return exec.CommandContext(ctx, "git", args...)
+		}
+	}
+
+	saved := struct {
+		newGitCmd func(...string) *exec.Cmd
+		stderr    io.Writer
+		slogger   *slog.Logger
+		quiet     bool
+		noColor   bool
+	}{newGitCmd, stderr, slogger, quiet, noColor}
+	defer func() {
+		newGitCmd, stderr, slogger, quiet, noColor = saved.newGitCmd, saved.stderr, saved.slogger, saved.quiet, saved.noColor
+		embedded, runContext, clonerOverride = false, context.Background(), nil
+	}()
+	embedded, runContext = true, ctx
+	newGitCmd = func(args ...string) *exec.Cmd {
+		cmd := git(ctx, args...)
+		if cmd.Dir == "" {
+			cmd.Dir = dir
+		}
+		return cmd
+	}
+	stderr, quiet, noColor = log, log == nil, true
+	if log == nil {
+		stderr = io.Discard
+	}
+	slogger = structured
+	if structured == nil {
+		slogger = slog.New(slog.DiscardHandler)
+	}
+	// Once ctx is done, whatever failed did because of it.
+	err = fn(dir)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// resetFlags sets every flag in flags back to its default.
+func resetFlags(flags *pflag.FlagSet) {
+	flags.VisitAll(func(f *pflag.Flag) {
+		if v, ok := f.Value.(pflag.SliceValue); ok {
+			v.Replace(nil)
+		} else {
+			f.Value.Set(f.DefValue)
+		}
+		f.Changed = false
+	})
+}
@@ -0,0 +1,82 @@
+package fastworktree
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// setupFsmonitor enables a filesystem monitor in the new worktree at dst
+// for --fsmonitor, so git status need not scan the whole tree:
+//
+//   - builtin sets core.fsmonitor=true and starts git's own daemon (macOS
+//     and Windows, git 2.36+);
+//   - watchman has Watchman watch the worktree and points core.fsmonitor
+//     at the repository's fsmonitor-watchman hook.
+//
+// core.fsmonitor is set for the worktree alone when the repository has
+// extensions.worktreeConfig enabled, and for the whole repository
+// otherwise.
+func setupFsmonitor(dst, mode string, log logger) error {
+	var value string
+	switch mode {
+	case "builtin":
+		if out, err := gitCommand("-C", dst, "fsmonitor--daemon", "start").CombinedOutput(); err != nil {
+			return fmt.Errorf("git fsmonitor--daemon start: %v: %s", err, strings.TrimSpace(string(out)))
+		}
+		value = "true"
+	case "watchman":
+		hook, err := watchmanHook(dst)
+		if err != nil {
+			return err
+		}
+		if _, err := exec.LookPath("watchman"); err != nil {
+			return fmt.Errorf("watchman is not installed")
+		}
+		if out, err := exec.Command("watchman", "watch-project", dst).CombinedOutput(); err != nil {
+			return fmt.Errorf("watchman watch-project: %v: %s", err, strings.TrimSpace(string(out)))
+		}
+		value = hook
+	default:
+		return nil
+	}
+
+	scope := "--worktree"
+	out, _ := gitCommand("-C", dst, "config", "--bool", "extensions.worktreeConfig").Output()
+	if strings.TrimSpace(string(out)) != "true" {
+		scope = "--local"
+		log.verbosef(1, "core.fsmonitor is set for the whole repository; enable extensions.worktreeConfig to set it per worktree")
+	}
+	if err := gitCommand("-C", dst, "config", scope, "core.fsmonitor", value).Run(); err != nil {
+		return fmt.Errorf("git config core.fsmonitor: %w", err)
+	}
+	log.infof("fsmonitor:    %s", mode)
+	return nil
+}
+
+// watchmanHook returns the repository's fsmonitor-watchman hook, installing
+// it from git's sample if the repository only has that.
+func watchmanHook(dst string) (string, error) {
+	out, err := gitCommand("-C", dst, "rev-parse", "--git-path", "hooks").Output()
+	if err != nil {
+		return "", fmt.Errorf("git rev-parse: %w", err)
+	}
+	hooks := strings.TrimSpace(string(out))
+	if !filepath.IsAbs(hooks) {
+		hooks = filepath.Join(dst, hooks)
+	}
+	hook := filepath.Join(hooks, "fsmonitor-watchman")
+	if _, err := os.Stat(hook); err == nil {
+		return hook, nil
+	}
+	sample, err := os.ReadFile(hook + ".sample")
+	if err != nil {
+		return "", fmt.Errorf("no fsmonitor-watchman hook in %s", hooks)
+	}
+	if err := os.WriteFile(hook, sample, 0o755); err != nil {
+		return "", err
+	}
+	return hook, nil
+}
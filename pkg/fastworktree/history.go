@@ -0,0 +1,181 @@
+package fastworktree
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	historyOp     string
+	historySince  string
+	historyBranch string
+	historyUser   string
+	historyLimit  int
+	historyJSON   bool
+)
+
+// historyEntry is a line of the history log: a worktree created, removed,
+// moved or adopted.
+type historyEntry struct {
+	Time   time.Time `json:"time"`
+	Op     string    `json:"op"`
+	Path   string    `json:"path"`
+	From   string    `json:"from,omitempty"` // for move
+	Branch string    `json:"branch,omitempty"`
+	User   string    `json:"user"`
+	Host   string    `json:"host"`
+	Ms     float64   `json:"ms"`
+}
+
+// historyPath returns the history log's path, in the main repository's
+// .git/fast-worktree.
+func historyPath() (string, error) {
+	common, err := gitCommonDir()
+	if err != nil {
+		return "", notRepo(err)
+	}
+	return filepath.Join(common, "fast-worktree", "history.jsonl"), nil
+}
+
+// recordHistory appends e, an op that began at start, to the history log,
+// with when it ended and who ran it. It only warns if it cannot, since the
+// op itself is done.
+func recordHistory(e historyEntry, start time.Time) {
+	e.Time, e.Ms = time.Now(), float64(time.Since(start).Microseconds())/1000
+	if u, err := user.Current(); err == nil {
+		e.User = u.Username
+	}
+	e.Host, _ = os.Hostname()
+	if err := appendHistory(e); err != nil {
+		console.warnf("could not record %s in the history: %v", e.Op, err)
+	}
+}
+
+// appendHistory writes e as a line of the history log. Each line is
+// written at once, so concurrent runs do not interleave.
+func appendHistory(e historyEntry) error {
+	path, err := historyPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// currentBranch returns the branch checked out in the worktree at path, or
+// "" if HEAD is detached.
+func currentBranch(path string) string {
+	out, err := gitCommand("-C", path, "symbolic-ref", "--short", "-q", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+var historyCmd = &cobra.Command{
+	Use:   "history [flags]",
+	Short: "Show the log of worktrees created, removed and moved",
+	Long: "Shows the log add, remove, move, prune, undo and adopt keep of the worktrees\n" +
+		"they create, remove, move and adopt in .git/fast-worktree/history.jsonl:\n" +
+		"when, by whom on which host, the path and branch, and how long it took. The\n" +
+		"log is only ever appended to; delete the file to clear it.",
+	Example: "  git-fast-worktree history --since 7d --op remove\n" +
+		"  git-fast-worktree history -n 20 --json",
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var since time.Time
+		if historySince != "" {
+			age, err := parseAge(historySince)
+			if err != nil {
+				return fmt.Errorf("fatal: invalid --since '%s' (expected e.g. 36h, 14d or 2w)", historySince)
+			}
+			since = time.Now().Add(-age)
+		}
+		path, err := historyPath()
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(path)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("fatal: %w", err)
+		}
+		defer f.Close()
+
+		var entries []historyEntry
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var e historyEntry
+			if json.Unmarshal(scanner.Bytes(), &e) != nil {
+				continue
+			}
+			if (historyOp != "" && e.Op != historyOp) || e.Time.Before(since) ||
+				(historyBranch != "" && e.Branch != historyBranch) || (historyUser != "" && e.User != historyUser) {
+				continue
+			}
+			entries = append(entries, e)
+		}
+		if err := scanner.Err(); err != nil {
+			return fmt.Errorf("fatal: reading %s: %w", path, err)
+		}
+		if historyLimit > 0 && len(entries) > historyLimit {
+			entries = entries[len(entries)-historyLimit:]
+		}
+
+		if historyJSON {
+			enc := json.NewEncoder(os.Stdout)
+			for _, e := range entries {
+				if err := enc.Encode(e); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "TIME\tOP\tPATH\tBRANCH\tUSER\tTOOK")
+		for _, e := range entries {
+			path := e.Path
+			if e.From != "" {
+				path = e.From + " -> " + e.Path
+			}
+			took := time.Duration(e.Ms * float64(time.Millisecond)).Round(time.Millisecond)
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s@%s\t%v\n", e.Time.Local().Format("2006-01-02 15:04:05"), e.Op, path, cmp.Or(e.Branch, "-"), e.User, e.Host, took)
+		}
+		return w.Flush()
+	},
+}
+
+func init() {
+	historyCmd.Flags().StringVar(&historyOp, "op", "", "only show this operation: add, remove, move, prune, clean, evict or adopt")
+	historyCmd.Flags().StringVar(&historySince, "since", "", "only show what happened in this long, e.g. 7d")
+	historyCmd.Flags().StringVar(&historyBranch, "branch", "", "only show this branch")
+	historyCmd.Flags().StringVar(&historyUser, "user", "", "only show what this user did")
+	historyCmd.Flags().IntVarP(&historyLimit, "limit", "n", 0, "only show the last n entries")
+	historyCmd.Flags().BoolVar(&historyJSON, "json", false, "output the entries as JSON lines")
+}
@@ -0,0 +1,51 @@
+package fastworktree
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var postCreate []string
+
+// hookOutput serializes the output of hooks running for a batch.
+var hookOutput sync.Mutex
+
+// runPostCreate runs the --post-create commands with the shell in the new
+// worktree at dst, in order, stopping at the first that fails. They are
+// told about the worktree through GFW_* environment variables, and their
+// output goes to stderr, keeping stdout for the worktree's path.
+func runPostCreate(src, dst string, log logger) error {
+	if len(postCreate) == 0 {
+		return nil
+	}
+	branch, _ := gitCommand("-C", dst, "branch", "--show-current").Output()
+	commit, _ := gitCommand("-C", dst, "rev-parse", "HEAD").Output()
+	env := append(os.Environ(),
+		"GFW_WORKTREE="+dst,
+		"GFW_BRANCH="+strings.TrimSpace(string(branch)),
+		"GFW_COMMIT="+strings.TrimSpace(string(commit)),
+		"GFW_SOURCE="+src,
+	)
+
+	stepStart := log.start("post-create")
+	for _, hook := range postCreate {
+		hookStart := time.Now()
+		out := &prefixWriter{mu: &hookOutput, w: stderr, prefix: log.prefix}
+		cmd := shellCommand([]string{hook})
+		cmd.Dir = dst
+		cmd.Env = env
+		cmd.Stdout, cmd.Stderr = out, out
+		err := cmd.Run()
+		out.Flush()
+		if err != nil {
+			// Not %w: the hook's exit status is not a git failure.
+			return fmt.Errorf("fatal: post-create hook '%s' failed in %s: %v", hook, dst, err)
+		}
+		log.infof("post-create:  %s (%v)", hook, time.Since(hookStart).Round(time.Millisecond))
+	}
+	log.phase("post-create", time.Since(stepStart))
+	return nil
+}
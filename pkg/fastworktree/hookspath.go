@@ -0,0 +1,68 @@
+package fastworktree
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var installHooks bool
+
+// hookInstallers are the commands that install a hook manager's hooks,
+// by the file that shows the worktree uses it.
+var hookInstallers = []struct{ marker, command string }{
+	{"lefthook.yml", "lefthook install"},
+	{".lefthook.yml", "lefthook install"},
+	{"lefthook.yaml", "lefthook install"},
+	{".husky", "npx --no-install husky"},
+	{".pre-commit-config.yaml", "pre-commit install"},
+}
+
+// checkHooks makes sure commits in the new worktree at dst run the same
+// hooks as in src. Hooks in the repository's hooks directory are shared by
+// every worktree, and so is an absolute core.hooksPath, but a relative one
+// is resolved in each worktree, and hook managers keep the hooks it points
+// to out of git: if they were not cloned, as with --clean or --exclude,
+// they are cloned now. With --install-hooks, the hook manager's install
+// step is run as well.
+func checkHooks(src, dst string, log logger) {
+	out, _ := gitCommand("-C", dst, "config", "core.hooksPath").Output()
+	hooksPath := strings.TrimSpace(string(out))
+	if hooksPath != "" && !filepath.IsAbs(hooksPath) && !strings.HasPrefix(hooksPath, "~") {
+		have := filepath.Join(src, hooksPath)
+		want := filepath.Join(dst, hooksPath)
+		if _, err := os.Stat(want); os.IsNotExist(err) {
+			if _, err := os.Stat(have); err == nil {
+				if err := os.MkdirAll(filepath.Dir(want), 0o777); err == nil {
+					err = cloneTree(have, want, copyFile)
+				}
+				if err != nil {
+					log.warnf("core.hooksPath %s is missing in the new worktree and could not be cloned, so commits there run no hooks: %v", hooksPath, err)
+				} else {
+					log.infof("hooks:        cloned %s", hooksPath)
+				}
+			} else {
+				log.warnf("core.hooksPath %s does not exist, so commits run no hooks; install them with your hook manager", hooksPath)
+			}
+		}
+	}
+
+	if !installHooks {
+		return
+	}
+	ran := make(map[string]bool)
+	for _, installer := range hookInstallers {
+		if _, err := os.Stat(filepath.Join(dst, installer.marker)); err != nil || ran[installer.command] {
+			continue
+		}
+		ran[installer.command] = true
+		cmd := shellCommand([]string{installer.command})
+		cmd.Dir = dst
+		cmd.Stdout, cmd.Stderr = stderr, stderr
+		if err := cmd.Run(); err != nil {
+			log.warnf("%s: %v", installer.command, err)
+			continue
+		}
+		log.infof("hooks:        %s", installer.command)
+	}
+}
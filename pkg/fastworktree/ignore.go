@@ -0,0 +1,231 @@
+package fastworktree
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ignoreFile lists, in gitignore syntax, paths of the source worktree that
+// are never cloned into new worktrees.
+const ignoreFile = ".fastworktreeignore"
+
+var (
+	excludePatterns []string
+	includeOnly     []string
+)
+
+// ignoreRule is one pattern of an ignore file.
+type ignoreRule struct {
+	glob    string
+	re      *regexp.Regexp
+	negate  bool // a !pattern, which re-includes what an earlier one excluded
+	dirOnly bool // a pattern/, which only matches directories
+	path    bool // matched against the whole path rather than the name
+}
+
+// ignoreList is the rules of an ignore file, in order; the last one that
+// matches a path decides.
+type ignoreList []ignoreRule
+
+// loadIgnore returns the rules for what not to clone from src: its ignore
+// file, then --include-only and --exclude, which win over the file.
+func loadIgnore(src string) (ignoreList, error) {
+	rules, err := readIgnoreFile(filepath.Join(src, ignoreFile))
+	if err != nil {
+		return nil, err
+	}
+	if len(includeOnly) > 0 {
+		// Everything at the top level, except what is included.
+		patterns := []string{"/*"}
+		for _, include := range includeOnly {
+			name := strings.Trim(filepath.ToSlash(include), "/")
+			if name == "" || strings.Contains(name, "/") {
+				return nil, fmt.Errorf("fatal: --include-only takes top-level names, not '%s'; use --sparse for directories below the top", include)
+			}
+			patterns = append(patterns, "!/"+name)
+		}
+		if rules, err = appendIgnoreRules(rules, "--include-only", patterns); err != nil {
+			return nil, err
+		}
+	}
+	return appendIgnoreRules(rules, "--exclude", excludePatterns)
+}
+
+// readIgnoreFile reads the rules of an ignore file, returning none if it
+// does not exist.
+func readIgnoreFile(path string) (ignoreList, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("fatal: reading %s: %w", ignoreFile, err)
+	}
+	var rules ignoreList
+	for i, line := range strings.Split(string(data), "\n") {
+		if rules, err = appendIgnoreRules(rules, fmt.Sprintf("%s:%d", ignoreFile, i+1), []string{line}); err != nil {
+			return nil, err
+		}
+	}
+	return rules, nil
+}
+
+// appendIgnoreRules parses gitignore patterns, from source for errors,
+// onto rules.
+func appendIgnoreRules(rules ignoreList, source string, patterns []string) (ignoreList, error) {
+	for _, line := range patterns {
+		pattern := strings.TrimRight(line, " \t\r")
+		if pattern == "" || strings.HasPrefix(pattern, "#") {
+			continue
+		}
+		var rule ignoreRule
+		if rule.negate = strings.HasPrefix(pattern, "!"); rule.negate {
+			pattern = pattern[1:]
+		}
+		pattern = strings.TrimPrefix(pattern, `\`) // \# and \! start literal patterns
+		if rule.dirOnly = strings.HasSuffix(pattern, "/"); rule.dirOnly {
+			pattern = strings.TrimRight(pattern, "/")
+		}
+		// As in gitignore, a slash anywhere but the end anchors the
+		// pattern to the top of the worktree.
+		rule.path = strings.Contains(pattern, "/")
+		pattern = strings.TrimPrefix(pattern, "/")
+		if pattern == "" {
+			continue
+		}
+		rule.glob = pattern
+		var err error
+		if rule.re, err = globRegexp(pattern); err != nil {
+			return nil, fmt.Errorf("fatal: %s: invalid pattern '%s': %v", source, line, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// globRegexp compiles a gitignore glob: * and ? do not match a slash, **
+// matches any number of directories, and [...] is a character class.
+func globRegexp(glob string) (*regexp.Regexp, error) {
+	var re strings.Builder
+	re.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; {
+		case strings.HasPrefix(glob[i:], "**/"):
+			re.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "/**") && i+3 == len(glob):
+			re.WriteString("(/.*)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			re.WriteString(".*")
+			i++
+		case c == '*':
+			re.WriteString("[^/]*")
+		case c == '?':
+			re.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated [")
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			re.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(glob):
+			i++
+			re.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	re.WriteString("$")
+	return regexp.Compile(re.String())
+}
+
+// match reports whether the path name, relative to the top of the worktree
+// and slash-separated, is ignored, either itself or by being inside an
+// ignored directory.
+func (l ignoreList) match(name string, isDir bool) bool {
+	for i, c := range name {
+		if c == '/' && l.matchOne(name[:i], true) {
+			return true
+		}
+	}
+	return l.matchOne(name, isDir)
+}
+
+func (l ignoreList) matchOne(name string, isDir bool) bool {
+	ignored := false
+	base := name[strings.LastIndexByte(name, '/')+1:]
+	for _, rule := range l {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		subject := base
+		if rule.path {
+			subject = name
+		}
+		if rule.re.MatchString(subject) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+
+// topLevel reports whether every rule only matches top-level entries, so
+// checking each entry as it is cloned finds everything there is to ignore.
+func (l ignoreList) topLevel() bool {
+	for _, rule := range l {
+		if !rule.path || strings.Contains(rule.glob, "/") || strings.Contains(rule.glob, "**") {
+			return false
+		}
+	}
+	return true
+}
+
+// prune removes what l ignores from the clone at dst, for rules that match
+// below the entries that were checked as they were cloned, returning the
+// paths removed. Ignored directories are removed whole, without looking
+// inside them.
+func (l ignoreList) prune(dst string) ([]string, error) {
+	var removed []string
+	err := filepath.WalkDir(dst, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == dst {
+			return nil
+		}
+		if d.Name() == ".git" {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(dst, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		// Its parents were not ignored, or it would not be reached.
+		if !l.matchOne(name, d.IsDir()) {
+			return nil
+		}
+		if err := os.RemoveAll(path); err != nil {
+			return err
+		}
+		removed = append(removed, name)
+		if d.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	return removed, err
+}
@@ -0,0 +1,214 @@
+package fastworktree
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// indexStat is the stat information git keeps for each index entry, as
+// the 32-bit fields it stores.
+type indexStat struct {
+	ctimeSec, ctimeNsec uint32
+	mtimeSec, mtimeNsec uint32
+	dev, ino            uint32
+	uid, gid            uint32
+	size                uint32
+}
+
+// indexPath returns the path of the index of the worktree at dir.
+func indexPath(dir string) (string, error) {
+	out, err := gitCommand("-C", dir, "rev-parse", "--git-path", "index").Output()
+	if err != nil {
+		return "", fmt.Errorf("git rev-parse: %w", err)
+	}
+	path := strings.TrimSpace(string(out))
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	return path, nil
+}
+
+// cloneIndex gives the new worktree at dst a copy of src's index instead of
+// having git reset build one from HEAD. Entries whose cloned file matches
+// the source's keep their stat information, updated to the clone's inode
+// and ctime, so git does not have to read every file on the first git
+// status. It reports false, having written nothing, when the index cannot
+// be cloned: a split or sparse index, an index extension it does not know,
+// or a platform without the stat information git uses.
+//
+// The copy matches src's index, not dst's HEAD; the caller still has to
+// bring it to HEAD when they differ.
+func cloneIndex(src, dst string) (bool, error) {
+	if !indexStatSupported {
+		return false, nil
+	}
+	srcIndex, err := indexPath(src)
+	if err != nil {
+		return false, err
+	}
+	info, err := os.Stat(srcIndex)
+	if err != nil {
+		return false, nil
+	}
+	data, err := os.ReadFile(srcIndex)
+	if err != nil {
+		return false, nil
+	}
+
+	var h hash.Hash = sha1.New()
+	if out, err := gitCommand("-C", src, "rev-parse", "--show-object-format").Output(); err == nil && strings.TrimSpace(string(out)) == "sha256" {
+		h = sha256.New()
+	}
+	hashSize := h.Size()
+	if len(data) < 12+hashSize || string(data[:4]) != "DIRC" {
+		return false, nil
+	}
+	version := binary.BigEndian.Uint32(data[4:])
+	if version < 2 || version > 4 {
+		return false, nil
+	}
+	body, sum := data[:len(data)-hashSize], data[len(data)-hashSize:]
+	// index.skipHash leaves the checksum zeroed.
+	if !bytes.Equal(sum, make([]byte, hashSize)) {
+		h.Write(body)
+		if !bytes.Equal(h.Sum(nil), sum) {
+			return false, nil
+		}
+		h.Reset()
+	}
+
+	// Entries modified within the same second as the source index was
+	// written cannot be trusted by their stat information ("racily clean"),
+	// which git only detects by comparing with the index's own mtime.
+	racy := uint32(info.ModTime().Unix())
+
+	out := bytes.Clone(body)
+	count := binary.BigEndian.Uint32(data[8:])
+	pos := 12
+	var prev string
+	for range count {
+		// ctime, mtime, dev, ino, mode, uid, gid, size, oid, flags
+		fixed := 40 + hashSize + 2
+		if pos+fixed > len(body) {
+			return false, nil
+		}
+		entry := out[pos:]
+		flags := binary.BigEndian.Uint16(entry[40+hashSize:])
+		if flags&0x4000 != 0 {
+			fixed += 2 // extended flags
+		}
+		var path string
+		var next int
+		if version == 4 {
+			// The path is the previous one with n bytes removed from the
+			// end, followed by a NUL-terminated suffix.
+			n, w := indexVarint(body[pos+fixed:])
+			if w <= 0 || n > uint64(len(prev)) {
+				return false, nil
+			}
+			suffix := body[pos+fixed+w:]
+			end := bytes.IndexByte(suffix, 0)
+			if end < 0 {
+				return false, nil
+			}
+			path = prev[:len(prev)-int(n)] + string(suffix[:end])
+			next = pos + fixed + w + end + 1
+		} else {
+			name := body[pos+fixed:]
+			end := bytes.IndexByte(name, 0)
+			if end < 0 {
+				return false, nil
+			}
+			path = string(name[:end])
+			// Entries are padded with 1-8 NULs to a multiple of 8 bytes.
+			next = pos + (fixed+end+8)&^7
+		}
+		prev = path
+
+		mode := binary.BigEndian.Uint32(entry[24:])
+		mtime := binary.BigEndian.Uint32(entry[8:])
+		if mode != 0o160000 && mtime < racy {
+			if st, ok := statEntry(filepath.Join(dst, filepath.FromSlash(path))); ok &&
+				st.mtimeSec == mtime && st.mtimeNsec == binary.BigEndian.Uint32(entry[12:]) &&
+				st.size == binary.BigEndian.Uint32(entry[36:]) {
+				for i, v := range []uint32{st.ctimeSec, st.ctimeNsec} {
+					binary.BigEndian.PutUint32(entry[i*4:], v)
+				}
+				for i, v := range []uint32{st.dev, st.ino} {
+					binary.BigEndian.PutUint32(entry[16+i*4:], v)
+				}
+				for i, v := range []uint32{st.uid, st.gid} {
+					binary.BigEndian.PutUint32(entry[28+i*4:], v)
+				}
+			}
+		} else if mode != 0o160000 {
+			// Make git check the contents rather than trust the stat.
+			clear(entry[8:16])
+		}
+		pos = next
+	}
+
+	// Extensions: a signature, a size and the data. Only the cache tree
+	// describes the entries alone; the others hold state of the source
+	// worktree, such as its untracked cache, and are dropped. A required
+	// extension (lowercase signature) means an index this cannot clone.
+	entriesEnd := pos
+	var kept []byte
+	for pos+8 <= len(body) {
+		sig := string(body[pos : pos+4])
+		size := int(binary.BigEndian.Uint32(body[pos+4:]))
+		if pos+8+size > len(body) {
+			return false, nil
+		}
+		if sig[0] < 'A' || sig[0] > 'Z' {
+			return false, nil
+		}
+		if sig == "TREE" {
+			kept = append(kept, body[pos:pos+8+size]...)
+		}
+		pos += 8 + size
+	}
+
+	cloned := append(out[:entriesEnd:entriesEnd], kept...)
+	h.Write(cloned)
+	cloned = h.Sum(cloned)
+
+	gitdir, err := worktreeGitdir(dst)
+	if err != nil {
+		return false, err
+	}
+	tmp := filepath.Join(gitdir, "index.lock")
+	if err := os.WriteFile(tmp, cloned, 0o644); err != nil {
+		return false, err
+	}
+	if err := os.Rename(tmp, filepath.Join(gitdir, "index")); err != nil {
+		os.Remove(tmp)
+		return false, err
+	}
+	return true, nil
+}
+
+// indexVarint decodes the variable-length integer at the start of b as git
+// writes them, which unlike binary.Uvarint puts the most significant group
+// first and adds one for each continuation byte. It returns the value and
+// the number of bytes read, or 0 if b ends first.
+func indexVarint(b []byte) (uint64, int) {
+	var v uint64
+	for i, c := range b {
+		if i > 0 {
+			v++
+		}
+		v = v<<7 | uint64(c&0x7f)
+		if c&0x80 == 0 {
+			return v, i + 1
+		}
+	}
+	return 0, 0
+}
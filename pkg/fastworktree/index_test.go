@@ -0,0 +1,60 @@
+package fastworktree
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestCloneIndexV4 clones an index in version 4, whose entries' paths are
+// compressed against the previous entry's, with prefixes long enough to
+// need more than one byte to strip.
+func TestCloneIndexV4(t *testing.T) {
+	if !indexStatSupported {
+		t.Skip("no index stat information on this platform")
+	}
+	src := newTestRepo(t)
+	long := strings.Repeat("d", 150)
+	files := map[string]string{
+		long + "/a.txt":       "a",
+		long + "/b.txt":       "b",
+		long + "/sub/c.txt":   "c",
+		"e.txt":               "e",
+		"e2/" + long + ".txt": "e2",
+	}
+	writeFiles(t, src, files)
+	// Long enough ago that no entry is racily clean.
+	past := time.Now().Add(-time.Hour).Truncate(time.Second)
+	touch := func(dir string) {
+		for name := range files {
+			if err := os.Chtimes(filepath.Join(dir, filepath.FromSlash(name)), past, past); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	touch(src)
+	commitAll(t, src, "files")
+	runTestGit(t, "-C", src, "update-index", "--index-version", "4")
+
+	dst := cloneForTest(t, src, "HEAD")
+	touch(dst)
+	ok, err := cloneIndex(src, dst)
+	if err != nil || !ok {
+		t.Fatalf("cloneIndex() = %v, %v, want the index cloned", ok, err)
+	}
+	// diff-files does not refresh the index, so it lists every entry
+	// whose stat information was not carried over.
+	out, err := exec.Command("git", "-C", dst, "diff-files", "--name-only").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stale := strings.TrimSpace(string(out)); stale != "" {
+		t.Errorf("entries without the clone's stat information:\n%s", stale)
+	}
+	if status := gitStatus(t, dst); status != "" {
+		t.Errorf("git status in the clone:\n%s", status)
+	}
+}
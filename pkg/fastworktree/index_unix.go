@@ -0,0 +1,26 @@
+//go:build !windows
+
+package fastworktree
+
+import "golang.org/x/sys/unix"
+
+const indexStatSupported = true
+
+// statEntry returns the stat information git would record for path.
+func statEntry(path string) (indexStat, bool) {
+	var st unix.Stat_t
+	if err := unix.Lstat(path, &st); err != nil {
+		return indexStat{}, false
+	}
+	return indexStat{
+		ctimeSec:  uint32(st.Ctim.Sec),
+		ctimeNsec: uint32(st.Ctim.Nsec),
+		mtimeSec:  uint32(st.Mtim.Sec),
+		mtimeNsec: uint32(st.Mtim.Nsec),
+		dev:       uint32(st.Dev),
+		ino:       uint32(st.Ino),
+		uid:       st.Uid,
+		gid:       st.Gid,
+		size:      uint32(st.Size),
+	}, true
+}
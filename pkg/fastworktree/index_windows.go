@@ -0,0 +1,9 @@
+package fastworktree
+
+// Git for Windows fills in index stat information its own way, so the
+// index is always built by git reset.
+const indexStatSupported = false
+
+func statEntry(path string) (indexStat, bool) {
+	return indexStat{}, false
+}
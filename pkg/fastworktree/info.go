@@ -0,0 +1,95 @@
+package fastworktree
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+var infoJSON bool
+
+// worktreeInfo is what info shows: the worktree as it is now, and how it
+// was created.
+type worktreeInfo struct {
+	Path     string           `json:"path"`
+	Head     string           `json:"head"`
+	Branch   string           `json:"branch,omitempty"`
+	Metadata worktreeMetadata `json:"metadata"`
+}
+
+var infoCmd = &cobra.Command{
+	Use:   "info [<worktree>]",
+	Short: "Show how a worktree was created",
+	Long: "Shows the metadata add records for a worktree: when it was created, the\n" +
+		"worktree and commit its files were cloned from, the branch, the backend, the\n" +
+		"flags add was run with and the version that ran it. <worktree> is main, a\n" +
+		"branch checked out in one, a path or a worktree's directory name, and the\n" +
+		"current worktree if left out.",
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var path string
+		var ok bool
+		var err error
+		if len(args) == 0 {
+			if path, err = gitToplevel(); err != nil {
+				return notRepo(err)
+			}
+		} else if path, err = findWorktree(args[0]); err != nil {
+			return err
+		}
+		var meta worktreeMetadata
+		gitdir, err := worktreeGitdir(path)
+		if err == nil {
+			meta, ok = readMetadata(gitdir)
+		}
+		if !ok {
+			return fmt.Errorf("fatal: '%s' was not created by git-fast-worktree", path)
+		}
+		info := worktreeInfo{Path: path, Metadata: meta}
+		// The metadata's branch is the one the worktree was created on,
+		// which it may have left since.
+		info.Head = headCommit(path)
+		if out, err := gitCommand("-C", path, "symbolic-ref", "--short", "-q", "HEAD").Output(); err == nil {
+			info.Branch = strings.TrimSpace(string(out))
+		}
+
+		if infoJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(info)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		row := func(name, value string) {
+			if value != "" {
+				fmt.Fprintf(w, "%s:\t%s\n", name, value)
+			}
+		}
+		row("path", info.Path)
+		row("head", info.Head)
+		row("branch", cmp.Or(info.Branch, "(detached)"))
+		row("created", meta.Created.Local().Format("2006-01-02 15:04:05"))
+		if meta.Branch != info.Branch {
+			row("created on", meta.Branch)
+		}
+		row("source", meta.Source)
+		row("source commit", meta.SourceCommit)
+		row("backend", meta.Backend)
+		row("flags", strings.Join(meta.Flags, " "))
+		row("version", meta.Version)
+		if meta.Expires != nil {
+			row("expires", meta.Expires.Local().Format("2006-01-02 15:04:05"))
+		}
+		row("workspace", meta.Workspace)
+		return w.Flush()
+	},
+}
+
+func init() {
+	infoCmd.Flags().BoolVar(&infoJSON, "json", false, "print the worktree and its metadata as JSON")
+}
@@ -0,0 +1,55 @@
+package fastworktree
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	tmuxSession bool
+	zoxideAdd   bool
+)
+
+// integrateWorktree hands the new worktree at dst to the tools asked for:
+// with --zoxide it is added to zoxide's database, so z jumps to it, and
+// with --tmux a tmux session named after its branch is started in it,
+// which is switched to if add runs inside tmux and switchTo is set. Like
+// --open, failures are only warnings.
+func integrateWorktree(dst string, switchTo bool, log logger) {
+	if zoxideAdd {
+		if err := exec.Command("zoxide", "add", dst).Run(); err != nil {
+			log.warnf("zoxide add: %v", err)
+		}
+	}
+	if tmuxSession {
+		startTmuxSession(dst, switchTo, log)
+	}
+}
+
+// startTmuxSession starts a tmux session in dst unless there is one by its
+// name already.
+func startTmuxSession(dst string, switchTo bool, log logger) {
+	name := filepath.Base(dst)
+	if out, err := gitCommand("-C", dst, "symbolic-ref", "--short", "-q", "HEAD").Output(); err == nil {
+		name = strings.TrimSpace(string(out))
+	}
+	// tmux takes . and : in a target as a window and pane.
+	name = strings.NewReplacer(".", "_", ":", "_").Replace(name)
+	target := "=" + name
+
+	if exec.Command("tmux", "has-session", "-t", target).Run() != nil {
+		if out, err := exec.Command("tmux", "new-session", "-d", "-s", name, "-c", dst).CombinedOutput(); err != nil {
+			log.warnf("tmux new-session: %v: %s", err, strings.TrimSpace(string(out)))
+			return
+		}
+	}
+	if switchTo && os.Getenv("TMUX") != "" {
+		if out, err := exec.Command("tmux", "switch-client", "-t", target).CombinedOutput(); err != nil {
+			log.warnf("tmux switch-client: %v: %s", err, strings.TrimSpace(string(out)))
+		}
+		return
+	}
+	log.infof("tmux:         session %s (tmux attach -t %s)", name, name)
+}
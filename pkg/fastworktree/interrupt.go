@@ -0,0 +1,72 @@
+package fastworktree
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// interruptCleanups are run, in no particular order, when SIGINT or SIGTERM
+// arrives while handleInterrupts is active.
+var interruptCleanups struct {
+	sync.Mutex
+	next  int
+	funcs map[int]func()
+}
+
+// atInterrupt registers cleanup to run if the process is interrupted. The
+// returned function unregisters it.
+func atInterrupt(cleanup func()) (cancel func()) {
+	interruptCleanups.Lock()
+	defer interruptCleanups.Unlock()
+	if interruptCleanups.funcs == nil {
+		interruptCleanups.funcs = make(map[int]func())
+	}
+	id := interruptCleanups.next
+	interruptCleanups.next++
+	interruptCleanups.funcs[id] = cleanup
+	return func() {
+		interruptCleanups.Lock()
+		defer interruptCleanups.Unlock()
+		delete(interruptCleanups.funcs, id)
+	}
+}
+
+// handleInterrupts makes SIGINT and SIGTERM run the registered cleanups and
+// exit with the conventional 128+signal status, until stop is called. The
+// lock is held until exit so nothing can unregister, or register, in the
+// meantime. Programs embedding the package handle their own signals, and
+// cancel the context.
+func handleInterrupts() (stop func()) {
+	if embedded {
+		return func() {}
+	}
+	signals := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		var sig os.Signal
+		select {
+		case sig = <-signals:
+		case <-done:
+			return
+		}
+		interruptCleanups.Lock()
+		if len(interruptCleanups.funcs) > 0 {
+			console.printf("interrupted, cleaning up")
+		}
+		for _, cleanup := range interruptCleanups.funcs {
+			cleanup()
+		}
+		code := 130
+		if sig == syscall.SIGTERM {
+			code = 143
+		}
+		os.Exit(code)
+	}()
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
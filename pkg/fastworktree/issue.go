@@ -0,0 +1,115 @@
+package fastworktree
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+var (
+	issueRef      string
+	issueTemplate string
+	issueCommand  string
+)
+
+// issueKeyPattern matches the keys Jira, Linear and YouTrack give issues,
+// such as PROJ-123.
+var issueKeyPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9]*-[0-9]+$`)
+
+// issueNumberPattern matches GitHub and GitLab issue numbers, with or
+// without a #.
+var issueNumberPattern = regexp.MustCompile(`^#?([0-9]+)$`)
+
+// parseIssue returns the key of the issue ref names, and its URL if it is
+// one. A URL's key is the last part of its path that looks like a key, as
+// in Jira's /browse/PROJ-123 and Linear's /issue/ENG-123/title, or the
+// number after /issues/, as on GitHub and GitLab.
+func parseIssue(ref string) (key, link string, err error) {
+	if m := issueNumberPattern.FindStringSubmatch(ref); m != nil {
+		return m[1], "", nil
+	}
+	if issueKeyPattern.MatchString(ref) {
+		return ref, "", nil
+	}
+	u, err := url.Parse(ref)
+	if err == nil && u.Scheme != "" && u.Host != "" {
+		parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+		for i, part := range parts {
+			switch {
+			case issueKeyPattern.MatchString(part):
+				key = part
+			case part == "issues" && i+1 < len(parts) && issueNumberPattern.MatchString(parts[i+1]):
+				key = parts[i+1]
+			}
+		}
+		if key == "" {
+			key = u.Query().Get("selectedIssue")
+		}
+		if key != "" {
+			return key, ref, nil
+		}
+	}
+	return "", "", fmt.Errorf("fatal: '%s' is not an issue key, number or URL", ref)
+}
+
+// slugChars matches the runs of characters slug replaces.
+var slugChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// slug makes an issue title fit for a branch name: "Fix the Login page!"
+// becomes "fix-the-login-page". Long titles are cut at a word.
+func slug(s string) string {
+	const maxLen = 50
+	s = strings.Trim(slugChars.ReplaceAllString(strings.ToLower(s), "-"), "-")
+	if len(s) > maxLen {
+		s = s[:maxLen]
+		if i := strings.LastIndex(s, "-"); i > 0 {
+			s = s[:i]
+		}
+	}
+	return s
+}
+
+// issueBranch returns the name of the branch for the issue ref, rendered
+// from --issue-template with its key and, from --issue-command, its title.
+func issueBranch(ref string) (string, error) {
+	key, link, err := parseIssue(ref)
+	if err != nil {
+		return "", err
+	}
+	var title string
+	if issueCommand != "" {
+		cmd := shellCommand([]string{issueCommand})
+		cmd.Env = append(os.Environ(), "GFW_ISSUE="+key, "GFW_ISSUE_URL="+link)
+		cmd.Stderr = stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return "", fmt.Errorf("fatal: --issue-command failed for %s: %v", key, err)
+		}
+		title, _, _ = strings.Cut(strings.TrimSpace(string(out)), "\n")
+	}
+
+	tmpl, err := template.New("issue-template").
+		Funcs(template.FuncMap{"sanitize": sanitize, "lower": strings.ToLower, "upper": strings.ToUpper, "slug": slug}).
+		Option("missingkey=error").
+		Parse(issueTemplate)
+	if err != nil {
+		return "", fmt.Errorf("fatal: invalid --issue-template: %w", err)
+	}
+	var branch bytes.Buffer
+	data := struct{ Key, Title, URL string }{key, title, link}
+	if err := tmpl.Execute(&branch, data); err != nil {
+		return "", fmt.Errorf("fatal: invalid --issue-template: %w", err)
+	}
+	name := strings.TrimSpace(branch.String())
+	if name == "" {
+		return "", fmt.Errorf("fatal: --issue-template gives an empty branch name for %s", key)
+	}
+	if err := gitCommand("check-ref-format", "--branch", name).Run(); err != nil {
+		return "", fmt.Errorf("fatal: --issue-template gives '%s' for %s, which is not a valid branch name", name, key)
+	}
+	return name, nil
+}
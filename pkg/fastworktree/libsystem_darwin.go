@@ -0,0 +1,75 @@
+//go:build darwin
+
+package fastworktree
+
+import (
+	"encoding/binary"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Flags from <copyfile.h> and <sys/attr.h>.
+const (
+	copyfileRecursive      = 1 << 15
+	copyfileClone          = 1 << 24
+	attrCmnextPrivateSize  = 0x00000008
+	fsoptNofollow          = 0x00000001
+	fsoptAttrCmnExtended   = unix.FSOPT_ATTR_CMN_EXTENDED
+	privateSizeAttrBufSize = 4 + 8
+)
+
+// x/sys/unix does not wrap copyfile(3) or getattrlist(2), so they are called
+// through libSystem the same way x/sys does for its own libc calls.
+
+// copyfileCloneTree clones src to dst with copyfile(3) using COPYFILE_CLONE
+// and COPYFILE_RECURSIVE. Unlike clonefile(2), which clones a tree all or
+// nothing, copyfile works file by file and clones what it can, copying the
+// rest.
+func copyfileCloneTree(src, dst string) error {
+	srcp, err := unix.BytePtrFromString(src)
+	if err != nil {
+		return err
+	}
+	dstp, err := unix.BytePtrFromString(dst)
+	if err != nil {
+		return err
+	}
+	_, _, errno := syscall_syscall6(libc_copyfile_trampoline_addr,
+		uintptr(unsafe.Pointer(srcp)), uintptr(unsafe.Pointer(dstp)), 0, copyfileClone|copyfileRecursive, 0, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// privateSize returns the number of bytes of path that are not shared with
+// any clone (ATTR_CMNEXT_PRIVATESIZE), i.e. what deleting it would free.
+func privateSize(path string) (int64, error) {
+	p, err := unix.BytePtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+	attrs := unix.Attrlist{Bitmapcount: unix.ATTR_BIT_MAP_COUNT, Forkattr: attrCmnextPrivateSize}
+	var buf [privateSizeAttrBufSize]byte
+	_, _, errno := syscall_syscall6(libc_getattrlist_trampoline_addr,
+		uintptr(unsafe.Pointer(p)), uintptr(unsafe.Pointer(&attrs)), uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf)),
+		fsoptNofollow|fsoptAttrCmnExtended, 0)
+	if errno != 0 {
+		return 0, errno
+	}
+	// The buffer is a u_int32_t length followed by the packed off_t.
+	return int64(binary.LittleEndian.Uint64(buf[4:])), nil
+}
+
+//go:linkname syscall_syscall6 syscall.syscall6
+func syscall_syscall6(fn, a1, a2, a3, a4, a5, a6 uintptr) (r1, r2 uintptr, err syscall.Errno)
+
+var (
+	libc_copyfile_trampoline_addr    uintptr
+	libc_getattrlist_trampoline_addr uintptr
+)
+
+//go:cgo_import_dynamic libc_copyfile copyfile "/usr/lib/libSystem.B.dylib"
+//go:cgo_import_dynamic libc_getattrlist getattrlist "/usr/lib/libSystem.B.dylib"
@@ -0,0 +1,164 @@
+package fastworktree
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	listJSON  bool
+	listUsage bool
+)
+
+// Worktree is a worktree as shown by list and returned by List.
+type Worktree struct {
+	Path       string     `json:"path"`
+	Head       string     `json:"head"`
+	Branch     string     `json:"branch,omitempty"`
+	Managed    bool       `json:"managed"`
+	Created    *time.Time `json:"created,omitempty"`
+	Ahead      *int       `json:"ahead,omitempty"`
+	Behind     *int       `json:"behind,omitempty"`
+	Locked     bool       `json:"locked"`
+	LockReason string     `json:"lockReason,omitempty"`
+	Prunable   string     `json:"prunable,omitempty"`
+	Usage      *DiskUsage `json:"usage,omitempty"`
+}
+
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List worktrees with copy-on-write details",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		items, err := describeWorktrees()
+		if err != nil {
+			return err
+		}
+
+		if listJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(items)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		header := "PATH\tHEAD\tBRANCH\tSTATUS\tCREATED"
+		if listUsage {
+			header += "\tLOGICAL\tPRIVATE"
+		}
+		fmt.Fprintln(w, header)
+		for _, it := range items {
+			created := "-"
+			if it.Created != nil {
+				created = it.Created.Local().Format("2006-01-02 15:04")
+			}
+			branch := it.Branch
+			if branch == "" {
+				branch = "(detached)"
+			}
+			head := it.Head
+			if len(head) > 7 {
+				head = head[:7]
+			}
+			line := fmt.Sprintf("%s\t%s\t%s\t%s\t%s", it.Path, head, branch, it.status(), created)
+			if it.Usage != nil {
+				line += fmt.Sprintf("\t%s\t%s", formatBytes(it.Usage.Logical), formatBytes(it.Usage.Private))
+			}
+			fmt.Fprintln(w, line)
+		}
+		return w.Flush()
+	},
+}
+
+// describeWorktrees lists the repository's worktrees, describing them
+// concurrently.
+func describeWorktrees() ([]Worktree, error) {
+	entries, err := listWorktrees(".")
+	if err != nil {
+		return nil, fmt.Errorf("fatal: %w", err)
+	}
+	items := make([]Worktree, len(entries))
+	var wg sync.WaitGroup
+	for i, e := range entries {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			items[i] = describeWorktree(e)
+		}()
+	}
+	wg.Wait()
+	return items, nil
+}
+
+// describeWorktree gathers the details list shows for e. Failures to read
+// optional details (no upstream, unreadable files) leave them empty.
+func describeWorktree(e worktreeEntry) Worktree {
+	it := Worktree{
+		Path:       e.Path,
+		Head:       e.Head,
+		Branch:     e.Branch,
+		Locked:     e.Locked,
+		LockReason: e.LockReason,
+		Prunable:   e.Prunable,
+	}
+	if gitdir, err := worktreeGitdir(e.Path); err == nil {
+		if m, ok := readMetadata(gitdir); ok {
+			it.Managed = true
+			it.Created = &m.Created
+		}
+	}
+	if e.Branch != "" {
+		out, err := gitCommand("-C", e.Path, "rev-list", "--left-right", "--count", "HEAD...@{upstream}").Output()
+		if err == nil {
+			var ahead, behind int
+			if _, err := fmt.Sscan(string(out), &ahead, &behind); err == nil {
+				it.Ahead, it.Behind = &ahead, &behind
+			}
+		}
+	}
+	if listUsage && !e.Bare && e.Prunable == "" {
+		if u, err := measureUsage(e.Path); err == nil {
+			it.Usage = &u
+		}
+	}
+	return it
+}
+
+// status summarises upstream tracking and lock state for the table.
+func (it Worktree) status() string {
+	var parts []string
+	if it.Ahead != nil {
+		switch {
+		case *it.Ahead == 0 && *it.Behind == 0:
+			parts = append(parts, "up to date")
+		default:
+			parts = append(parts, fmt.Sprintf("+%d/-%d", *it.Ahead, *it.Behind))
+		}
+	}
+	if it.Locked {
+		if it.LockReason != "" {
+			parts = append(parts, fmt.Sprintf("locked (%s)", it.LockReason))
+		} else {
+			parts = append(parts, "locked")
+		}
+	}
+	if it.Prunable != "" {
+		parts = append(parts, "prunable")
+	}
+	if len(parts) == 0 {
+		return "-"
+	}
+	return strings.Join(parts, ", ")
+}
+
+func init() {
+	listCmd.Flags().BoolVar(&listJSON, "json", false, "output as JSON")
+	listCmd.Flags().BoolVarP(&listUsage, "usage", "u", false, "measure logical and private (unshared) disk usage")
+}
@@ -0,0 +1,53 @@
+package fastworktree
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+)
+
+var lockReason string
+
+var lockCmd = &cobra.Command{
+	Use:   "lock [flags] <worktree>",
+	Short: "Lock a worktree so git does not prune it",
+	Long:  "Locks a worktree so git does not prune it, e.g. when it lives on a removable\nor secondary volume that is not always mounted.",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path, err := filepath.Abs(args[0])
+		if err != nil {
+			return fmt.Errorf("error resolving path: %w", err)
+		}
+		lockArgs := []string{"worktree", "lock"}
+		if lockReason != "" {
+			lockArgs = append(lockArgs, "--reason", lockReason)
+		}
+		if err := runGit(append(lockArgs, path)...); err != nil {
+			return gitFailed("git worktree lock")
+		}
+		console.infof("locked: %s", path)
+		return nil
+	},
+}
+
+var unlockCmd = &cobra.Command{
+	Use:   "unlock <worktree>",
+	Short: "Unlock a worktree so git may prune it again",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path, err := filepath.Abs(args[0])
+		if err != nil {
+			return fmt.Errorf("error resolving path: %w", err)
+		}
+		if err := runGit("worktree", "unlock", path); err != nil {
+			return gitFailed("git worktree unlock")
+		}
+		console.infof("unlocked: %s", path)
+		return nil
+	},
+}
+
+func init() {
+	lockCmd.Flags().StringVar(&lockReason, "reason", "", "reason for locking")
+}
@@ -0,0 +1,362 @@
+package fastworktree
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cobra"
+)
+
+var mcpCmd = &cobra.Command{
+	Use:   "mcp",
+	Short: "Serve worktree tools to AI agents over the Model Context Protocol",
+	Long: "Runs a Model Context Protocol server on stdin and stdout, with tools to create,\n" +
+		"remove and list worktrees, for agent orchestrators that fan work out into\n" +
+		"isolated worktrees. Each tool runs this binary's add, remove or list command\n" +
+		"with --json in the repository it is given, or the one the server was started\n" +
+		"in, and returns its output. Worktrees are created one at a time.",
+	Example: "  # in an MCP client's server configuration\n" +
+		"  {\"command\": \"git-fast-worktree\", \"args\": [\"mcp\"]}",
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		exe, err := os.Executable()
+		if err != nil {
+			return fmt.Errorf("fatal: %w", err)
+		}
+		s := &mcpServer{exe: exe, out: os.Stdout}
+		return s.serve(os.Stdin)
+	},
+}
+
+// mcpProtocolVersion is the latest protocol version the server speaks.
+const mcpProtocolVersion = "2025-06-18"
+
+// mcpProtocolVersions are the protocol versions the server speaks, the
+// tools it serves being the same in each.
+var mcpProtocolVersions = []string{mcpProtocolVersion, "2025-03-26", "2024-11-05"}
+
+// rpcMessage is a JSON-RPC 2.0 request, notification or response.
+type rpcMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+// rpcResponse returns the response to the request id. It has a result, if
+// only an empty one, unless the request failed, as a response must have one
+// or the other.
+func rpcResponse(id json.RawMessage, result any, err *rpcError) rpcMessage {
+	if err != nil {
+		return rpcMessage{ID: id, Error: err}
+	}
+	if result == nil {
+		result = map[string]any{}
+	}
+	return rpcMessage{ID: id, Result: result}
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// JSON-RPC error codes.
+const (
+	rpcParseError     = -32700
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+)
+
+// mcpTool is a tool as listed by tools/list.
+type mcpTool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	InputSchema map[string]any `json:"inputSchema"`
+}
+
+// mcpTools are the tools the server offers.
+var mcpTools = []mcpTool{
+	{
+		Name: "create_worktree",
+		Description: "Create a git worktree using copy-on-write cloning, so it starts with the source worktree's " +
+			"untracked and ignored files (dependencies, build outputs) already in place. Returns a JSON report " +
+			"with the new worktree's path, branch and commit.",
+		InputSchema: objectSchema(map[string]any{
+			"repo":      stringSchema("a directory in the repository; defaults to the server's"),
+			"path":      stringSchema("where to create the worktree; defaults to one named after the branch"),
+			"branch":    stringSchema("a new branch to create for the worktree"),
+			"commitish": stringSchema("the commit, branch or tag to check out; defaults to HEAD"),
+			"from":      stringSchema("the worktree to clone files from: main, a path or a branch checked out in one"),
+			"sparse":    arraySchema("only clone and check out these directories"),
+			"exclude":   arraySchema("gitignore patterns of files not to clone, such as node_modules"),
+			"profile":   stringSchema("a profile of flag values from the config"),
+		}),
+	},
+	{
+		Name:        "remove_worktree",
+		Description: "Remove a worktree and delete its files. Fails if it has uncommitted changes, stashes or unpushed commits unless force is set, saying what they are.",
+		InputSchema: objectSchema(map[string]any{
+			"repo":  stringSchema("a directory in the repository; defaults to the server's"),
+			"path":  stringSchema("the worktree to remove"),
+			"force": map[string]any{"type": "boolean", "description": "remove it even with uncommitted changes, stashes or unpushed commits"},
+		}, "path"),
+	},
+	{
+		Name:        "list_worktrees",
+		Description: "List the repository's worktrees as JSON, with their branches, commits and whether this tool created them.",
+		InputSchema: objectSchema(map[string]any{
+			"repo": stringSchema("a directory in the repository; defaults to the server's"),
+		}),
+	},
+}
+
+func objectSchema(properties map[string]any, required ...string) map[string]any {
+	schema := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+func stringSchema(description string) map[string]any {
+	return map[string]any{"type": "string", "description": description}
+}
+
+func arraySchema(description string) map[string]any {
+	return map[string]any{"type": "array", "items": map[string]any{"type": "string"}, "description": description}
+}
+
+// mcpServer answers requests read from stdin, running each in its own
+// goroutine so a slow create does not hold up a list.
+type mcpServer struct {
+	exe    string
+	out    io.Writer
+	outMu  sync.Mutex
+	create sync.Mutex // creates run one at a time
+}
+
+func (s *mcpServer) serve(in io.Reader) error {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	var wg sync.WaitGroup
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var msg rpcMessage
+		if err := json.Unmarshal(line, &msg); err != nil {
+			s.send(rpcMessage{ID: json.RawMessage("null"), Error: &rpcError{rpcParseError, err.Error()}})
+			continue
+		}
+		if msg.ID == nil {
+			continue // notifications, such as notifications/initialized, need no answer
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, rpcErr := s.handle(msg.Method, msg.Params)
+			s.send(rpcResponse(msg.ID, result, rpcErr))
+		}()
+	}
+	wg.Wait()
+	return scanner.Err()
+}
+
+func (s *mcpServer) send(msg rpcMessage) {
+	msg.JSONRPC = "2.0"
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	s.outMu.Lock()
+	defer s.outMu.Unlock()
+	s.out.Write(append(data, '\n'))
+}
+
+func (s *mcpServer) handle(method string, params json.RawMessage) (any, *rpcError) {
+	switch method {
+	case "initialize":
+		var p struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}
+		json.Unmarshal(params, &p)
+		// The client's version if we speak it, or else ours, which the
+		// client may decline.
+		version := mcpProtocolVersion
+		if slices.Contains(mcpProtocolVersions, p.ProtocolVersion) {
+			version = p.ProtocolVersion
+		}
+		return map[string]any{
+			"protocolVersion": version,
+			"capabilities":    map[string]any{"tools": map[string]any{}},
+			"serverInfo":      map[string]any{"name": "git-fast-worktree", "version": toolVersion()},
+		}, nil
+	case "ping":
+		return map[string]any{}, nil
+	case "tools/list":
+		return map[string]any{"tools": mcpTools}, nil
+	case "tools/call":
+		var p struct {
+			Name      string          `json:"name"`
+			Arguments json.RawMessage `json:"arguments"`
+		}
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, &rpcError{rpcInvalidParams, err.Error()}
+		}
+		text, err := s.callTool(p.Name, p.Arguments)
+		if err != nil {
+			return map[string]any{"content": []map[string]string{{"type": "text", "text": err.Error()}}, "isError": true}, nil
+		}
+		return map[string]any{"content": []map[string]string{{"type": "text", "text": text}}}, nil
+	}
+	return nil, &rpcError{rpcMethodNotFound, fmt.Sprintf("unknown method '%s'", method)}
+}
+
+// worktreeRequest holds the arguments of the mcp tools and the daemon's
+// methods; each uses some of them.
+type worktreeRequest struct {
+	Repo      string   `json:"repo"`
+	Path      string   `json:"path"`
+	Branch    string   `json:"branch"`
+	Commitish string   `json:"commitish"`
+	From      string   `json:"from"`
+	Sparse    []string `json:"sparse"`
+	Exclude   []string `json:"exclude"`
+	Profile   string   `json:"profile"`
+	Force     bool     `json:"force"`
+}
+
+// addArgs returns the flags and arguments of the add command that creates
+// the requested worktree. The profile is left to the caller, as --profile
+// is not one of add's own flags.
+func (r worktreeRequest) addArgs() ([]string, error) {
+	var args []string
+	if r.Branch != "" {
+		args = append(args, "-b", r.Branch)
+	}
+	if r.From != "" {
+		args = append(args, "--from", r.From)
+	}
+	if len(r.Sparse) > 0 {
+		args = append(args, "--sparse", strings.Join(r.Sparse, ","))
+	}
+	for _, pattern := range r.Exclude {
+		args = append(args, "--exclude", pattern)
+	}
+	if r.Path != "" {
+		args = append(args, "--", r.Path)
+		if r.Commitish != "" {
+			args = append(args, r.Commitish)
+		}
+	} else if r.Commitish != "" {
+		return nil, fmt.Errorf("a path is needed to check out a commitish without creating a branch")
+	}
+	return args, nil
+}
+
+// removeArgs returns the flags and arguments of the remove command that
+// removes the requested worktree.
+func (r worktreeRequest) removeArgs() ([]string, error) {
+	if r.Path == "" {
+		return nil, fmt.Errorf("path is required")
+	}
+	args := []string{"remove"}
+	if r.Force {
+		args = append(args, "--force")
+	}
+	return append(args, "--", r.Path), nil
+}
+
+// callTool runs a tool as the equivalent command line, returning its
+// output.
+func (s *mcpServer) callTool(name string, arguments json.RawMessage) (string, error) {
+	var r worktreeRequest
+	if len(arguments) > 0 {
+		if err := json.Unmarshal(arguments, &r); err != nil {
+			return "", fmt.Errorf("invalid arguments: %v", err)
+		}
+	}
+	var args []string
+	var err error
+	switch name {
+	case "create_worktree":
+		args, err = r.addArgs()
+		if r.Profile != "" {
+			args = append([]string{"--profile", r.Profile}, args...)
+		}
+		args = append([]string{"add", "--json"}, args...)
+		s.create.Lock()
+		defer s.create.Unlock()
+	case "remove_worktree":
+		args, err = r.removeArgs()
+	case "list_worktrees":
+		args = []string{"list", "--json"}
+	default:
+		return "", fmt.Errorf("unknown tool '%s'", name)
+	}
+	if err != nil {
+		return "", err
+	}
+	out, err := runSelf(s.exe, r.Repo, args, nil)
+	return strings.TrimSpace(string(out)), err
+}
+
+// runSelf runs the binary exe with args in dir, returning its stdout, or
+// its stderr if it printed nothing there. If it fails, the error holds its
+// output. With onLine, lines of stdout go to it as they are printed
+// instead.
+func runSelf(exe, dir string, args []string, onLine func([]byte)) ([]byte, error) {
+	cmd := exec.Command(exe, args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "NO_COLOR=1")
+	var stdout, stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	var err error
+	if onLine == nil {
+		cmd.Stdout = &stdout
+		err = cmd.Run()
+	} else {
+		err = runLines(cmd, onLine)
+	}
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if stdout.Len() > 0 {
+			msg = strings.TrimSpace(stdout.String() + "\n" + msg)
+		}
+		return nil, fmt.Errorf("%s (%v)", msg, err)
+	}
+	if stdout.Len() == 0 {
+		return stderr.Bytes(), nil
+	}
+	return stdout.Bytes(), nil
+}
+
+// runLines runs cmd, passing each line of its stdout to onLine.
+func runLines(cmd *exec.Cmd, onLine func([]byte)) error {
+	pipe, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(pipe)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		onLine(scanner.Bytes())
+	}
+	io.Copy(io.Discard, pipe)
+	return cmd.Wait()
+}
@@ -0,0 +1,40 @@
+package fastworktree
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestMCPInitialize(t *testing.T) {
+	tests := []struct {
+		client string
+		want   string
+	}{
+		{mcpProtocolVersion, mcpProtocolVersion},
+		{"2024-11-05", "2024-11-05"},
+		{"2099-01-01", mcpProtocolVersion},
+		{"", mcpProtocolVersion},
+	}
+	s := &mcpServer{}
+	for _, tt := range tests {
+		params, _ := json.Marshal(map[string]string{"protocolVersion": tt.client})
+		result, rpcErr := s.handle("initialize", params)
+		if rpcErr != nil {
+			t.Fatal(rpcErr.Message)
+		}
+		if got := result.(map[string]any)["protocolVersion"]; got != tt.want {
+			t.Errorf("initialize with version %q = %v, want %s", tt.client, got, tt.want)
+		}
+	}
+}
+
+func TestRPCResponse(t *testing.T) {
+	data, _ := json.Marshal(rpcResponse(json.RawMessage("1"), nil, nil))
+	if string(data) != `{"jsonrpc":"","id":1,"result":{}}` {
+		t.Errorf("response without a result = %s, want an empty result", data)
+	}
+	data, _ = json.Marshal(rpcResponse(json.RawMessage("1"), map[string]any{"x": 1}, &rpcError{rpcServerError, "failed"}))
+	if string(data) != `{"jsonrpc":"","id":1,"error":{"code":-32000,"message":"failed"}}` {
+		t.Errorf("failed response = %s, want only the error", data)
+	}
+}
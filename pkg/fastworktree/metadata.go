@@ -0,0 +1,124 @@
+package fastworktree
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// metadataFile records how a worktree was created. It lives in the
+// worktree's administrative directory, so it never shows up in the working
+// tree and git deletes it along with the worktree.
+const metadataFile = "fast-worktree.json"
+
+// worktreeMetadata is written by add; its presence marks a worktree as
+// managed by this tool.
+type worktreeMetadata struct {
+	Created time.Time `json:"created"`
+	Source  string    `json:"source"`
+	// SourceCommit is the commit the source worktree was at when its files
+	// were cloned.
+	SourceCommit string `json:"sourceCommit,omitempty"`
+	Backend      string `json:"backend"`
+	// Branch and Commit are what was checked out when the worktree was
+	// created, and NewBranch is set if add created the branch.
+	Branch    string `json:"branch,omitempty"`
+	Commit    string `json:"commit,omitempty"`
+	NewBranch bool   `json:"newBranch,omitempty"`
+	// Flags are the add flags that were set, from the command line or
+	// config, and Version the version of the tool that created it.
+	Flags   []string `json:"flags,omitempty"`
+	Version string   `json:"version,omitempty"`
+	// Expires is set for worktrees created with --temp.
+	Expires *time.Time `json:"expires,omitempty"`
+	// Workspace is the editor workspace file written for the worktree,
+	// which is removed with it.
+	Workspace string `json:"workspace,omitempty"`
+}
+
+func writeMetadata(gitdir string, m worktreeMetadata) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(gitdir, metadataFile), append(data, '\n'), 0o644)
+}
+
+// readMetadata returns the metadata of the worktree administered in gitdir,
+// and false if it was not created by this tool.
+func readMetadata(gitdir string) (worktreeMetadata, bool) {
+	var m worktreeMetadata
+	data, err := os.ReadFile(filepath.Join(gitdir, metadataFile))
+	if err != nil || json.Unmarshal(data, &m) != nil {
+		return m, false
+	}
+	return m, true
+}
+
+// headCommit returns the commit checked out in the worktree at dir, or ""
+// if it has none.
+func headCommit(dir string) string {
+	out, err := gitCommand("-C", dir, "rev-parse", "--verify", "-q", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// addFlagsUsed are the flags of the add being run, recorded with the
+// worktrees it creates.
+var addFlagsUsed []string
+
+// changedFlags returns the flags in set that were set, as --name=value,
+// with one for each value of a list.
+func changedFlags(set *pflag.FlagSet) []string {
+	var flags []string
+	set.VisitAll(func(f *pflag.Flag) {
+		if !f.Changed {
+			return
+		}
+		values := []string{f.Value.String()}
+		if v, ok := f.Value.(pflag.SliceValue); ok {
+			values = v.GetSlice()
+		}
+		for _, value := range values {
+			if f.Value.Type() == "bool" && value == "true" {
+				flags = append(flags, "--"+f.Name)
+			} else {
+				flags = append(flags, "--"+f.Name+"="+value)
+			}
+		}
+	})
+	return flags
+}
+
+// managedWorktree is a worktree created by this tool.
+type managedWorktree struct {
+	worktreeEntry
+	gitdir string
+	meta   worktreeMetadata
+}
+
+// managedWorktrees returns the worktrees of the current repository that
+// were created by this tool and still exist on disk.
+func managedWorktrees() ([]managedWorktree, error) {
+	entries, err := listWorktrees(".")
+	if err != nil {
+		return nil, err
+	}
+	var managed []managedWorktree
+	for _, e := range entries {
+		gitdir, err := worktreeGitdir(e.Path)
+		if err != nil {
+			continue
+		}
+		if m, ok := readMetadata(gitdir); ok {
+			managed = append(managed, managedWorktree{worktreeEntry: e, gitdir: gitdir, meta: m})
+		}
+	}
+	return managed, nil
+}
@@ -0,0 +1,74 @@
+package fastworktree
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var moveForce int
+
+var moveCmd = &cobra.Command{
+	Use:   "move [flags] <worktree> <new-path>",
+	Short: "Move a worktree, keeping its blocks shared with the source",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		src, err := filepath.Abs(args[0])
+		if err != nil {
+			return fmt.Errorf("error resolving path: %w", err)
+		}
+		dst, err := filepath.Abs(args[1])
+		if err != nil {
+			return fmt.Errorf("error resolving destination path: %w", err)
+		}
+		gitdir, err := worktreeGitdir(src)
+		if err != nil {
+			return fmt.Errorf("fatal: %w", err)
+		}
+		if _, err := os.Stat(dst); err == nil {
+			return withExitCode(exitExists, fmt.Errorf("fatal: '%s' already exists", dst))
+		}
+		if _, err := os.Stat(filepath.Join(gitdir, "locked")); err == nil && moveForce < 2 {
+			return fmt.Errorf("fatal: cannot move a locked working tree, use 'move -f -f' to override or unlock first")
+		}
+		if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+			return fmt.Errorf("error creating parent directory: %w", err)
+		}
+
+		start := time.Now()
+		method := "rename"
+		if err := os.Rename(src, dst); err != nil {
+			// Renaming fails across volumes; clone the tree there instead
+			// and drop the original.
+			cloner, err := selectCloner(src, filepath.Dir(dst))
+			if err != nil {
+				console.warnf("%v\nfalling back to copy", err)
+				cloner = copyCloner{}
+			}
+			method = cloner.Name()
+			if err := cloneWith(cloner, src, dst); err != nil {
+				os.RemoveAll(dst)
+				return fmt.Errorf("error cloning worktree to %s: %w", dst, err)
+			}
+			if err := trashDir(src); err != nil {
+				return err
+			}
+		}
+
+		repairCmd := gitCommand("-C", dst, "worktree", "repair")
+		repairCmd.Stderr = stderr
+		if err := repairCmd.Run(); err != nil {
+			return gitFailed("git worktree repair")
+		}
+		recordHistory(historyEntry{Op: "move", Path: dst, From: src, Branch: currentBranch(dst)}, start)
+		console.infof("moved: %s -> %s (%s, %v)", src, dst, method, time.Since(start).Round(time.Millisecond))
+		return nil
+	},
+}
+
+func init() {
+	moveCmd.Flags().CountVarP(&moveForce, "force", "f", "give twice to move a locked worktree")
+}
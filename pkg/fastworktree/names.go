@@ -0,0 +1,123 @@
+package fastworktree
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// checkPathNames reconciles the names of the cloned files in dst with the
+// paths in its freshly reset index, which git compares byte for byte:
+//
+//   - a non-ASCII name stored on disk in another Unicode normalization (NFD
+//     from HFS+ versus NFC in the index, say) is renamed to the index's
+//     form, since git would otherwise report it as deleted and untracked;
+//   - on a case-insensitive volume, tracked paths that differ only by case
+//     cannot all exist, so they are reported rather than left to show up as
+//     unexplained modifications.
+//
+// It returns the number of names changed.
+func checkPathNames(dst string, log logger) (int, error) {
+	out, err := gitCommand("-C", dst, "ls-files", "-z").Output()
+	if err != nil {
+		return 0, fmt.Errorf("git ls-files: %w", err)
+	}
+	paths := strings.Split(strings.TrimSuffix(string(out), "\x00"), "\x00")
+
+	if insensitive, err := caseInsensitive(dst); err == nil && insensitive {
+		folded := make(map[string][]string)
+		for _, path := range paths {
+			key := strings.ToLower(path)
+			folded[key] = append(folded[key], path)
+		}
+		for _, group := range folded {
+			if len(group) > 1 {
+				log.warnf("%s differ only by case and cannot all be checked out on this case-insensitive volume", strings.Join(group, ", "))
+			}
+		}
+	}
+
+	listings := make(map[string]map[string]bool)
+	var renamed int
+	for _, path := range paths {
+		if isASCII(path) {
+			continue
+		}
+		parts := strings.Split(path, "/")
+		dir := dst
+		for _, part := range parts {
+			if !isASCII(part) {
+				ok, err := matchName(dir, part, listings)
+				if err != nil {
+					return renamed, err
+				}
+				if ok {
+					renamed++
+				}
+			}
+			dir = filepath.Join(dir, part)
+		}
+	}
+	return renamed, nil
+}
+
+// matchName makes sure dir contains an entry named exactly name. If the
+// volume instead resolves name to an entry spelled differently, that entry
+// is renamed to name and matchName reports true. Directory listings are
+// cached in listings.
+func matchName(dir, name string, listings map[string]map[string]bool) (bool, error) {
+	entries, ok := listings[dir]
+	if !ok {
+		names, err := readDirNames(dir)
+		if err != nil {
+			return false, nil
+		}
+		entries = make(map[string]bool, len(names))
+		for _, n := range names {
+			entries[n] = true
+		}
+		listings[dir] = entries
+	}
+	if entries[name] {
+		return false, nil
+	}
+	want, err := os.Lstat(filepath.Join(dir, name))
+	if err != nil {
+		return false, nil
+	}
+	for entry := range entries {
+		if isASCII(entry) {
+			continue
+		}
+		if info, err := os.Lstat(filepath.Join(dir, entry)); err == nil && os.SameFile(want, info) {
+			if err := os.Rename(filepath.Join(dir, entry), filepath.Join(dir, name)); err != nil {
+				return false, err
+			}
+			delete(entries, entry)
+			entries[name] = true
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// readDirNames returns the names in dir, as stored on disk.
+func readDirNames(dir string) ([]string, error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return f.Readdirnames(-1)
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
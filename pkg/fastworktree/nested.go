@@ -0,0 +1,58 @@
+package fastworktree
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// nestedRepos returns the untracked or ignored directories of the worktree
+// at src that are git repositories of their own. Git lists a nested
+// repository as a single directory and never looks inside, so untracked
+// ones are found at any depth without walking the tree. Ignored directories
+// are listed collapsed, so only those that are repositories themselves are
+// found. Submodules are tracked and not included.
+func nestedRepos(src string) ([]string, error) {
+	untracked, err := gitCommand("-C", src, "ls-files", "--others", "--exclude-standard", "-z").Output()
+	if err != nil {
+		return nil, fmt.Errorf("git ls-files: %w", err)
+	}
+	ignored, err := gitCommand("-C", src, "ls-files", "--others", "--ignored", "--exclude-standard", "--directory", "-z").Output()
+	if err != nil {
+		return nil, fmt.Errorf("git ls-files: %w", err)
+	}
+	var repos []string
+	for _, path := range strings.Split(string(untracked)+string(ignored), "\x00") {
+		dir, ok := strings.CutSuffix(path, "/")
+		if !ok {
+			continue
+		}
+		if _, err := os.Lstat(filepath.Join(src, filepath.FromSlash(dir), ".git")); err == nil {
+			repos = append(repos, dir)
+		}
+	}
+	return repos, nil
+}
+
+// handleNestedRepos applies --nested-repos to the clone in dst: skip deletes
+// each nested repository, strip only its .git, turning it into plain files.
+func handleNestedRepos(dst string, repos []string) error {
+	for _, repo := range repos {
+		path := filepath.Join(dst, filepath.FromSlash(repo))
+		switch nestedMode {
+		case "skip":
+			if err := os.RemoveAll(path); err != nil {
+				return err
+			}
+			if err := removeFile(dst, path); err != nil {
+				return err
+			}
+		case "strip":
+			if err := os.RemoveAll(filepath.Join(path, ".git")); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package fastworktree
+
+import (
+	"os"
+	"strings"
+)
+
+var openCommand string
+
+// openWorktree runs the --open command on the new worktree at dst: an
+// editor such as code, cursor, idea or zed, to which the path is passed,
+// or a shell command using $GFW_WORKTREE. It waits for the command, which
+// for graphical editors returns once the window is open, and only warns if
+// it fails, since the worktree is there either way.
+func openWorktree(dst string) {
+	if openCommand == "" {
+		return
+	}
+	command := openCommand
+	if !strings.Contains(command, "GFW_WORKTREE") {
+		command += ` "$GFW_WORKTREE"`
+	}
+	cmd := shellCommand([]string{command})
+	cmd.Env = append(os.Environ(), "GFW_WORKTREE="+dst)
+	cmd.Dir = dst
+	// Stdout is for the worktree's path; terminal editors use stderr's
+	// terminal instead.
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stderr, os.Stderr
+	if err := cmd.Run(); err != nil {
+		console.warnf("--open %s: %v", openCommand, err)
+	}
+}
@@ -0,0 +1,146 @@
+package fastworktree
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	quiet     bool
+	verbosity int
+	logFile   string
+	logLevel  string
+	// stderr is where progress, warnings and git's own messages go; Go
+	// programs using the package choose it with Options.Log.
+	stderr io.Writer = os.Stderr
+	// slogger is the structured log: --log-file on the command line, and
+	// Options.Logger for calls through the API.
+	slogger = slog.New(slog.DiscardHandler)
+)
+
+// console is the logger for output that is not tied to one worktree.
+var console logger
+
+// printWorktree writes the path of a new worktree to stdout, where scripts
+// can take it from with cd "$(git fast-worktree add ...)", unless stdout is
+// taken by --json or --progress=ndjson, or it is not this program's.
+// Everything else goes to stderr.
+func printWorktree(path string) {
+	if !jsonOutput && progress != "ndjson" && !embedded {
+		fmt.Println(colorize(os.Stdout, colorBold, path))
+	}
+}
+
+// setupLogging sends structured logs to --log-file, at --log-level and
+// above, whatever -q and -v say about the human-readable output. Without
+// --log-file they are discarded.
+func setupLogging() error {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(logLevel)); err != nil {
+		return fmt.Errorf("fatal: invalid --log-level '%s' (expected debug, info, warn or error)", logLevel)
+	}
+	if logFile == "" {
+		return nil
+	}
+	f, err := os.OpenFile(logFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o666)
+	if err != nil {
+		return fmt.Errorf("fatal: opening log file: %w", err)
+	}
+	slogger = slog.New(slog.NewTextHandler(f, &slog.HandlerOptions{Level: level})).With("pid", os.Getpid())
+	return nil
+}
+
+// logger writes human-readable progress to stderr, prefixing every line
+// with prefix, and every message to the structured log with attrs. Batch
+// add gives each worktree its own prefix, and with --json a report that
+// warnings and timings are also recorded in. While add clones, lines are
+// printed above its progress bar.
+type logger struct {
+	prefix   string
+	attrs    []any
+	report   *addReport
+	progress *progressBar
+}
+
+// with returns l with more attributes for the structured log.
+func (l logger) with(attrs ...any) logger {
+	l.attrs = slices.Concat(l.attrs, attrs)
+	return l
+}
+
+// log writes msg to the structured log.
+func (l logger) log(level slog.Level, msg string, attrs ...any) {
+	if msg = strings.TrimSpace(msg); msg == "" || !slogger.Enabled(context.Background(), level) {
+		return
+	}
+	slogger.Log(context.Background(), level, msg, slices.Concat(l.attrs, attrs)...)
+}
+
+func (l logger) write(msg string) {
+	l.progress.above(func() {
+		fmt.Fprintln(stderr, l.prefix+strings.ReplaceAll(msg, "\n", "\n"+l.prefix))
+	})
+}
+
+// printf always prints, whatever the verbosity. It is used for warnings and
+// errors.
+func (l logger) printf(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	l.log(slog.LevelInfo, msg)
+	l.write(msg)
+}
+
+// infof prints progress and timing lines, which -q suppresses.
+func (l logger) infof(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	l.log(slog.LevelInfo, msg)
+	if !quiet {
+		l.write(dimTimings(msg))
+	}
+}
+
+// verbosef prints detail shown only with at least level -v flags.
+func (l logger) verbosef(level int, format string, args ...any) {
+	show := !quiet && verbosity >= level
+	if !show && !slogger.Enabled(context.Background(), slog.LevelDebug) {
+		return
+	}
+	msg := fmt.Sprintf(format, args...)
+	l.log(slog.LevelDebug, msg)
+	if show {
+		l.write(msg)
+	}
+}
+
+// warnf prints a warning, even with -q.
+func (l logger) warnf(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	l.report.warn(msg)
+	l.log(slog.LevelWarn, msg)
+	l.write(colorize(os.Stderr, colorYellow, "warning:") + " " + msg)
+}
+
+// start records that a phase of add has started, returning the time it
+// did.
+func (l logger) start(phase string) time.Time {
+	l.log(slog.LevelDebug, "phase started", "phase", phase)
+	return l.report.start(phase)
+}
+
+// phase records how long a phase of add took.
+func (l logger) phase(phase string, d time.Duration) {
+	l.log(slog.LevelInfo, "phase done", "phase", phase, "duration", d)
+	l.report.phase(phase, d)
+}
+
+// entryCloned records how long cloning one entry took.
+func (l logger) entryCloned(entry string, d time.Duration) {
+	l.log(slog.LevelDebug, "entry cloned", "entry", entry, "duration", d)
+	l.report.entryCloned(entry, d)
+}
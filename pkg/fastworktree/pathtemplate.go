@@ -0,0 +1,63 @@
+package fastworktree
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+var (
+	worktreeRoot string
+	pathTemplate string
+)
+
+// unsafePathChars matches the runs of characters sanitize replaces.
+var unsafePathChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// sanitize makes a branch name usable as a single path component:
+// "feat/x" becomes "feat-x".
+func sanitize(s string) string {
+	return strings.Trim(unsafePathChars.ReplaceAllString(s, "-"), "-.")
+}
+
+// defaultWorktreePath returns where a worktree on branch goes when no path
+// is given: --path-template rendered in --root, which is relative to the
+// main worktree (or a bare repository's directory) rather than the current
+// directory, so it is the same from every worktree.
+func defaultWorktreePath(branch string) (string, error) {
+	common, err := gitCommonDir()
+	if err != nil {
+		return "", notRepo(err)
+	}
+	main := common
+	if filepath.Base(common) == ".git" {
+		main = filepath.Dir(common)
+	}
+
+	tmpl, err := template.New("path-template").
+		Funcs(template.FuncMap{"sanitize": sanitize, "lower": strings.ToLower}).
+		Option("missingkey=error").
+		Parse(pathTemplate)
+	if err != nil {
+		return "", fmt.Errorf("fatal: invalid --path-template: %w", err)
+	}
+	var name strings.Builder
+	data := struct{ Repo, Branch string }{
+		Repo:   strings.TrimSuffix(filepath.Base(main), ".git"),
+		Branch: branch,
+	}
+	if err := tmpl.Execute(&name, data); err != nil {
+		return "", fmt.Errorf("fatal: invalid --path-template: %w", err)
+	}
+	if strings.TrimSpace(name.String()) == "" {
+		return "", fmt.Errorf("fatal: --path-template gives an empty path for branch '%s'", branch)
+	}
+
+	root := worktreeRoot
+	if !filepath.IsAbs(root) {
+		root = filepath.Join(main, root)
+	}
+	return filepath.Join(root, name.String()), nil
+}
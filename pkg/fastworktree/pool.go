@@ -0,0 +1,260 @@
+package fastworktree
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	poolSize  int
+	poolClean bool
+	fromPool  bool
+)
+
+var poolCmd = &cobra.Command{
+	Use:   "pool",
+	Short: "Keep pre-created worktrees ready for add --from-pool",
+	Long: "Manages a pool of detached worktrees under .git/fast-worktree/pool. add\n" +
+		"--from-pool moves one into place and checks out the requested commit or branch\n" +
+		"in it, which only touches the files that differ.",
+}
+
+var poolFillCmd = &cobra.Command{
+	Use:   "fill [flags]",
+	Short: "Create worktrees until the pool holds -n of them",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		src, err := gitToplevel()
+		if err != nil {
+			return notRepo(err)
+		}
+		handleInterrupts()
+		return fillPool(src, poolSize)
+	},
+}
+
+// fillPool creates worktrees from src until the pool holds size of them.
+func fillPool(src string, size int) error {
+	pooled, err := pooledWorktrees()
+	if err != nil {
+		return err
+	}
+	toClone, sparse, err := sourceClone(src)
+	if err != nil {
+		return err
+	}
+	// Pooled worktrees end up on other commits, so with --clean they start
+	// out as an exact copy of HEAD.
+	clean = poolClean
+	for range size - len(pooled) {
+		dst, err := poolPath()
+		if err != nil {
+			return err
+		}
+		spec := worktreeSpec{dst: dst, sparse: sparse, partial: partialClone(src)}
+		if err := addWorktree(src, spec, toClone, console); err != nil {
+			return err
+		}
+		console.infof("pooled: %s", dst)
+	}
+	return nil
+}
+
+var poolListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the pooled worktrees",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		pooled, err := pooledWorktrees()
+		if err != nil {
+			return err
+		}
+		for _, path := range pooled {
+			fmt.Println(path)
+		}
+		return nil
+	},
+}
+
+var poolClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Remove every pooled worktree",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		pooled, err := pooledWorktrees()
+		if err != nil {
+			return err
+		}
+		for _, path := range pooled {
+			gitdir, err := worktreeGitdir(path)
+			if err != nil {
+				continue
+			}
+			if err := removeWorktree(path, gitdir); err != nil {
+				console.warnf("could not remove %s: %v", path, err)
+				continue
+			}
+			console.infof("removed: %s", path)
+		}
+		return nil
+	},
+}
+
+// poolRoot returns the directory pooled worktrees are kept in,
+// .git/fast-worktree/pool in the main repository.
+func poolRoot() (string, error) {
+	common, err := gitCommonDir()
+	if err != nil {
+		return "", notRepo(err)
+	}
+	return filepath.Join(common, "fast-worktree", "pool"), nil
+}
+
+// poolPath returns an unused path in the pool.
+func poolPath() (string, error) {
+	root, err := poolRoot()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return "", fmt.Errorf("error creating pool: %w", err)
+	}
+	dst, err := os.MkdirTemp(root, "pool-")
+	if err != nil {
+		return "", fmt.Errorf("error creating pool worktree path: %w", err)
+	}
+	return dst, os.Remove(dst)
+}
+
+// pooledWorktrees returns the paths of the worktrees in the pool.
+func pooledWorktrees() ([]string, error) {
+	root, err := poolRoot()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(root)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	var pooled []string
+	for _, e := range entries {
+		path := filepath.Join(root, e.Name())
+		if _, err := worktreeGitdir(path); err == nil {
+			pooled = append(pooled, path)
+		}
+	}
+	return pooled, nil
+}
+
+// isPooled reports whether path is in the pool, however either is spelled.
+func isPooled(path string) bool {
+	root, err := poolRoot()
+	if err != nil {
+		return false
+	}
+	path, root = realPath(path), realPath(root)
+	return path != root && isWithin(path, root)
+}
+
+// addFromPool creates the worktree described by spec by moving a pooled
+// worktree to spec.dst and checking out the requested commit or branch in
+// it. It reports false if the pool is empty.
+func addFromPool(src string, spec worktreeSpec, log logger) (bool, error) {
+	log = log.with("repo", src, "dst", spec.dst)
+	pooled, err := pooledWorktrees()
+	if err != nil {
+		return false, err
+	}
+	total := log.start("pool")
+	var claimed string
+	if err := os.MkdirAll(filepath.Dir(spec.dst), 0o777); err != nil {
+		return false, fmt.Errorf("fatal: %w", err)
+	}
+	// Renaming claims the worktree, so concurrent adds never share one.
+	for _, path := range pooled {
+		if os.Rename(path, spec.dst) == nil {
+			claimed = path
+			break
+		}
+	}
+	if claimed == "" {
+		return false, nil
+	}
+	// repair reports the gitdir it fixes, which is expected here.
+	if out, err := gitCommand("-C", src, "worktree", "repair", spec.dst).CombinedOutput(); err != nil {
+		return true, fmt.Errorf("git worktree repair failed: %s", out)
+	}
+
+	checkoutArgs := []string{"-C", spec.dst, "checkout", "--quiet"}
+	switch {
+	case spec.branchCreate != "":
+		checkoutArgs = append(checkoutArgs, "-b", spec.branchCreate)
+	case spec.branchReset != "":
+		checkoutArgs = append(checkoutArgs, "-B", spec.branchReset)
+	case !spec.attach:
+		checkoutArgs = append(checkoutArgs, "--detach")
+	}
+	if spec.track || track {
+		checkoutArgs = append(checkoutArgs, "--track")
+	}
+	if noTrack {
+		checkoutArgs = append(checkoutArgs, "--no-track")
+	}
+	commitish := spec.commitish
+	if commitish == "" {
+		// Like add, default to the source's HEAD rather than the commit
+		// the pooled worktree was created at.
+		out, err := gitCommand("-C", src, "rev-parse", "--verify", "-q", "HEAD").Output()
+		if err != nil {
+			return true, fmt.Errorf("fatal: resolving HEAD of %s: %w", src, err)
+		}
+		commitish = string(out[:len(out)-1])
+	}
+	if err := runGit(append(checkoutArgs, commitish)...); err != nil {
+		return true, fmt.Errorf("git checkout failed; the pooled worktree is at '%s'", spec.dst)
+	}
+	if lock {
+		lockArgs := []string{"-C", src, "worktree", "lock"}
+		if reason != "" {
+			lockArgs = append(lockArgs, "--reason", reason)
+		}
+		if err := runGit(append(lockArgs, spec.dst)...); err != nil {
+			return true, gitFailed("git worktree lock")
+		}
+	}
+
+	var workspace string
+	if codeWorkspace {
+		if workspace, err = writeCodeWorkspace(src, spec.dst); err != nil {
+			log.warnf("%v", err)
+		}
+	}
+	// The files were cloned when the pool was filled, from the commit its
+	// metadata recorded.
+	var sourceCommit string
+	if gitdir, err := worktreeGitdir(spec.dst); err == nil {
+		pooledMeta, _ := readMetadata(gitdir)
+		sourceCommit = pooledMeta.SourceCommit
+	}
+	recordMetadata(spec.dst, worktreeMetadata{Created: time.Now(), Source: src, SourceCommit: sourceCommit, Backend: "pool", NewBranch: spec.branchCreate != "", Expires: spec.expires, Workspace: workspace}, log)
+	if err := applyWtConfig(spec.dst, log); err != nil {
+		return true, err
+	}
+	checkHooks(src, spec.dst, log)
+	trustWorktree(spec.dst, log)
+	excludeWorktree(spec.dst, log)
+	log.infof("pool:         %s (%v)", filepath.Base(claimed), time.Since(total).Round(time.Millisecond))
+	log.report.cloned("pool", 0)
+	log.phase("pool", time.Since(total))
+	return true, nil
+}
+
+func init() {
+	poolFillCmd.Flags().IntVarP(&poolSize, "size", "n", 3, "number of worktrees to keep in the pool")
+	poolFillCmd.Flags().BoolVar(&poolClean, "clean", false, "restore modified files and delete untracked and ignored ones, so pooled worktrees match HEAD exactly")
+	poolCmd.AddCommand(poolFillCmd, poolListCmd, poolClearCmd)
+}
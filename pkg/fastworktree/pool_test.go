@@ -0,0 +1,32 @@
+package fastworktree
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIsPooled(t *testing.T) {
+	repo := newTestRepo(t)
+	t.Chdir(repo)
+	link := filepath.Join(filepath.Dir(repo), "link")
+	if err := os.Symlink(repo, link); err != nil {
+		t.Skip(err)
+	}
+
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{filepath.Join(repo, ".git", "fast-worktree", "pool", "pool-1"), true},
+		{filepath.Join(link, ".git", "fast-worktree", "pool", "pool-1"), true},
+		{filepath.Join(repo, ".git", "fast-worktree", "pool"), false},
+		{filepath.Join(repo, ".git", "fast-worktree", "pool-1"), false},
+		{filepath.Join(filepath.Dir(repo), "wt"), false},
+	}
+	for _, tt := range tests {
+		if got := isPooled(tt.path); got != tt.want {
+			t.Errorf("isPooled(%s) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
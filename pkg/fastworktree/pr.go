@@ -0,0 +1,41 @@
+package fastworktree
+
+import (
+	"cmp"
+	"fmt"
+	"strings"
+)
+
+// fetchPullRequest fetches the head of pull request prNumber and points spec
+// at it on a pr-<number> branch, reset if it already exists so re-running
+// picks up new pushes. GitHub publishes pull requests as refs/pull/<n>/head
+// and GitLab merge requests as refs/merge-requests/<n>/head; the remote's
+// URL decides which is used.
+func fetchPullRequest(src string, spec *worktreeSpec) error {
+	remote := cmp.Or(fetchRemote, "origin")
+	out, err := gitCommand("-C", src, "remote", "get-url", remote).Output()
+	if err != nil {
+		return fmt.Errorf("fatal: no remote named '%s'", remote)
+	}
+	ref := fmt.Sprintf("refs/pull/%d/head", prNumber)
+	if strings.Contains(string(out), "gitlab") {
+		ref = fmt.Sprintf("refs/merge-requests/%d/head", prNumber)
+	}
+
+	fetchArgs := []string{"-C", src, "fetch"}
+	if quiet {
+		fetchArgs = append(fetchArgs, "--quiet")
+	}
+	if err := runGit(append(fetchArgs, remote, ref)...); err != nil {
+		return fmt.Errorf("fatal: could not fetch %s from %s", ref, remote)
+	}
+	out, err = gitCommand("-C", src, "rev-parse", "--verify", "-q", "FETCH_HEAD").Output()
+	if err != nil {
+		return fmt.Errorf("fatal: could not resolve FETCH_HEAD after fetching %s", ref)
+	}
+
+	spec.branchReset = fmt.Sprintf("pr-%d", prNumber)
+	spec.commitish = strings.TrimSpace(string(out))
+	console.infof("pr:           #%d -> %s (%s)", prNumber, spec.branchReset, spec.commitish[:min(12, len(spec.commitish))])
+	return nil
+}
@@ -0,0 +1,179 @@
+package fastworktree
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// progressDelay is how long a clone runs before it gets a progress bar.
+// Fallback copies get one straight away.
+const progressDelay = time.Second
+
+// progressBar draws the progress of the clone phase on the last line of
+// stderr. Backends that clone file by file, and copies, are measured in
+// files and bytes against the size of HEAD; ones that clone whole
+// directories only in entries, since their files are never seen. Its
+// methods do nothing on a nil bar, which is what startProgress returns
+// when there is no terminal to draw on.
+type progressBar struct {
+	files, bytes atomic.Int64
+	queue        *workQueue
+	perFile      bool
+	start        time.Time
+
+	mu    sync.Mutex
+	drawn bool
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// startProgress starts drawing the progress of cloning src through queue,
+// unless output is quiet, prefixed for a batch or not to a terminal.
+func startProgress(src string, queue *workQueue, cloner Cloner, log logger) *progressBar {
+	if quiet || log.prefix != "" || !isTerminal(os.Stderr) {
+		return nil
+	}
+	b := &progressBar{
+		queue:   queue,
+		perFile: !cloner.SupportsDir(),
+		start:   time.Now(),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	delay := progressDelay
+	if _, ok := fallbacks[cloner.Name()]; ok {
+		delay = 0
+	}
+	go b.run(src, delay)
+	return b
+}
+
+func (b *progressBar) run(src string, delay time.Duration) {
+	defer close(b.done)
+	select {
+	case <-b.stop:
+		return
+	case <-time.After(delay):
+	}
+	var totalFiles, totalBytes int64
+	if b.perFile {
+		totalFiles, totalBytes = indexEntries(src), trackedSize(src)
+	}
+	tick := time.NewTicker(200 * time.Millisecond)
+	defer tick.Stop()
+	for {
+		b.mu.Lock()
+		b.draw(totalFiles, totalBytes)
+		b.mu.Unlock()
+		select {
+		case <-b.stop:
+			b.mu.Lock()
+			b.clear()
+			b.mu.Unlock()
+			return
+		case <-tick.C:
+		}
+	}
+}
+
+// draw replaces the bar with the current progress. The totals are only
+// estimates, since untracked files are cloned too, so it never quite
+// reaches the end before the clone does.
+func (b *progressBar) draw(totalFiles, totalBytes int64) {
+	var fraction float64
+	var detail string
+	if b.perFile {
+		files, bytes := b.files.Load(), b.bytes.Load()
+		if totalBytes > 0 {
+			fraction = float64(bytes) / float64(totalBytes)
+		} else if totalFiles > 0 {
+			fraction = float64(files) / float64(totalFiles)
+		}
+		detail = fmt.Sprintf("%d/%d files, %s/%s", files, totalFiles, formatBytes(bytes), formatBytes(totalBytes))
+	} else {
+		done, total := b.queue.progress()
+		if total > 0 {
+			fraction = float64(done) / float64(total)
+		}
+		detail = fmt.Sprintf("%d/%d entries", done, total)
+	}
+	fraction = min(fraction, 0.99)
+
+	const width = 30
+	filled := int(fraction * width)
+	bar := strings.Repeat("=", filled) + ">" + strings.Repeat(" ", width-filled)
+	eta := "?"
+	if fraction > 0 {
+		elapsed := time.Since(b.start)
+		eta = (time.Duration(float64(elapsed)/fraction) - elapsed).Round(time.Second).String()
+	}
+	fmt.Fprintf(os.Stderr, "\r\033[Kcloning [%s] %3.0f%% %s, ETA %s", bar, fraction*100, detail, eta)
+	b.drawn = true
+}
+
+func (b *progressBar) clear() {
+	if b.drawn {
+		fmt.Fprint(os.Stderr, "\r\033[K")
+		b.drawn = false
+	}
+}
+
+// above runs print, which writes a line to stderr, with the bar cleared
+// out of its way. The bar is drawn again on its next update.
+func (b *progressBar) above(print func()) {
+	if b == nil {
+		print()
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.clear()
+	print()
+}
+
+// finish removes the bar once the clone phase is over.
+func (b *progressBar) finish() {
+	if b == nil {
+		return
+	}
+	close(b.stop)
+	<-b.done
+}
+
+// counting returns clone, counting the regular files it clones on b.
+func (b *progressBar) counting(clone func(src, dst string) error) func(src, dst string) error {
+	if b == nil {
+		return clone
+	}
+	return func(src, dst string) error {
+		if err := clone(src, dst); err != nil {
+			return err
+		}
+		if info, err := os.Lstat(dst); err == nil && info.Mode().IsRegular() {
+			b.files.Add(1)
+			b.bytes.Add(info.Size())
+		}
+		return nil
+	}
+}
+
+// countingCloner is a Cloner whose clones are counted on bar.
+type countingCloner struct {
+	Cloner
+	bar *progressBar
+}
+
+func (c countingCloner) Clone(src, dst string) error {
+	return c.bar.counting(c.Cloner.Clone)(src, dst)
+}
+
+func (c countingCloner) sourcePath(src string) string {
+	if m, ok := c.Cloner.(sourceMapper); ok {
+		return m.sourcePath(src)
+	}
+	return src
+}
@@ -0,0 +1,15 @@
+package fastworktree
+
+import "strings"
+
+// partialClone reports whether the repository at src was cloned with
+// --filter, so some blobs may only exist on a promisor remote and reading
+// them fetches them one batch at a time.
+func partialClone(src string) bool {
+	out, _ := gitCommand("-C", src, "config", "extensions.partialClone").Output()
+	if strings.TrimSpace(string(out)) != "" {
+		return true
+	}
+	out, _ = gitCommand("-C", src, "config", "--bool", "--get-regexp", `^remote\..*\.promisor$`).Output()
+	return strings.Contains(string(out), " true")
+}
@@ -0,0 +1,247 @@
+package fastworktree
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	pruneExpired   bool
+	pruneOlderThan string
+	pruneIdle      string
+	pruneMerged    bool
+	pruneBase      string
+	pruneDryRun    bool
+	pruneForce     bool
+)
+
+var pruneCmd = &cobra.Command{
+	Use:   "prune [flags]",
+	Short: "Prune stale worktree records, and expired or finished worktrees",
+	Long: "Runs git worktree prune. With --expired, first removes every worktree created\n" +
+		"with add --temp whose --ttl has passed, unless it is locked or, without\n" +
+		"--force, holds uncommitted changes, stashes or unpushed commits.\n\n" +
+		"--older-than, --idle and --merged remove the worktrees created by this tool\n" +
+		"that match all of those given: created longer ago than --older-than, with no\n" +
+		"commit or checkout for longer than --idle, and with HEAD merged into --base or\n" +
+		"a branch whose upstream has been deleted. Ages are durations such as 36h, 14d\n" +
+		"or 2w. Worktrees with uncommitted changes or unpushed commits, locked ones and\n" +
+		"the current one are kept.",
+	Example: "  git-fast-worktree prune --expired\n" +
+		"  git-fast-worktree prune --older-than 14d --merged --dry-run",
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		verb := "pruned"
+		if pruneDryRun {
+			verb = "would prune"
+		}
+		if pruneExpired {
+			managed, err := managedWorktrees()
+			if err != nil {
+				return fmt.Errorf("fatal: %w", err)
+			}
+			base := defaultBase()
+			now := time.Now()
+			for _, e := range managed {
+				if e.meta.Expires == nil || e.meta.Expires.After(now) || e.Locked {
+					continue
+				}
+				if !pruneForce {
+					work, err := findWorkAtRisk(e.Path, e.Branch, base, false)
+					if err != nil {
+						console.warnf("kept: %s (%v)", e.Path, err)
+						continue
+					}
+					if work.summary() != "" {
+						console.warnf("kept: %s has expired, but holds work that removing it would lose, use --force to delete it anyway:\n%s", e.Path, work.details())
+						continue
+					}
+				}
+				if err := pruneWorktree(e); err != nil {
+					console.warnf("could not remove %s: %v", e.Path, err)
+					continue
+				}
+				console.infof("%s: %s", verb, e.Path)
+			}
+		}
+		if pruneOlderThan != "" || pruneIdle != "" || pruneMerged {
+			if err := pruneStale(verb); err != nil {
+				return err
+			}
+		}
+
+		pruneArgs := []string{"worktree", "prune"}
+		if pruneDryRun {
+			pruneArgs = append(pruneArgs, "--dry-run", "--verbose")
+		}
+		if err := runGit(pruneArgs...); err != nil {
+			return gitFailed("git worktree prune")
+		}
+		return nil
+	},
+}
+
+// pruneStale removes the managed worktrees that --older-than, --idle and
+// --merged select and that hold no work.
+func pruneStale(verb string) error {
+	var olderThan, idle time.Duration
+	var err error
+	if pruneOlderThan != "" {
+		if olderThan, err = parseAge(pruneOlderThan); err != nil {
+			return fmt.Errorf("fatal: invalid --older-than '%s' (expected e.g. 36h, 14d or 2w)", pruneOlderThan)
+		}
+	}
+	if pruneIdle != "" {
+		if idle, err = parseAge(pruneIdle); err != nil {
+			return fmt.Errorf("fatal: invalid --idle '%s' (expected e.g. 36h, 14d or 2w)", pruneIdle)
+		}
+	}
+	// Commits in the default branch, or --base, are not lost with a
+	// worktree.
+	base := defaultBase()
+	var gone map[string]bool
+	if pruneMerged {
+		if base, err = mergeBase(); err != nil {
+			return err
+		}
+		gone = goneBranches()
+	}
+
+	managed, err := managedWorktrees()
+	if err != nil {
+		return fmt.Errorf("fatal: %w", err)
+	}
+	current, _ := gitToplevel()
+	now := time.Now()
+	for _, e := range managed {
+		if e.Locked || e.Prunable != "" || (current != "" && realPath(e.Path) == realPath(current)) || isPooled(e.Path) {
+			continue
+		}
+		if olderThan > 0 && now.Sub(e.meta.Created) < olderThan {
+			continue
+		}
+		if idle > 0 && now.Sub(lastActivity(e)) < idle {
+			continue
+		}
+		if pruneMerged && !gone[e.Branch] && gitCommand("-C", e.Path, "merge-base", "--is-ancestor", "HEAD", base).Run() != nil {
+			continue
+		}
+		if reason := unfinishedWork(e, base, gone[e.Branch]); reason != "" {
+			console.verbosef(1, "kept: %s (%s)", e.Path, reason)
+			continue
+		}
+		if err := pruneWorktree(e); err != nil {
+			console.warnf("could not remove %s: %v", e.Path, err)
+			continue
+		}
+		console.infof("%s: %s", verb, e.Path)
+	}
+	return nil
+}
+
+// pruneWorktree removes e, unless this is a --dry-run.
+func pruneWorktree(e managedWorktree) error {
+	if pruneDryRun {
+		return nil
+	}
+	start := time.Now()
+	if err := removeWorktree(e.Path, e.gitdir); err != nil {
+		return err
+	}
+	recordHistory(historyEntry{Op: "prune", Path: e.Path, Branch: e.Branch}, start)
+	return nil
+}
+
+// parseAge parses a duration as time.ParseDuration does, and also whole
+// days and weeks, such as 14d and 2w.
+func parseAge(s string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if n, ok := strings.CutSuffix(s, suffix); ok {
+			days, err := strconv.Atoi(n)
+			if err != nil || days < 0 {
+				return 0, fmt.Errorf("invalid age %q", s)
+			}
+			return time.Duration(days) * unit, nil
+		}
+	}
+	return time.ParseDuration(s)
+}
+
+// mergeBase returns the ref --merged checks worktrees against: --base, or
+// else defaultBase.
+func mergeBase() (string, error) {
+	if pruneBase != "" {
+		if err := gitCommand("rev-parse", "--verify", "-q", pruneBase+"^{commit}").Run(); err != nil {
+			return "", fmt.Errorf("fatal: --base '%s' is not a commit", pruneBase)
+		}
+		return pruneBase, nil
+	}
+	if base := defaultBase(); base != "" {
+		return base, nil
+	}
+	return "", fmt.Errorf("fatal: no branch to check --merged against, use --base")
+}
+
+// defaultBase returns origin's default branch, or else the branch of the
+// main worktree, or "" if there is neither.
+func defaultBase() string {
+	if out, err := gitCommand("symbolic-ref", "-q", "--short", "refs/remotes/origin/HEAD").Output(); err == nil {
+		return strings.TrimSpace(string(out))
+	}
+	if entries, err := listWorktrees("."); err == nil && len(entries) > 0 {
+		return entries[0].Branch
+	}
+	return ""
+}
+
+// goneBranches returns the local branches whose upstream has been deleted,
+// as happens when a merged pull request's branch is deleted.
+func goneBranches() map[string]bool {
+	out, err := gitCommand("for-each-ref", "--format=%(upstream:track) %(refname:short)", "refs/heads").Output()
+	if err != nil {
+		return nil
+	}
+	gone := make(map[string]bool)
+	for _, line := range strings.Split(string(out), "\n") {
+		if branch, ok := strings.CutPrefix(line, "[gone] "); ok {
+			gone[branch] = true
+		}
+	}
+	return gone
+}
+
+// lastActivity returns when e's HEAD last moved, by a commit, checkout or
+// reset, or when it was created if that was later.
+func lastActivity(e managedWorktree) time.Time {
+	last := e.meta.Created
+	if info, err := os.Stat(filepath.Join(e.gitdir, "logs", "HEAD")); err == nil && info.ModTime().After(last) {
+		last = info.ModTime()
+	}
+	return last
+}
+
+// unfinishedWork returns a summary of the work e holds, or "" if it holds
+// none (see findWorkAtRisk).
+func unfinishedWork(e managedWorktree, base string, upstreamGone bool) string {
+	work, err := findWorkAtRisk(e.Path, e.Branch, base, upstreamGone)
+	if err != nil {
+		return err.Error()
+	}
+	return work.summary()
+}
+
+func init() {
+	pruneCmd.Flags().BoolVar(&pruneExpired, "expired", false, "remove temporary worktrees whose --ttl has passed")
+	pruneCmd.Flags().StringVar(&pruneOlderThan, "older-than", "", "remove worktrees created longer ago than this, e.g. 14d")
+	pruneCmd.Flags().StringVar(&pruneIdle, "idle", "", "remove worktrees with no commit or checkout for this long, e.g. 7d")
+	pruneCmd.Flags().BoolVar(&pruneMerged, "merged", false, "remove worktrees merged into --base or whose upstream branch was deleted")
+	pruneCmd.Flags().StringVar(&pruneBase, "base", "", "branch --merged checks against (default: origin's default branch)")
+	pruneCmd.Flags().BoolVarP(&pruneDryRun, "dry-run", "n", false, "only report what would be pruned")
+	pruneCmd.Flags().BoolVarP(&pruneForce, "force", "f", false, "with --expired, remove expired worktrees even if they hold uncommitted changes, stashes or unpushed commits")
+}
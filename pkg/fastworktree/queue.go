@@ -0,0 +1,71 @@
+package fastworktree
+
+import "sync"
+
+// workQueue hands out tasks to a pool of workers that may add more tasks as
+// they go. pop blocks until there is a task or every task is done.
+type workQueue struct {
+	mu      sync.Mutex
+	cond    sync.Cond
+	tasks   []string
+	pending int // queued or being worked on
+	total   int // ever queued
+}
+
+func newWorkQueue(tasks []string) *workQueue {
+	q := &workQueue{tasks: tasks, pending: len(tasks), total: len(tasks)}
+	q.cond.L = &q.mu
+	return q
+}
+
+// push queues more tasks.
+func (q *workQueue) push(tasks ...string) {
+	q.mu.Lock()
+	q.tasks = append(q.tasks, tasks...)
+	q.pending += len(tasks)
+	q.total += len(tasks)
+	q.mu.Unlock()
+	q.cond.Broadcast()
+}
+
+// pop returns the next task, or false once there are none left and none
+// being worked on that could add more.
+func (q *workQueue) pop() (string, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.tasks) == 0 && q.pending > 0 {
+		q.cond.Wait()
+	}
+	if len(q.tasks) == 0 {
+		return "", false
+	}
+	task := q.tasks[0]
+	q.tasks = q.tasks[1:]
+	return task, true
+}
+
+// done marks a popped task as finished.
+func (q *workQueue) done() {
+	q.mu.Lock()
+	q.pending--
+	last := q.pending == 0
+	q.mu.Unlock()
+	if last {
+		q.cond.Broadcast()
+	}
+}
+
+// queued returns the number of tasks waiting for a worker.
+func (q *workQueue) queued() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.tasks)
+}
+
+// progress returns the number of tasks finished and the number queued in
+// all.
+func (q *workQueue) progress() (done, total int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.total - q.pending, q.total
+}
@@ -0,0 +1,109 @@
+package fastworktree
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+var (
+	maxWorktrees int
+	maxUsage     string
+	onQuota      string
+)
+
+// quotaWorktree is a managed worktree counted against the quota.
+type quotaWorktree struct {
+	managedWorktree
+	private  int64
+	lastUsed time.Time
+}
+
+// enforceQuota makes room for n new worktrees under --max-worktrees and
+// --max-usage. Over either, add refuses, or with --on-quota=evict removes
+// the least recently used worktrees that hold no uncommitted or unpushed
+// work until it is not. Worktrees in the pool, locked ones and src are
+// never evicted.
+func enforceQuota(src string, n int) error {
+	if maxWorktrees <= 0 && maxUsage == "" {
+		return nil
+	}
+	var limit int64
+	if maxUsage != "" {
+		var err error
+		if limit, err = parseBytes(maxUsage); err != nil {
+			return err
+		}
+	}
+	managed, err := managedWorktrees()
+	if err != nil {
+		return fmt.Errorf("fatal: %w", err)
+	}
+	managed = slices.DeleteFunc(managed, func(e managedWorktree) bool { return isPooled(e.Path) })
+	worktrees := make([]quotaWorktree, len(managed))
+	var wg sync.WaitGroup
+	for i, e := range managed {
+		worktrees[i] = quotaWorktree{managedWorktree: e, lastUsed: lastActivity(e)}
+		if limit > 0 && e.Prunable == "" {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if u, err := measureUsage(e.Path); err == nil {
+					worktrees[i].private = u.Private
+				}
+			}()
+		}
+	}
+	wg.Wait()
+	var usage int64
+	for _, w := range worktrees {
+		usage += w.private
+	}
+
+	over := func() string {
+		switch {
+		case maxWorktrees > 0 && len(worktrees)+n > maxWorktrees:
+			return fmt.Sprintf("%d managed worktrees would exceed --max-worktrees %d", len(worktrees)+n, maxWorktrees)
+		case limit > 0 && usage >= limit:
+			return fmt.Sprintf("managed worktrees use %s, at least --max-usage %s", formatBytes(usage), formatBytes(limit))
+		}
+		return ""
+	}
+	if reason := over(); reason == "" {
+		return nil
+	} else if onQuota != "evict" {
+		return fmt.Errorf("fatal: %s\nhint: remove or prune worktrees, or use --on-quota=evict", reason)
+	}
+
+	// Least recently used first. Commits in the default branch count as
+	// pushed, as they are not lost with the worktree.
+	base := defaultBase()
+	candidates := slices.Clone(worktrees)
+	slices.SortFunc(candidates, func(a, b quotaWorktree) int { return a.lastUsed.Compare(b.lastUsed) })
+	for _, w := range candidates {
+		if over() == "" {
+			return nil
+		}
+		if w.Locked || w.Prunable != "" || realPath(w.Path) == realPath(src) {
+			continue
+		}
+		if reason := unfinishedWork(w.managedWorktree, base, false); reason != "" {
+			console.verbosef(1, "quota: kept %s (%s)", w.Path, reason)
+			continue
+		}
+		start := time.Now()
+		if err := removeWorktree(w.Path, w.gitdir); err != nil {
+			console.warnf("could not evict %s: %v", w.Path, err)
+			continue
+		}
+		recordHistory(historyEntry{Op: "evict", Path: w.Path, Branch: w.Branch}, start)
+		console.infof("evicted:      %s (last used %s)", w.Path, w.lastUsed.Local().Format("2006-01-02 15:04"))
+		worktrees = slices.DeleteFunc(worktrees, func(e quotaWorktree) bool { return e.Path == w.Path })
+		usage -= w.private
+	}
+	if reason := over(); reason != "" {
+		return fmt.Errorf("fatal: %s, and no more worktrees can be evicted: the rest are locked or hold uncommitted or unpushed work", reason)
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package fastworktree
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// useGit makes add register worktrees with git worktree add even when it
+// could do so itself.
+var useGit bool
+
+// unsafeWorktreeName matches the characters git replaces when it names a
+// worktree's administrative directory after its path.
+var unsafeWorktreeName = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// registerWorktree registers the worktree described by spec the way git
+// worktree add --no-checkout does, by writing its administrative files
+// directly: $GIT_COMMON_DIR/worktrees/<name>/{gitdir,commondir,HEAD} and
+// the .git file, which is written into dir rather than spec.dst since the
+// clone is only renamed into place later. Like git, it creates spec.dst as
+// an empty directory to hold the path.
+//
+// Only a detached HEAD or an existing branch is handled. It reports false,
+// having done nothing, for anything else: creating or resetting a branch,
+// tracking, --git-arg, --force, a reftable repository or a path that is
+// still registered, which are left to git.
+func registerWorktree(src string, spec worktreeSpec, dir string, log logger) (bool, error) {
+	if useGit || spec.branchCreate != "" || spec.branchReset != "" || spec.track || track || noTrack || len(gitArgs) > 0 || addForce > 0 {
+		return false, nil
+	}
+	out, _ := gitCommand("-C", src, "config", "extensions.refStorage").Output()
+	if storage := strings.TrimSpace(string(out)); storage != "" && storage != "files" {
+		return false, nil
+	}
+	out, err := gitCommand("-C", src, "rev-parse", "--git-common-dir").Output()
+	if err != nil {
+		return false, fmt.Errorf("git rev-parse: %w", err)
+	}
+	common := strings.TrimSpace(string(out))
+	if !filepath.IsAbs(common) {
+		common = filepath.Join(src, common)
+	}
+	// git writes resolved paths into the .git file as well as gitdir.
+	common = realPath(common)
+	if registered(common, spec.dst) {
+		return false, nil
+	}
+
+	var head, preparing string
+	if spec.attach {
+		head = "ref: refs/heads/" + spec.commitish
+		preparing = fmt.Sprintf("checking out '%s'", spec.commitish)
+	} else {
+		out, err := gitCommand("-C", src, "rev-parse", "--verify", "-q", cmp.Or(spec.commitish, "HEAD")+"^{commit}").Output()
+		if err != nil {
+			return false, fmt.Errorf("fatal: invalid reference: %s", spec.commitish)
+		}
+		head = strings.TrimSpace(string(out))
+		preparing = "detached HEAD " + head[:7]
+	}
+
+	worktreeAddMu.Lock()
+	defer worktreeAddMu.Unlock()
+	if err := os.Mkdir(spec.dst, 0o777); err != nil {
+		return false, fmt.Errorf("fatal: %w", err)
+	}
+	admin, err := adminDir(common, spec.dst)
+	if err != nil {
+		os.Remove(spec.dst)
+		return false, fmt.Errorf("fatal: %w", err)
+	}
+	files := []struct{ name, content string }{
+		{"commondir", "../..\n"},
+		{"gitdir", filepath.Join(realPath(spec.dst), ".git") + "\n"},
+		{"HEAD", head + "\n"},
+	}
+	// Locking as part of registering leaves no window in which a
+	// concurrent git worktree prune could drop the new worktree.
+	if lock {
+		files = append(files, struct{ name, content string }{"locked", reason})
+	}
+	for _, f := range files {
+		if err := os.WriteFile(filepath.Join(admin, f.name), []byte(f.content), 0o666); err != nil {
+			os.RemoveAll(admin)
+			os.Remove(spec.dst)
+			return false, fmt.Errorf("fatal: %w", err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, ".git"), []byte("gitdir: "+admin+"\n"), 0o666); err != nil {
+		os.RemoveAll(admin)
+		os.Remove(spec.dst)
+		return false, fmt.Errorf("fatal: %w", err)
+	}
+	log.infof("Preparing worktree (%s)", preparing)
+	return true, nil
+}
+
+// adminDir creates the administrative directory for a worktree at dst,
+// named after its basename like git does, with a number appended when the
+// name is taken.
+func adminDir(common, dst string) (string, error) {
+	name := strings.TrimLeft(unsafeWorktreeName.ReplaceAllString(filepath.Base(dst), "-"), ".")
+	if name == "" {
+		name = "worktree"
+	}
+	if err := os.MkdirAll(filepath.Join(common, "worktrees"), 0o777); err != nil {
+		return "", err
+	}
+	for i := 0; ; i++ {
+		dir := filepath.Join(common, "worktrees", name)
+		if i > 0 {
+			dir += strconv.Itoa(i)
+		}
+		err := os.Mkdir(dir, 0o777)
+		if err == nil {
+			return dir, nil
+		}
+		if !os.IsExist(err) {
+			return "", err
+		}
+	}
+}
+
+// registered reports whether a worktree of the repository at common is
+// registered at dst, even if it has since gone missing. gitdir files hold
+// resolved paths, so dst is resolved too.
+func registered(common, dst string) bool {
+	dst = realPath(dst)
+	entries, _ := os.ReadDir(filepath.Join(common, "worktrees"))
+	for _, e := range entries {
+		gitdir, err := os.ReadFile(filepath.Join(common, "worktrees", e.Name(), "gitdir"))
+		if err == nil && realPath(filepath.Dir(strings.TrimSpace(string(gitdir)))) == dst {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+package fastworktree
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRegistered(t *testing.T) {
+	root := t.TempDir()
+	real := filepath.Join(root, "real")
+	link := filepath.Join(root, "link")
+	common := filepath.Join(real, "repo", ".git")
+	if err := os.MkdirAll(filepath.Join(common, "worktrees", "wt"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(real, link); err != nil {
+		t.Skipf("cannot create symlinks: %v", err)
+	}
+	// As registerWorktree writes it, from the resolved path.
+	gitdir := filepath.Join(realPath(real), "wt", ".git") + "\n"
+	if err := os.WriteFile(filepath.Join(common, "worktrees", "wt", "gitdir"), []byte(gitdir), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		dst  string
+		want bool
+	}{
+		{filepath.Join(real, "wt"), true},
+		{filepath.Join(link, "wt"), true},
+		{filepath.Join(real, "other"), false},
+		{filepath.Join(link, "other"), false},
+		{real, false},
+	}
+	for _, tt := range tests {
+		if got := registered(common, tt.dst); got != tt.want {
+			t.Errorf("registered(%s) = %v, want %v", tt.dst, got, tt.want)
+		}
+	}
+}
+
+// TestRegisterWorktree compares what registerWorktree writes with what git
+// worktree add does, with the repository reached through a symlink.
+func TestRegisterWorktree(t *testing.T) {
+	repo := newTestRepo(t)
+	src := filepath.Join(filepath.Dir(repo), "link")
+	if err := os.Symlink(repo, src); err != nil {
+		t.Skipf("cannot create symlinks: %v", err)
+	}
+	parent := t.TempDir()
+	gitDst, ourDst := filepath.Join(parent, "git", "wt"), filepath.Join(parent, "ours", "wt")
+	runTestGit(t, "-C", src, "worktree", "add", "-q", "--detach", "--no-checkout", gitDst)
+
+	if err := os.MkdirAll(filepath.Dir(ourDst), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	ok, err := registerWorktree(src, worktreeSpec{dst: ourDst}, dir, logger{})
+	if err != nil || !ok {
+		t.Fatalf("registerWorktree() = %v, %v, want it registered", ok, err)
+	}
+
+	read := func(path string) string {
+		t.Helper()
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	// The admin directories are both named after wt, so ours is wt1.
+	admin := filepath.Join(repo, ".git", "worktrees")
+	for _, name := range []string{"commondir", "gitdir", "HEAD"} {
+		want := strings.ReplaceAll(read(filepath.Join(admin, "wt", name)), realPath(gitDst), realPath(ourDst))
+		if got := read(filepath.Join(admin, "wt1", name)); got != want {
+			t.Errorf("%s = %q, want %q as git writes it", name, got, want)
+		}
+	}
+	want := strings.Replace(read(filepath.Join(gitDst, ".git")), "wt\n", "wt1\n", 1)
+	if got := read(filepath.Join(dir, ".git")); got != want {
+		t.Errorf(".git = %q, want %q as git writes it", got, want)
+	}
+}
@@ -0,0 +1,237 @@
+package fastworktree
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var removeForce int
+
+var removeCmd = &cobra.Command{
+	Use:   "remove [flags] <path>",
+	Short: "Remove a worktree, deleting its files in the background",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path, err := filepath.Abs(args[0])
+		if err != nil {
+			return fmt.Errorf("error resolving path: %w", err)
+		}
+		// What would be lost says more than the usage would.
+		cmd.SilenceUsage = true
+		return runRemove(path)
+	},
+}
+
+// runRemove removes the worktree at path, unless it is dirty or locked and
+// --force was not given often enough.
+func runRemove(path string) error {
+	gitdir, err := worktreeGitdir(path)
+	if err != nil {
+		return fmt.Errorf("fatal: %w", err)
+	}
+
+	// Same rules as git worktree remove: -f for a dirty worktree, -f -f
+	// for a locked one.
+	if reason, err := os.ReadFile(filepath.Join(gitdir, "locked")); err == nil && removeForce < 2 {
+		msg := "fatal: cannot remove a locked working tree, use 'remove -f -f' to override or unlock first"
+		if r := strings.TrimSpace(string(reason)); r != "" {
+			msg = fmt.Sprintf("fatal: cannot remove a locked working tree, lock reason: %s\nuse 'remove -f -f' to override or unlock first", r)
+		}
+		return fmt.Errorf("%s", msg)
+	}
+	if removeForce < 1 {
+		work, err := findWorkAtRisk(path, currentBranch(path), defaultBase(), false)
+		if err != nil {
+			return fmt.Errorf("fatal: %v in '%s', use --force to delete it", err, path)
+		}
+		if work.summary() != "" {
+			return fmt.Errorf("fatal: '%s' holds work that removing it would lose, use --force to delete it anyway:\n%s", path, work.details())
+		}
+	}
+
+	start := time.Now()
+	branch := currentBranch(path)
+	if err := removeWorktree(path, gitdir); err != nil {
+		return err
+	}
+	recordHistory(historyEntry{Op: "remove", Path: path, Branch: branch}, start)
+	console.infof("removed: %s (%v)", path, time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// workAtRisk is the work in a worktree that removing it could lose.
+type workAtRisk struct {
+	changes []string // git status --short lines
+	stashes []string
+	commits []string // git log --oneline lines
+}
+
+// findWorkAtRisk returns the work in the worktree at path, on branch: its
+// uncommitted changes, the stashes made on branch, and the commits of HEAD
+// that are on no remote and not in base, unless branch's upstream is gone
+// as after a merge.
+func findWorkAtRisk(path, branch, base string, upstreamGone bool) (workAtRisk, error) {
+	var w workAtRisk
+	out, err := gitCommand("-C", path, "status", "--short").Output()
+	if err != nil {
+		return w, fmt.Errorf("git status failed")
+	}
+	w.changes = lines(string(out))
+
+	if branch != "" {
+		out, err := gitCommand("-C", path, "stash", "list", "--format=%gd: %gs").Output()
+		if err != nil {
+			return w, fmt.Errorf("git stash list failed")
+		}
+		for _, stash := range lines(string(out)) {
+			_, subject, _ := strings.Cut(stash, ": ")
+			if strings.HasPrefix(subject, "WIP on "+branch+": ") || strings.HasPrefix(subject, "On "+branch+": ") {
+				w.stashes = append(w.stashes, stash)
+			}
+		}
+	}
+
+	if !upstreamGone {
+		logArgs := []string{"-C", path, "log", "--oneline", "--no-decorate", "HEAD", "--not", "--remotes"}
+		if base != "" {
+			logArgs = append(logArgs, base)
+		}
+		// An unborn branch has no commits to lose.
+		if gitCommand("-C", path, "rev-parse", "--verify", "-q", "HEAD").Run() == nil {
+			out, err := gitCommand(logArgs...).Output()
+			if err != nil {
+				return w, fmt.Errorf("git log failed")
+			}
+			w.commits = lines(string(out))
+		}
+	}
+	return w, nil
+}
+
+// lines splits out into its non-empty lines.
+func lines(out string) []string {
+	var lines []string
+	for _, line := range strings.Split(out, "\n") {
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// summary counts w's work, as "2 uncommitted changes, 1 unpushed commits",
+// or is "" if there is none.
+func (w workAtRisk) summary() string {
+	var parts []string
+	for _, kind := range []struct {
+		n    int
+		name string
+	}{{len(w.changes), "uncommitted changes"}, {len(w.stashes), "stashes"}, {len(w.commits), "unpushed commits"}} {
+		if kind.n > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", kind.n, kind.name))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// details lists w's work, a section for each kind, each cut at 20 lines.
+func (w workAtRisk) details() string {
+	const maxLines = 20
+	var b strings.Builder
+	for _, kind := range []struct {
+		name  string
+		lines []string
+	}{{"uncommitted changes", w.changes}, {"stashes", w.stashes}, {"unpushed commits", w.commits}} {
+		if len(kind.lines) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "%s:\n", kind.name)
+		for _, line := range kind.lines[:min(len(kind.lines), maxLines)] {
+			fmt.Fprintf(&b, "  %s\n", line)
+		}
+		if len(kind.lines) > maxLines {
+			fmt.Fprintf(&b, "  ... and %d more\n", len(kind.lines)-maxLines)
+		}
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// purgeCmd deletes a trash directory left behind by remove. It is run as a
+// detached child process so that remove can return immediately.
+var purgeCmd = &cobra.Command{
+	Use:    "purge <dir>",
+	Hidden: true,
+	Args:   cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return os.RemoveAll(args[0])
+	},
+}
+
+// removeWorktree unregisters the worktree at path, and any submodule
+// worktrees inside it, and deletes its files.
+func removeWorktree(path, gitdir string) error {
+	subGitdirs := submoduleGitdirs(path)
+	meta, _ := readMetadata(gitdir)
+	if err := trashDir(path); err != nil {
+		return err
+	}
+	if meta.Workspace != "" {
+		os.Remove(meta.Workspace)
+	}
+	if err := os.RemoveAll(gitdir); err != nil {
+		return fmt.Errorf("error removing worktree metadata: %w", err)
+	}
+	for _, dir := range subGitdirs {
+		os.RemoveAll(dir)
+	}
+	return nil
+}
+
+// trashDir deletes the directory at path without making the caller wait.
+// The directory is renamed into a trash directory next to it, which is
+// instant on the same volume, and the trash is deleted by a background
+// process.
+func trashDir(path string) error {
+	trash, err := os.MkdirTemp(filepath.Dir(path), ".git-fast-worktree-trash-")
+	if err != nil {
+		return fmt.Errorf("error creating trash directory: %w", err)
+	}
+	if err := os.Rename(path, filepath.Join(trash, filepath.Base(path))); err != nil {
+		os.Remove(trash)
+		return fmt.Errorf("error moving %s to trash: %w", path, err)
+	}
+	if err := purgeInBackground(trash); err != nil {
+		console.warnf("background delete failed (%v), deleting in the foreground", err)
+		return os.RemoveAll(trash)
+	}
+	return nil
+}
+
+// purgeInBackground starts a detached copy of this binary that deletes dir.
+// In a program embedding the package, the binary is not this one, so dir is
+// deleted in the foreground.
+func purgeInBackground(dir string) error {
+	if embedded {
+		return os.RemoveAll(dir)
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(exe, "purge", dir)
+	detach(cmd)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	return cmd.Process.Release()
+}
+
+func init() {
+	removeCmd.Flags().CountVarP(&removeForce, "force", "f", "remove a worktree with uncommitted changes, stashes or unpushed commits; give twice to remove a locked one")
+}
@@ -0,0 +1,59 @@
+package fastworktree
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+)
+
+var repairCmd = &cobra.Command{
+	Use:   "repair [<path>...]",
+	Short: "Repair worktree administrative files and this tool's records",
+	Long: "Runs git worktree repair, then updates the metadata this tool keeps for each\n" +
+		"worktree so it still points at the right source after a worktree or the main\n" +
+		"repository has been moved.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		repairArgs := []string{"worktree", "repair"}
+		for _, arg := range args {
+			path, err := filepath.Abs(arg)
+			if err != nil {
+				return fmt.Errorf("error resolving path: %w", err)
+			}
+			repairArgs = append(repairArgs, path)
+		}
+		if err := runGit(repairArgs...); err != nil {
+			return gitFailed("git worktree repair")
+		}
+
+		entries, err := listWorktrees(".")
+		if err != nil {
+			return fmt.Errorf("fatal: %w", err)
+		}
+		// A bare repository has no main working tree to point sources at.
+		if entries[0].Bare {
+			return nil
+		}
+		mainPath := entries[0].Path
+		for _, e := range entries[1:] {
+			gitdir, err := worktreeGitdir(e.Path)
+			if err != nil {
+				continue
+			}
+			m, ok := readMetadata(gitdir)
+			if !ok {
+				continue
+			}
+			if _, err := os.Stat(filepath.Join(m.Source, ".git")); err == nil {
+				continue
+			}
+			m.Source = mainPath
+			if err := writeMetadata(gitdir, m); err != nil {
+				return fmt.Errorf("error updating metadata for %s: %w", e.Path, err)
+			}
+			console.infof("repair: source of %s now %s", e.Path, mainPath)
+		}
+		return nil
+	},
+}
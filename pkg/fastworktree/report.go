@@ -0,0 +1,229 @@
+package fastworktree
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// jsonOutput makes add print an addReport on stdout instead of progress.
+	jsonOutput bool
+	// progress is human, or ndjson to stream progressEvents on stdout.
+	progress string
+	// statsOut is the file add appends a statsRecord to for each worktree.
+	statsOut string
+	// events is where ndjson progress is streamed to, stdout unless the
+	// daemon is passing it on.
+	events io.Writer = os.Stdout
+)
+
+// addReport is what add --json prints for each worktree. With
+// --progress=ndjson it instead streams an event for everything recorded in
+// it. Its methods do nothing on a nil report, so code that logs does not
+// need to check for either.
+type addReport struct {
+	mu       sync.Mutex
+	Path     string        `json:"path"`
+	Branch   string        `json:"branch,omitempty"`
+	Commit   string        `json:"commit,omitempty"`
+	Backend  string        `json:"backend,omitempty"`
+	Entries  int64         `json:"entries"`
+	Phases   []phaseReport `json:"phases,omitempty"`
+	TotalMs  float64       `json:"total_ms"`
+	Warnings []string      `json:"warnings,omitempty"`
+	Errors   []string      `json:"errors,omitempty"`
+	finished bool
+	stream   bool
+}
+
+// progressEvent is one line of --progress=ndjson output.
+type progressEvent struct {
+	Event    string     `json:"event"`
+	Time     time.Time  `json:"time"`
+	Worktree string     `json:"worktree"`
+	Phase    string     `json:"phase,omitempty"`
+	Entry    string     `json:"entry,omitempty"`
+	Ms       float64    `json:"ms,omitempty"`
+	Message  string     `json:"message,omitempty"`
+	Report   *addReport `json:"report,omitempty"`
+}
+
+// eventsMu keeps the events of concurrent worktrees on separate lines.
+var eventsMu sync.Mutex
+
+func (r *addReport) emit(e progressEvent) {
+	if r == nil || !r.stream {
+		return
+	}
+	e.Time = time.Now()
+	e.Worktree = r.Path
+	eventsMu.Lock()
+	defer eventsMu.Unlock()
+	json.NewEncoder(events).Encode(e)
+}
+
+// phaseReport is how long one step of add took.
+type phaseReport struct {
+	Name string  `json:"name"`
+	Ms   float64 `json:"ms"`
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// start records that a phase of add has started, returning the time it
+// did.
+func (r *addReport) start(name string) time.Time {
+	r.emit(progressEvent{Event: "phase-start", Phase: name})
+	return time.Now()
+}
+
+func (r *addReport) phase(name string, d time.Duration) {
+	if r == nil {
+		return
+	}
+	r.emit(progressEvent{Event: "phase-end", Phase: name, Ms: milliseconds(d)})
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Phases = append(r.Phases, phaseReport{name, milliseconds(d)})
+}
+
+func (r *addReport) entryCloned(name string, d time.Duration) {
+	r.emit(progressEvent{Event: "entry-cloned", Entry: name, Ms: milliseconds(d)})
+}
+
+func (r *addReport) cloned(backend string, entries int64) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Backend, r.Entries = backend, entries
+}
+
+func (r *addReport) warn(msg string) {
+	if r == nil {
+		return
+	}
+	r.emit(progressEvent{Event: "warning", Message: msg})
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Warnings = append(r.Warnings, msg)
+}
+
+func (r *addReport) fail(msg string) {
+	if r == nil {
+		return
+	}
+	r.emit(progressEvent{Event: "error", Message: msg})
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Errors = append(r.Errors, msg)
+}
+
+// finish records the outcome of an add that took total: err, or the
+// branch and commit checked out in the new worktree.
+func (r *addReport) finish(err error, total time.Duration) {
+	if r == nil {
+		return
+	}
+	r.finished = true
+	r.TotalMs = milliseconds(total)
+	if err != nil {
+		r.fail(err.Error())
+	} else {
+		if out, err := gitCommand("-C", r.Path, "symbolic-ref", "--short", "-q", "HEAD").Output(); err == nil {
+			r.Branch = strings.TrimSpace(string(out))
+		}
+		if out, err := gitCommand("-C", r.Path, "rev-parse", "-q", "--verify", "HEAD").Output(); err == nil {
+			r.Commit = strings.TrimSpace(string(out))
+		}
+	}
+	r.emit(progressEvent{Event: "done", Ms: r.TotalMs, Report: r})
+}
+
+// printReports writes reports to stdout as JSON: a single object for one
+// worktree, an array for a batch.
+func printReports(reports []*addReport, batch bool) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if batch {
+		return enc.Encode(reports)
+	}
+	return enc.Encode(reports[0])
+}
+
+// statsRecord is what --stats-out records about one worktree: its report,
+// when and from where it was created, and, if it was, how much space it
+// takes up.
+type statsRecord struct {
+	Time time.Time `json:"time"`
+	Repo string    `json:"repo"`
+	*addReport
+	Usage *DiskUsage `json:"usage,omitempty"`
+}
+
+// statsColumns is the header of a --stats-out CSV file.
+var statsColumns = []string{"time", "repo", "path", "branch", "commit", "backend", "entries", "total_ms", "phases", "logical_bytes", "private_bytes", "errors"}
+
+// writeStats appends a record for each report of an add started at start
+// in the repository src to file. Measuring how much space each new
+// worktree takes means walking it, which is only done for --stats-out.
+func writeStats(file, src string, start time.Time, reports []*addReport) error {
+	var records []statsRecord
+	for _, r := range reports {
+		record := statsRecord{Time: start, Repo: src, addReport: r}
+		if len(r.Errors) == 0 {
+			if u, err := measureUsage(r.Path); err == nil {
+				record.Usage = &u
+			}
+		}
+		records = append(records, record)
+	}
+
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o666)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if !strings.EqualFold(filepath.Ext(file), ".csv") {
+		enc := json.NewEncoder(f)
+		for _, record := range records {
+			if err := enc.Encode(record); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	w := csv.NewWriter(f)
+	if info, err := f.Stat(); err == nil && info.Size() == 0 {
+		w.Write(statsColumns)
+	}
+	for _, record := range records {
+		phases := make([]string, len(record.Phases))
+		for i, p := range record.Phases {
+			phases[i] = fmt.Sprintf("%s=%.3f", p.Name, p.Ms)
+		}
+		var logical, private string
+		if record.Usage != nil {
+			logical, private = strconv.FormatInt(record.Usage.Logical, 10), strconv.FormatInt(record.Usage.Private, 10)
+		}
+		w.Write([]string{
+			record.Time.Format(time.RFC3339), record.Repo, record.Path, record.Branch, record.Commit, record.Backend,
+			strconv.FormatInt(record.Entries, 10), strconv.FormatFloat(record.TotalMs, 'f', 3, 64),
+			strings.Join(phases, ";"), logical, private, strings.Join(record.Errors, "; "),
+		})
+	}
+	w.Flush()
+	return w.Error()
+}
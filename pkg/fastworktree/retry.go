@@ -0,0 +1,68 @@
+package fastworktree
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+)
+
+// cloneRetries is how many times an entry is cloned before a transient
+// error is given up on.
+const cloneRetries = 3
+
+// errNoSpace aborts the clone phase: every other entry would fail the same
+// way, and the partial clone is only taking up more of the space.
+var errNoSpace = errors.New("no space left on device")
+
+// skippedError is an entry the OS would not let us clone, such as a file
+// protected by SIP or marked immutable. It is left out with a warning.
+type skippedError struct {
+	err error
+}
+
+func (e *skippedError) Error() string { return e.err.Error() }
+func (e *skippedError) Unwrap() error { return e.err }
+
+// cloneEntry clones the entry src to dst with c, handling failures by kind:
+// transient errors are retried, errors meaning the backend cannot clone this
+// particular entry fall back to a copy, permission errors skip the entry
+// and running out of space returns errNoSpace. Anything else fails.
+func cloneEntry(c Cloner, src, dst string, log logger) error {
+	for attempt := 1; ; attempt++ {
+		err := cloneWith(c, src, dst)
+		switch {
+		case err == nil:
+			return nil
+		case errors.Is(err, syscall.ENOSPC):
+			return errNoSpace
+		case errors.Is(err, syscall.EINTR) || errors.Is(err, syscall.EAGAIN):
+			if attempt == cloneRetries {
+				return err
+			}
+			log.verbosef(1, "  %s: %v, retrying", src, err)
+			os.RemoveAll(dst)
+			time.Sleep(time.Duration(attempt) * 50 * time.Millisecond)
+		case errors.Is(err, syscall.EXDEV) || errors.Is(err, syscall.ENOTSUP) || errors.Is(err, syscall.EOPNOTSUPP):
+			if c.Name() == "copy" {
+				return err
+			}
+			log.verbosef(1, "  %s: %v, copying instead", src, err)
+			os.RemoveAll(dst)
+			from := src
+			if m, ok := c.(sourceMapper); ok {
+				from = m.sourcePath(src)
+			}
+			if err := cloneTree(from, dst, log.progress.counting(copyFile)); err != nil {
+				return fmt.Errorf("copy after %s failed: %w", c.Name(), err)
+			}
+			return nil
+		case errors.Is(err, syscall.EPERM):
+			os.RemoveAll(dst)
+			return &skippedError{err}
+		default:
+			return err
+		}
+	}
+}
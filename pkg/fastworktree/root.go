@@ -0,0 +1,218 @@
+package fastworktree
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// traceGit makes every git command print how it exited.
+var traceGit bool
+
+var rootCmd = &cobra.Command{
+	Use:   "git-fast-worktree",
+	Short: "Create git worktrees using copy-on-write cloning",
+	Long:  "Creates git worktrees using copy-on-write cloning instead of git checkout.\nMust be run from within a git repository on an APFS (macOS), reflink-capable\nbtrfs/XFS/ZFS (Linux, FreeBSD) or ReFS/Dev Drive (Windows) volume.",
+}
+
+// Main runs the git-fast-worktree command line with the process's
+// arguments and exits with its exit code.
+func Main() {
+	rootCmd.AddCommand(addCmd)
+	rootCmd.AddCommand(doctorCmd)
+	rootCmd.AddCommand(removeCmd)
+	rootCmd.AddCommand(listCmd)
+	rootCmd.AddCommand(moveCmd)
+	rootCmd.AddCommand(lockCmd)
+	rootCmd.AddCommand(unlockCmd)
+	rootCmd.AddCommand(repairCmd)
+	rootCmd.AddCommand(withCmd)
+	rootCmd.AddCommand(pruneCmd)
+	rootCmd.AddCommand(execCmd)
+	rootCmd.AddCommand(verifyCmd)
+	rootCmd.AddCommand(benchCmd)
+	rootCmd.AddCommand(poolCmd)
+	rootCmd.AddCommand(statsCmd)
+	rootCmd.AddCommand(purgeCmd)
+	rootCmd.AddCommand(switchCmd)
+	rootCmd.AddCommand(shellInitCmd)
+	rootCmd.AddCommand(mcpCmd)
+	rootCmd.AddCommand(daemonCmd)
+	rootCmd.AddCommand(infoCmd)
+	rootCmd.AddCommand(undoCmd)
+	rootCmd.AddCommand(statusCmd)
+	rootCmd.AddCommand(syncAllCmd)
+	rootCmd.AddCommand(adoptCmd)
+	rootCmd.AddCommand(historyCmd)
+	rootCmd.AddCommand(cleanCmd)
+	rootCmd.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "suppress progress and timing output")
+	rootCmd.PersistentFlags().CountVarP(&verbosity, "verbose", "v", "show per-entry clone timing; give twice to also show git commands")
+	rootCmd.PersistentFlags().BoolVar(&traceGit, "trace", false, "print every git command run, with its exit status and duration")
+	rootCmd.PersistentFlags().StringVar(&logFile, "log-file", "", "append structured logs (slog text format) to this file")
+	rootCmd.PersistentFlags().StringVar(&logLevel, "log-level", "info", "lowest level written to --log-file: debug, info, warn or error")
+	rootCmd.PersistentFlags().BoolVar(&noColor, "no-color", false, "never color output (also NO_COLOR)")
+	rootCmd.PersistentFlags().StringVar(&profile, "profile", "", "use the flag values of the [profile.<name>] table in the config")
+	rootCmd.PersistentFlags().BoolVar(&trustRepoConfig, "trust-repo-config", false, "let "+repoConfigFile+" set flags that run commands, such as post-create (also git config fastworktree.trustRepoConfig)")
+	rootCmd.RegisterFlagCompletionFunc("profile", completeProfiles)
+	rootCmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		// Completions are read by the shell, which warnings would garble.
+		if cmd.Name() == cobra.ShellCompRequestCmd || cmd.Name() == cobra.ShellCompNoDescRequestCmd {
+			return nil
+		}
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		if err := applyConfig(cmd, cfg); err != nil {
+			return err
+		}
+		rootCmd.SetErrPrefix(colorize(os.Stderr, colorRed, "Error:"))
+		checkConfig(rootCmd, cfg)
+		return setupLogging()
+	}
+	if err := rootCmd.Execute(); err != nil {
+		slogger.Error("failed", "command", strings.Join(os.Args[1:], " "), "err", err)
+		os.Exit(exitCode(err))
+	}
+}
+
+// toolVersion returns the module version the binary was built from, or
+// devel if it was not built from a release.
+func toolVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	return "devel"
+}
+
+// gitToplevel returns the root directory of the current git repository.
+func gitToplevel() (string, error) {
+	cmd := gitCommand("rev-parse", "--show-toplevel")
+	out, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// gitCommonDir returns the absolute path of the current repository's common
+// git directory, i.e. the main repository's .git even from a linked worktree.
+func gitCommonDir() (string, error) {
+	cmd := gitCommand("rev-parse", "--git-common-dir")
+	out, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	return absGitPath(cmd.Dir, strings.TrimSpace(string(out)))
+}
+
+// absGitPath makes path, as git rev-parse printed it when run in dir,
+// absolute. Older git prints some paths relative to dir, but the common
+// dir of a linked worktree is absolute.
+func absGitPath(dir, path string) (string, error) {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	return filepath.Abs(path)
+}
+
+// gitCmd is a git command that, with --trace, reports how it exited.
+type gitCmd struct {
+	*exec.Cmd
+	start time.Time
+}
+
+// newGitCmd returns the command that runs git with args. Programs using
+// the package replace it with Options.Git.
+var newGitCmd = func(args ...string) *exec.Cmd {
+	return exec.Command("git", args...)
+}
+
+// gitCommand returns a command running git with args, echoing it first at
+// -vv. With --no-fetch-missing, git fails rather than fetching objects
+// missing from a partial clone.
+func gitCommand(args ...string) *gitCmd {
+	console.verbosef(2, "+ git %s", strings.Join(args, " "))
+	cmd := newGitCmd(args...)
+	if noFetchMissing {
+		if cmd.Env == nil {
+			cmd.Env = os.Environ()
+		}
+		cmd.Env = append(cmd.Env, "GIT_NO_LAZY_FETCH=1")
+	}
+	return &gitCmd{Cmd: cmd}
+}
+
+func (c *gitCmd) Start() error {
+	c.start = time.Now()
+	err := c.Cmd.Start()
+	if err != nil {
+		c.trace(err)
+	}
+	return err
+}
+
+func (c *gitCmd) Wait() error {
+	err := c.Cmd.Wait()
+	c.trace(err)
+	return err
+}
+
+func (c *gitCmd) Run() error {
+	if err := c.Start(); err != nil {
+		return err
+	}
+	return c.Wait()
+}
+
+func (c *gitCmd) Output() ([]byte, error) {
+	c.start = time.Now()
+	out, err := c.Cmd.Output()
+	c.trace(err)
+	return out, err
+}
+
+func (c *gitCmd) CombinedOutput() ([]byte, error) {
+	c.start = time.Now()
+	out, err := c.Cmd.CombinedOutput()
+	c.trace(err)
+	return out, err
+}
+
+// trace prints the command with how it exited, for --trace.
+func (c *gitCmd) trace(err error) {
+	if !traceGit {
+		return
+	}
+	status := "exit 0"
+	var exitErr *exec.ExitError
+	switch {
+	case errors.As(err, &exitErr):
+		status = fmt.Sprintf("exit %d", exitErr.ExitCode())
+	case err != nil:
+		status = err.Error()
+	}
+	quoted := make([]string, len(c.Args))
+	for i, arg := range c.Args {
+		quoted[i] = arg
+		if arg == "" || strings.ContainsAny(arg, " \t\n'\"\\$*?") {
+			quoted[i] = strconv.Quote(arg)
+		}
+	}
+	console.printf("trace: %s: %s (%v)", strings.Join(quoted, " "), status, time.Since(c.start).Round(time.Millisecond))
+}
+
+// runGit runs git with args, passing its stderr through to the user.
+func runGit(args ...string) error {
+	cmd := gitCommand(args...)
+	cmd.Stderr = stderr
+	return cmd.Run()
+}
@@ -0,0 +1,49 @@
+package fastworktree
+
+import (
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestGitCommonDir(t *testing.T) {
+	repo := newTestRepo(t)
+	wt := filepath.Join(filepath.Dir(repo), "wt")
+	runTestGit(t, "-C", repo, "worktree", "add", "-q", "--detach", wt)
+
+	saved := newGitCmd
+	t.Cleanup(func() { newGitCmd = saved })
+	// git prints .git for the main worktree, but an absolute path for a
+	// linked one.
+	for _, dir := range []string{repo, wt} {
+		newGitCmd = func(args ...string) *exec.Cmd {
+			cmd := exec.Command("git", args...)
+			cmd.Dir = dir
+			return cmd
+		}
+		got, err := gitCommonDir()
+		if err != nil {
+			t.Fatalf("gitCommonDir() in %s: %v", dir, err)
+		}
+		if want := filepath.Join(repo, ".git"); realPath(got) != realPath(want) {
+			t.Errorf("gitCommonDir() in %s = %s, want %s", dir, got, want)
+		}
+	}
+}
+
+func TestAbsGitPath(t *testing.T) {
+	tests := []struct {
+		dir, path, want string
+	}{
+		{"/repo", ".git", "/repo/.git"},
+		{"/repo/sub", "../.git", "/repo/.git"},
+		{"/wt", "/repo/.git", "/repo/.git"},
+		{"/wt", "/repo/.git/", "/repo/.git"},
+	}
+	for _, tt := range tests {
+		got, err := absGitPath(filepath.FromSlash(tt.dir), filepath.FromSlash(tt.path))
+		if want, _ := filepath.Abs(filepath.FromSlash(tt.want)); err != nil || got != want {
+			t.Errorf("absGitPath(%s, %s) = %s, %v, want %s", tt.dir, tt.path, got, err, want)
+		}
+	}
+}
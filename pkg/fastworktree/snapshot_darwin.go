@@ -0,0 +1,103 @@
+//go:build darwin
+
+package fastworktree
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+func init() {
+	explicitCloners = append(explicitCloners, snapshotCloner{})
+}
+
+var snapshotDate = regexp.MustCompile(`\d{4}-\d{2}-\d{2}-\d{6}`)
+
+// snapshotCloner clones from a local APFS snapshot of the source volume
+// rather than from the live working tree, so files being rewritten by an
+// IDE or build while the clone runs cannot produce a torn worktree. The
+// registered instance only prepares; each add clones through the
+// snapshotMount that Prepare returns.
+type snapshotCloner struct{}
+
+func (snapshotCloner) Name() string      { return "snapshot" }
+func (snapshotCloner) SupportsDir() bool { return true }
+
+func (snapshotCloner) Probe(volume string) error {
+	return clonefileCloner{}.Probe(volume)
+}
+
+func (snapshotCloner) Clone(src, dst string) error {
+	return fmt.Errorf("the snapshot backend clones only once prepared")
+}
+
+// Prepare takes a local snapshot with tmutil and mounts it read-only. The
+// snapshot is unmounted and deleted again by the returned cleanup func.
+func (snapshotCloner) Prepare(src string) (Cloner, func(), error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(src, &st); err != nil {
+		return nil, nil, err
+	}
+	device := unix.ByteSliceToString(st.Mntfromname[:])
+	m := &snapshotMount{root: unix.ByteSliceToString(st.Mntonname[:])}
+
+	out, err := exec.Command("tmutil", "localsnapshot").CombinedOutput()
+	if err != nil {
+		return nil, nil, fmt.Errorf("tmutil localsnapshot: %s", strings.TrimSpace(string(out)))
+	}
+	date := snapshotDate.FindString(string(out))
+	if date == "" {
+		return nil, nil, fmt.Errorf("tmutil localsnapshot: unexpected output: %s", strings.TrimSpace(string(out)))
+	}
+	deleteSnapshot := func() { exec.Command("tmutil", "deletelocalsnapshots", date).Run() }
+
+	m.mount, err = os.MkdirTemp("", "git-fast-worktree-snapshot-")
+	if err != nil {
+		deleteSnapshot()
+		return nil, nil, err
+	}
+	name := "com.apple.TimeMachine." + date + ".local"
+	if out, err := exec.Command("mount_apfs", "-o", "nobrowse,rdonly", "-s", name, device, m.mount).CombinedOutput(); err != nil {
+		os.Remove(m.mount)
+		deleteSnapshot()
+		return nil, nil, fmt.Errorf("mount_apfs: %s", strings.TrimSpace(string(out)))
+	}
+
+	return m, func() {
+		exec.Command("umount", m.mount).Run()
+		os.Remove(m.mount)
+		deleteSnapshot()
+	}, nil
+}
+
+// snapshotMount is a snapshot mounted by Prepare for a single add.
+type snapshotMount struct {
+	snapshotCloner
+	root  string // mount point of the volume holding the source
+	mount string // where the snapshot of root is mounted
+}
+
+// sourcePath returns the snapshot's copy of src.
+func (m *snapshotMount) sourcePath(src string) string {
+	// Paths on the data volume are usually reached through firmlinks
+	// (/Users is really /System/Volumes/Data/Users), in which case src is
+	// already relative to the volume root.
+	rel := src
+	if r, err := filepath.Rel(m.root, src); err == nil && !strings.HasPrefix(r, "..") {
+		rel = r
+	}
+	return filepath.Join(m.mount, rel)
+}
+
+// Clone clones the snapshot's copy of src to dst. Should clonefile refuse
+// to clone off the snapshot's mount, cloneEntry copies from sourcePath
+// instead, which keeps the worktree consistent at the cost of sharing.
+func (m *snapshotMount) Clone(src, dst string) error {
+	return unix.Clonefile(m.sourcePath(src), dst, unix.CLONE_NOFOLLOW)
+}
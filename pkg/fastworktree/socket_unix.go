@@ -0,0 +1,17 @@
+//go:build !windows
+
+package fastworktree
+
+import (
+	"net"
+	"syscall"
+)
+
+// listenPrivate listens on a Unix socket at path that only this user can
+// connect to. The umask applies as the socket is created, so there is no
+// moment at which others could connect before a chmod.
+func listenPrivate(path string) (net.Listener, error) {
+	old := syscall.Umask(0o177)
+	defer syscall.Umask(old)
+	return net.Listen("unix", path)
+}
@@ -0,0 +1,11 @@
+//go:build windows
+
+package fastworktree
+
+import "net"
+
+// listenPrivate listens on a Unix socket at path. Windows has no umask or
+// socket file modes: who can connect follows the ACL of its directory.
+func listenPrivate(path string) (net.Listener, error) {
+	return net.Listen("unix", path)
+}
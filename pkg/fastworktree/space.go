@@ -0,0 +1,123 @@
+package fastworktree
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// cloneMetadataSize is roughly what a copy-on-write clone costs per file
+// before either copy is modified: an inode and its extent records, rounded
+// up to a block.
+const cloneMetadataSize = 4096
+
+// freeSpace is what is left on a volume. Inodes is -1 where the
+// filesystem has no fixed number of them.
+type freeSpace struct {
+	bytes  int64
+	inodes int64
+}
+
+// checkSpace estimates what cloning src to dst with cloner will take and
+// compares it with the free space on dst's volume. Running out of space or
+// inodes for the clone itself is an error unless --force is given; not
+// leaving --headroom for the new worktree to diverge is a warning.
+func checkSpace(src, dst string, cloner Cloner, log logger) error {
+	headroomBytes, err := parseBytes(headroom)
+	if err != nil {
+		return err
+	}
+	free, err := volumeFree(existingAncestor(filepath.Dir(dst)))
+	if err != nil {
+		return nil
+	}
+	files := indexEntries(src)
+	var need int64
+	switch cloner.Name() {
+	case "copy":
+		need = files*cloneMetadataSize + trackedSize(src)
+	case "hardlink":
+		need = 0
+	default:
+		need = files * cloneMetadataSize
+	}
+
+	var short string
+	switch {
+	case need > free.bytes:
+		short = fmt.Sprintf("about %s is needed for %d files, %s is free", formatBytes(need), files, formatBytes(free.bytes))
+	case free.inodes >= 0 && cloner.Name() != "hardlink" && files > free.inodes:
+		short = fmt.Sprintf("%d inodes are needed, %d are free", files, free.inodes)
+	}
+	if short != "" {
+		if addForce == 0 {
+			return fmt.Errorf("fatal: not enough space for '%s': %s\nuse --force to create it anyway", dst, short)
+		}
+		log.warnf("not enough space for '%s': %s", dst, short)
+		return nil
+	}
+	if need+headroomBytes > free.bytes {
+		log.warnf("only %s will be free after creating '%s', less than the %s --headroom for changes in it", formatBytes(free.bytes-need), dst, formatBytes(headroomBytes))
+	}
+	return nil
+}
+
+// indexEntries returns the number of entries in the index of the worktree
+// at src, read from the index header, or 0 if it cannot be read.
+func indexEntries(src string) int64 {
+	path, err := indexPath(src)
+	if err != nil {
+		return 0
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	// "DIRC", a 4-byte version and a 4-byte entry count.
+	var header [12]byte
+	if _, err := f.ReadAt(header[:], 0); err != nil || string(header[:4]) != "DIRC" {
+		return 0
+	}
+	return int64(binary.BigEndian.Uint32(header[8:]))
+}
+
+// trackedSize returns the total size of the files in HEAD, which is what
+// copying a worktree that has no copy-on-write support takes at least.
+func trackedSize(src string) int64 {
+	out, err := gitCommand("-C", src, "ls-tree", "-r", "-l", "-z", "HEAD").Output()
+	if err != nil {
+		return 0
+	}
+	var total int64
+	for _, entry := range strings.Split(string(out), "\x00") {
+		// <mode> SP <type> SP <object> SP+ <size> TAB <path>
+		meta, _, _ := strings.Cut(entry, "\t")
+		fields := strings.Fields(meta)
+		if len(fields) != 4 {
+			continue
+		}
+		if size, err := strconv.ParseInt(fields[3], 10, 64); err == nil {
+			total += size
+		}
+	}
+	return total
+}
+
+// parseBytes parses a size such as 512M or 2G, in binary units.
+func parseBytes(s string) (int64, error) {
+	num := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "B")
+	var shift uint
+	if i := strings.LastIndexAny(num, "KMGT"); i >= 0 && i == len(num)-1 {
+		shift = 10 * uint(strings.IndexByte("KMGT", num[i])+1)
+		num = num[:i]
+	}
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("fatal: invalid size '%s' (expected e.g. 512M or 2G)", s)
+	}
+	return int64(n * float64(int64(1)<<shift)), nil
+}
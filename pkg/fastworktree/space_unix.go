@@ -0,0 +1,21 @@
+//go:build darwin || linux || freebsd
+
+package fastworktree
+
+import "golang.org/x/sys/unix"
+
+// volumeFree returns the space and inodes available to this user on the
+// volume containing path.
+func volumeFree(path string) (freeSpace, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return freeSpace{}, err
+	}
+	free := freeSpace{bytes: int64(st.Bavail) * int64(st.Bsize), inodes: int64(st.Ffree)}
+	// Filesystems that allocate inodes dynamically (btrfs, ZFS) report
+	// none in total.
+	if st.Files == 0 {
+		free.inodes = -1
+	}
+	return free, nil
+}
@@ -0,0 +1,13 @@
+package fastworktree
+
+import "golang.org/x/sys/windows"
+
+// volumeFree returns the space available to this user on the volume
+// containing path. NTFS and ReFS have no fixed number of inodes.
+func volumeFree(path string) (freeSpace, error) {
+	var avail uint64
+	if err := windows.GetDiskFreeSpaceEx(windows.StringToUTF16Ptr(path), &avail, nil, nil); err != nil {
+		return freeSpace{}, err
+	}
+	return freeSpace{bytes: int64(avail), inodes: -1}, nil
+}
@@ -0,0 +1,153 @@
+package fastworktree
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// sparseSpec is the sparse-checkout a new worktree is set up with.
+type sparseSpec struct {
+	patterns []string
+	cone     bool
+}
+
+// sourceSparse returns the sparse-checkout of the worktree at src, or nil
+// if it does not use one.
+func sourceSparse(src string) (*sparseSpec, error) {
+	out, _ := gitCommand("-C", src, "config", "--bool", "core.sparseCheckout").Output()
+	if strings.TrimSpace(string(out)) != "true" {
+		return nil, nil
+	}
+	out, _ = gitCommand("-C", src, "config", "--bool", "core.sparseCheckoutCone").Output()
+	cone := strings.TrimSpace(string(out)) == "true"
+	out, err := gitCommand("-C", src, "sparse-checkout", "list").Output()
+	if err != nil {
+		return nil, fmt.Errorf("git sparse-checkout list: %w", err)
+	}
+	spec := &sparseSpec{cone: cone}
+	for _, line := range strings.Split(string(out), "\n") {
+		if line != "" {
+			spec.patterns = append(spec.patterns, line)
+		}
+	}
+	return spec, nil
+}
+
+// filter drops the top-level directories of src that lie outside the cone,
+// which can only hold untracked and ignored files. Non-cone patterns are
+// too general to tell, so everything is kept.
+func (s *sparseSpec) filter(src string, entries []string) []string {
+	if !s.cone {
+		return entries
+	}
+	inCone := make(map[string]bool)
+	for _, pattern := range s.patterns {
+		first, _, _ := strings.Cut(pattern, "/")
+		inCone[first] = true
+	}
+	var kept []string
+	for _, name := range entries {
+		if info, err := os.Lstat(filepath.Join(src, name)); err == nil && info.IsDir() && !inCone[name] {
+			continue
+		}
+		kept = append(kept, name)
+	}
+	return kept
+}
+
+// apply sets up the sparse-checkout in the worktree at dst once its index
+// has been reset, marking the entries outside it skip-worktree.
+func (s *sparseSpec) apply(dst string) error {
+	mode := "--no-cone"
+	if s.cone {
+		mode = "--cone"
+	}
+	cmd := gitCommand("-C", dst, "sparse-checkout", "set", mode, "--stdin")
+	cmd.Stdin = strings.NewReader(strings.Join(s.patterns, "\n") + "\n")
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("git sparse-checkout set: %w", err)
+	}
+	return nil
+}
+
+// parseSparsePaths turns --sparse directories into cone patterns.
+func parseSparsePaths(paths []string) (*sparseSpec, error) {
+	spec := &sparseSpec{cone: true}
+	for _, path := range paths {
+		path = strings.Trim(filepath.ToSlash(filepath.Clean(path)), "/")
+		if path == "" || path == "." || path == ".." || strings.HasPrefix(path, "../") {
+			return nil, fmt.Errorf("fatal: invalid --sparse directory '%s'", path)
+		}
+		spec.patterns = append(spec.patterns, path)
+	}
+	return spec, nil
+}
+
+// entries lists what to clone from src for a cone: the top-level files, the
+// files directly inside each parent of a cone directory, which cone mode
+// always includes, and the cone directories themselves. Entries are paths
+// relative to src; top is src's top-level entries.
+func (s *sparseSpec) entries(src string, top []string) []string {
+	var entries []string
+	for _, name := range top {
+		if info, err := os.Lstat(filepath.Join(src, name)); err == nil && !info.IsDir() {
+			entries = append(entries, name)
+		}
+	}
+	parents := make(map[string]bool)
+	for _, pattern := range s.patterns {
+		if s.covers(pattern) {
+			continue
+		}
+		parts := strings.Split(pattern, "/")
+		for i := 1; i < len(parts); i++ {
+			parent := strings.Join(parts[:i], "/")
+			if parents[parent] {
+				continue
+			}
+			parents[parent] = true
+			children, _ := os.ReadDir(filepath.Join(src, filepath.FromSlash(parent)))
+			for _, child := range children {
+				if !child.IsDir() {
+					entries = append(entries, parent+"/"+child.Name())
+				}
+			}
+		}
+		if _, err := os.Lstat(filepath.Join(src, filepath.FromSlash(pattern))); err == nil {
+			entries = append(entries, pattern)
+		}
+	}
+	return entries
+}
+
+// covers reports whether another cone directory contains dir.
+func (s *sparseSpec) covers(dir string) bool {
+	for _, other := range s.patterns {
+		if other != dir && strings.HasPrefix(dir, other+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// checkoutMissing checks out the cone directories that src does not have,
+// for example because src has its own, different, sparse-checkout, and so
+// were not cloned.
+func (s *sparseSpec) checkoutMissing(src, dst string) error {
+	if !s.cone {
+		return nil
+	}
+	var missing []string
+	for _, pattern := range s.patterns {
+		if _, err := os.Lstat(filepath.Join(src, filepath.FromSlash(pattern))); err != nil {
+			missing = append(missing, pattern)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return checkoutPaths(dst, missing)
+}
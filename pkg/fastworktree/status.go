@@ -0,0 +1,184 @@
+package fastworktree
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	statusJSON bool
+	statusAll  bool
+)
+
+// worktreeStatus is one worktree's line in status.
+type worktreeStatus struct {
+	Path       string     `json:"path"`
+	Branch     string     `json:"branch,omitempty"`
+	Staged     int        `json:"staged"`
+	Modified   int        `json:"modified"`
+	Untracked  int        `json:"untracked"`
+	Conflicted int        `json:"conflicted"`
+	Ahead      *int       `json:"ahead,omitempty"`
+	Behind     *int       `json:"behind,omitempty"`
+	LastCommit *time.Time `json:"lastCommit,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+var statusCmd = &cobra.Command{
+	Use:   "status [flags]",
+	Short: "Summarize the changes and upstream of every worktree",
+	Long: "Runs git status in every worktree created by this tool at once, and prints a\n" +
+		"line for each with its uncommitted changes, how far it is ahead of or behind its\n" +
+		"upstream, and how long ago its last commit was. --all includes the other\n" +
+		"worktrees.",
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		entries, err := listWorktrees(".")
+		if err != nil {
+			return fmt.Errorf("fatal: %w", err)
+		}
+		var selected []worktreeEntry
+		for _, e := range entries {
+			if e.Bare || e.Prunable != "" || isPooled(e.Path) {
+				continue
+			}
+			if !statusAll {
+				gitdir, err := worktreeGitdir(e.Path)
+				if err != nil {
+					continue
+				}
+				if _, ok := readMetadata(gitdir); !ok {
+					continue
+				}
+			}
+			selected = append(selected, e)
+		}
+
+		statuses := make([]worktreeStatus, len(selected))
+		var wg sync.WaitGroup
+		for i, e := range selected {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				statuses[i] = readStatus(e)
+			}()
+		}
+		wg.Wait()
+
+		if statusJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(statuses)
+		}
+		now := time.Now()
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "PATH\tBRANCH\tCHANGES\tUPSTREAM\tLAST COMMIT")
+		for _, s := range statuses {
+			upstream := "-"
+			if s.Ahead != nil {
+				upstream = "up to date"
+				if *s.Ahead != 0 || *s.Behind != 0 {
+					upstream = fmt.Sprintf("+%d/-%d", *s.Ahead, *s.Behind)
+				}
+			}
+			lastCommit := "-"
+			if s.LastCommit != nil {
+				lastCommit = formatAge(now.Sub(*s.LastCommit)) + " ago"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", s.Path, cmp.Or(s.Branch, "(detached)"), s.changes(), upstream, lastCommit)
+		}
+		return w.Flush()
+	},
+}
+
+// readStatus reads e's status with git status --porcelain=v2, which also
+// counts the commits it is ahead of and behind its upstream.
+func readStatus(e worktreeEntry) worktreeStatus {
+	s := worktreeStatus{Path: e.Path, Branch: e.Branch}
+	out, err := gitCommand("-C", e.Path, "status", "--porcelain=v2", "--branch").Output()
+	if err != nil {
+		s.Error = "git status failed"
+		return s
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		switch fields[0] {
+		case "#":
+			if fields[1] == "branch.ab" && len(fields) == 4 {
+				ahead, _ := strconv.Atoi(strings.TrimPrefix(fields[2], "+"))
+				behind, _ := strconv.Atoi(strings.TrimPrefix(fields[3], "-"))
+				s.Ahead, s.Behind = &ahead, &behind
+			}
+		case "1", "2":
+			if fields[1][0] != '.' {
+				s.Staged++
+			}
+			if fields[1][1] != '.' {
+				s.Modified++
+			}
+		case "u":
+			s.Conflicted++
+		case "?":
+			s.Untracked++
+		}
+	}
+	if out, err := gitCommand("-C", e.Path, "log", "-1", "--format=%ct").Output(); err == nil {
+		if sec, err := strconv.ParseInt(strings.TrimSpace(string(out)), 10, 64); err == nil {
+			t := time.Unix(sec, 0)
+			s.LastCommit = &t
+		}
+	}
+	return s
+}
+
+// changes summarizes s's uncommitted changes for the table.
+func (s worktreeStatus) changes() string {
+	if s.Error != "" {
+		return s.Error
+	}
+	var parts []string
+	for _, c := range []struct {
+		n    int
+		kind string
+	}{{s.Conflicted, "conflicted"}, {s.Staged, "staged"}, {s.Modified, "modified"}, {s.Untracked, "untracked"}} {
+		if c.n > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", c.n, c.kind))
+		}
+	}
+	if len(parts) == 0 {
+		return "clean"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// formatAge formats d in its largest whole unit, e.g. 3d.
+func formatAge(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	case d < 14*24*time.Hour:
+		return fmt.Sprintf("%dd", int(d.Hours()/24))
+	}
+	return fmt.Sprintf("%dw", int(d.Hours()/24/7))
+}
+
+func init() {
+	statusCmd.Flags().BoolVar(&statusJSON, "json", false, "output as JSON")
+	statusCmd.Flags().BoolVarP(&statusAll, "all", "a", false, "include worktrees not created by this tool")
+}
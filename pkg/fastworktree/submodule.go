@@ -0,0 +1,141 @@
+package fastworktree
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// gitlinks returns the paths of the submodules in the index of the worktree
+// at dir, with the commit recorded for each.
+func gitlinks(dir string) (map[string]string, error) {
+	out, err := gitCommand("-C", dir, "ls-files", "-s", "-z").Output()
+	if err != nil {
+		return nil, fmt.Errorf("git ls-files: %w", err)
+	}
+	links := make(map[string]string)
+	// Records are "<mode> <object> <stage>\t<path>\0".
+	for _, record := range strings.Split(string(out), "\x00") {
+		info, path, ok := strings.Cut(record, "\t")
+		if fields := strings.Fields(info); ok && len(fields) == 3 && fields[0] == "160000" {
+			links[path] = fields[1]
+		}
+	}
+	return links, nil
+}
+
+// emptySubmodules leaves each submodule of the worktree at dir as an empty
+// directory, which is how git worktree add leaves them. The cloned copies
+// would otherwise have .git files pointing at the wrong place.
+func emptySubmodules(dir string) error {
+	links, err := gitlinks(dir)
+	if err != nil {
+		return err
+	}
+	for path := range links {
+		path = filepath.Join(dir, filepath.FromSlash(path))
+		if err := os.RemoveAll(path); err != nil {
+			return err
+		}
+		if err := os.Mkdir(path, 0o777); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setupSubmodules wires up the cloned submodules of the worktree at dst,
+// recursively. A submodule checked out in src becomes a linked worktree of
+// the same submodule repository, reusing its cloned files; one that is not
+// falls back to git submodule update --init.
+func setupSubmodules(src, dst string, log logger) error {
+	links, err := gitlinks(dst)
+	if err != nil {
+		return err
+	}
+	for path, commit := range links {
+		start := time.Now()
+		srcSub := filepath.Join(src, filepath.FromSlash(path))
+		dstSub := filepath.Join(dst, filepath.FromSlash(path))
+		if _, err := os.Stat(filepath.Join(srcSub, ".git")); err != nil {
+			if err := runGit("-C", dst, "submodule", "update", "--init", "--recursive", "--", path); err != nil {
+				return fmt.Errorf("git submodule update %s: %w", path, err)
+			}
+			log.infof("submodule:    %s (update --init, %v)", path, time.Since(start).Round(time.Millisecond))
+			continue
+		}
+		if err := addSubmoduleWorktree(srcSub, dstSub, commit); err != nil {
+			return fmt.Errorf("submodule %s: %w", path, err)
+		}
+		if err := setupSubmodules(srcSub, dstSub, log); err != nil {
+			return err
+		}
+		log.infof("submodule:    %s (%v)", path, time.Since(start).Round(time.Millisecond))
+	}
+	return nil
+}
+
+// addSubmoduleWorktree registers dstSub, a clone of the submodule checked
+// out at srcSub, as a linked worktree of the submodule's repository at
+// commit. Like addWorktree, git creates the worktree in an empty directory
+// and its .git file is then moved into the clone.
+func addSubmoduleWorktree(srcSub, dstSub, commit string) error {
+	tmp, err := os.MkdirTemp(filepath.Dir(dstSub), "."+filepath.Base(dstSub)+".tmp-")
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(dstSub, tmp); err != nil {
+		return err
+	}
+	// The cloned .git file points at the source's submodule repository
+	// through a relative path that no longer resolves.
+	os.Remove(filepath.Join(tmp, ".git"))
+
+	if err := runGit("-C", srcSub, "worktree", "add", "--quiet", "--no-checkout", "--detach", dstSub, commit); err != nil {
+		os.Rename(tmp, dstSub)
+		return gitFailed("git worktree add")
+	}
+	if err := os.Rename(filepath.Join(dstSub, ".git"), filepath.Join(tmp, ".git")); err != nil {
+		return err
+	}
+	if err := os.Remove(dstSub); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, dstSub); err != nil {
+		return err
+	}
+
+	if err := runGit("-C", dstSub, "reset", "--quiet", "--no-refresh"); err != nil {
+		return fmt.Errorf("git reset: %w", err)
+	}
+	if _, err := checkoutDelta(srcSub, dstSub); err != nil {
+		return fmt.Errorf("checkout: %w", err)
+	}
+	return nil
+}
+
+// submoduleGitdirs returns the administrative directories of the submodule
+// worktrees that setupSubmodules created below the worktree at dir,
+// recursively, so they can be removed along with it.
+func submoduleGitdirs(dir string) []string {
+	links, err := gitlinks(dir)
+	if err != nil {
+		return nil
+	}
+	var gitdirs []string
+	for path := range links {
+		sub := filepath.Join(dir, filepath.FromSlash(path))
+		gitdir, err := worktreeGitdir(sub)
+		if err != nil || filepath.Base(filepath.Dir(gitdir)) != "worktrees" {
+			continue
+		}
+		gitdirs = append(gitdirs, submoduleGitdirs(sub)...)
+		gitdirs = append(gitdirs, gitdir)
+	}
+	return gitdirs
+}
@@ -0,0 +1,161 @@
+package fastworktree
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var shellFunction string
+
+var switchCmd = &cobra.Command{
+	Use:   "switch <worktree>",
+	Short: "Print the path of a worktree, for the shell function to cd into",
+	Long: "Prints the path of a worktree named by its branch, its directory name, its\n" +
+		"path or main. On its own a program cannot change the shell's directory; with\n" +
+		"the function from shell-init, switch cds into the worktree instead.",
+	Example: "  eval \"$(git-fast-worktree shell-init bash)\"\n" +
+		"  gfw switch feat/x",
+	Args: cobra.ExactArgs(1),
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) > 0 {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		entries, err := listWorktrees(".")
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		names := []string{"main"}
+		for _, e := range entries {
+			if e.Branch != "" {
+				names = append(names, e.Branch)
+			}
+		}
+		return names, cobra.ShellCompDirectiveNoFileComp
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path, err := findWorktree(args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Println(path)
+		return nil
+	},
+}
+
+// findWorktree returns the path of the worktree name refers to: main, a
+// branch checked out in it, its path, or the name of its directory if only
+// one worktree has it.
+func findWorktree(name string) (string, error) {
+	common, err := gitCommonDir()
+	if err != nil {
+		return "", notRepo(err)
+	}
+	entries, err := listWorktrees(common)
+	if err != nil {
+		return "", err
+	}
+	path := name
+	if abs, err := filepath.Abs(name); err == nil {
+		path = realPath(abs)
+	}
+	var byBase []string
+	for i, e := range entries {
+		if e.Bare {
+			continue
+		}
+		if (name == "main" && i == 0) || e.Branch == name || realPath(e.Path) == path {
+			return e.Path, nil
+		}
+		if filepath.Base(e.Path) == name {
+			byBase = append(byBase, e.Path)
+		}
+	}
+	switch len(byBase) {
+	case 0:
+		return "", fmt.Errorf("fatal: '%s' is not a worktree, a branch checked out in one or a worktree's directory name", name)
+	case 1:
+		return byBase[0], nil
+	}
+	return "", fmt.Errorf("fatal: '%s' names several worktrees: %s", name, strings.Join(byBase, ", "))
+}
+
+var shellInitCmd = &cobra.Command{
+	Use:   "shell-init <bash|zsh|fish>",
+	Short: "Print a shell function that cds into worktrees from switch and add",
+	Long: "Prints a shell function, gfw by default, that runs git-fast-worktree and, for\n" +
+		"switch and add, changes into the worktree whose path it prints. Output that\n" +
+		"is not a single directory, such as add's --json or a batch of worktrees, is\n" +
+		"printed as usual. It also sets up the function's completion if\n" +
+		"git-fast-worktree's is loaded.",
+	Example: "  # ~/.bashrc or ~/.zshrc\n" +
+		"  eval \"$(git-fast-worktree shell-init bash)\"\n" +
+		"  # ~/.config/fish/config.fish\n" +
+		"  git-fast-worktree shell-init fish | source",
+	Args:      cobra.ExactArgs(1),
+	ValidArgs: []string{"bash", "zsh", "fish"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var script string
+		switch args[0] {
+		case "bash":
+			script = posixInit + "if type __start_git-fast-worktree >/dev/null 2>&1; then\n" +
+				"  complete -o default -F __start_git-fast-worktree {{name}}\n" +
+				"fi\n"
+		case "zsh":
+			script = posixInit + "if (( $+functions[compdef] )); then\n" +
+				"  compdef {{name}}=git-fast-worktree\n" +
+				"fi\n"
+		case "fish":
+			script = fishInit
+		default:
+			return fmt.Errorf("fatal: unsupported shell '%s' (expected bash, zsh or fish)", args[0])
+		}
+		_, err := os.Stdout.WriteString(strings.ReplaceAll(script, "{{name}}", shellFunction))
+		return err
+	},
+}
+
+// posixInit is the function for bash and zsh.
+const posixInit = `{{name}}() {
+  case "$1" in
+    switch|add)
+      local out rc
+      out="$(command git-fast-worktree "$@")"
+      rc=$?
+      if [ "$rc" -eq 0 ] && [ -n "$out" ] && [ -d "$out" ]; then
+        cd -- "$out"
+      elif [ -n "$out" ]; then
+        printf '%s\n' "$out"
+      fi
+      return "$rc"
+      ;;
+    *)
+      command git-fast-worktree "$@"
+      ;;
+  esac
+}
+`
+
+const fishInit = `function {{name}} --wraps git-fast-worktree
+  switch "$argv[1]"
+    case switch add
+      set -l out (command git-fast-worktree $argv)
+      set -l rc $status
+      if test $rc -eq 0 -a (count $out) -eq 1; and test -d "$out[1]"
+        cd -- $out[1]
+      else if test (count $out) -gt 0
+        printf '%s\n' $out
+      end
+      return $rc
+    case '*'
+      command git-fast-worktree $argv
+  end
+end
+`
+
+func init() {
+	shellInitCmd.Flags().StringVar(&shellFunction, "name", "gfw", "name of the shell function")
+}
@@ -0,0 +1,129 @@
+package fastworktree
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	syncRebase  bool
+	syncNoFetch bool
+	syncAll     bool
+)
+
+var syncAllCmd = &cobra.Command{
+	Use:   "sync-all [flags]",
+	Short: "Fetch, then bring every worktree's branch up to date with its upstream",
+	Long: "Runs git fetch --all once, then fast-forwards the branch of every worktree\n" +
+		"created by this tool to its upstream at once, or with --rebase rebases it onto\n" +
+		"it. Worktrees with uncommitted changes, detached HEADs or no upstream are\n" +
+		"skipped, and a rebase that stops on a conflict is aborted. Exits non-zero if\n" +
+		"any branch could not be updated. --all includes the other worktrees.",
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if !syncNoFetch {
+			fetchArgs := []string{"fetch", "--all", "--prune"}
+			if quiet {
+				fetchArgs = append(fetchArgs, "--quiet")
+			}
+			if err := runGit(fetchArgs...); err != nil {
+				return withExitCode(exitGitFailed, fmt.Errorf("fatal: git fetch --all failed"))
+			}
+		}
+
+		entries, err := listWorktrees(".")
+		if err != nil {
+			return fmt.Errorf("fatal: %w", err)
+		}
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		var failed []string
+		for _, e := range entries {
+			if e.Bare || e.Prunable != "" || isPooled(e.Path) {
+				continue
+			}
+			if !syncAll {
+				gitdir, err := worktreeGitdir(e.Path)
+				if err != nil {
+					continue
+				}
+				if _, ok := readMetadata(gitdir); !ok {
+					continue
+				}
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := syncWorktree(e); err != nil {
+					console.warnf("%s: %v", e.Path, err)
+					mu.Lock()
+					failed = append(failed, e.Path)
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+		if len(failed) > 0 {
+			cmd.SilenceUsage = true
+			return fmt.Errorf("fatal: %d worktrees could not be updated", len(failed))
+		}
+		return nil
+	},
+}
+
+// syncWorktree fast-forwards or rebases the branch checked out in e onto
+// its upstream, unless it has nothing to update or changes to keep.
+func syncWorktree(e worktreeEntry) error {
+	if e.Branch == "" {
+		console.verbosef(1, "skipped: %s (detached HEAD)", e.Path)
+		return nil
+	}
+	if gitCommand("-C", e.Path, "rev-parse", "--verify", "-q", "@{upstream}").Run() != nil {
+		console.verbosef(1, "skipped: %s (%s has no upstream)", e.Path, e.Branch)
+		return nil
+	}
+	out, err := gitCommand("-C", e.Path, "status", "--porcelain", "--untracked-files=no").Output()
+	if err != nil {
+		return fmt.Errorf("git status failed")
+	}
+	if len(out) > 0 {
+		console.warnf("skipped: %s (uncommitted changes)", e.Path)
+		return nil
+	}
+	out, err = gitCommand("-C", e.Path, "rev-list", "--left-right", "--count", "HEAD...@{upstream}").Output()
+	if err != nil {
+		return fmt.Errorf("git rev-list failed")
+	}
+	var ahead, behind int
+	fmt.Sscan(string(out), &ahead, &behind)
+	if behind == 0 {
+		console.infof("up to date: %s (%s)", e.Path, e.Branch)
+		return nil
+	}
+
+	if syncRebase {
+		if out, err := gitCommand("-C", e.Path, "rebase", "--quiet", "@{upstream}").CombinedOutput(); err != nil {
+			gitCommand("-C", e.Path, "rebase", "--abort").Run()
+			return fmt.Errorf("rebasing %s onto its upstream failed, aborted: %s", e.Branch, strings.TrimSpace(string(out)))
+		}
+		console.infof("rebased: %s (%s, %d new commits)", e.Path, e.Branch, behind)
+		return nil
+	}
+	if ahead > 0 {
+		return fmt.Errorf("%s has diverged from its upstream (+%d/-%d), use --rebase", e.Branch, ahead, behind)
+	}
+	if out, err := gitCommand("-C", e.Path, "merge", "--ff-only", "--quiet", "@{upstream}").CombinedOutput(); err != nil {
+		return fmt.Errorf("fast-forwarding %s failed: %s", e.Branch, strings.TrimSpace(string(out)))
+	}
+	console.infof("updated: %s (%s, %d new commits)", e.Path, e.Branch, behind)
+	return nil
+}
+
+func init() {
+	syncAllCmd.Flags().BoolVar(&syncRebase, "rebase", false, "rebase branches that have diverged from their upstream instead of only fast-forwarding")
+	syncAllCmd.Flags().BoolVar(&syncNoFetch, "no-fetch", false, "do not run git fetch --all first")
+	syncAllCmd.Flags().BoolVarP(&syncAll, "all", "a", false, "include worktrees not created by this tool")
+}
@@ -0,0 +1,55 @@
+package fastworktree
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+var trustTools bool
+
+// toolFiles are the files direnv, mise and asdf set a directory's
+// environment and tool versions up from. --trust clones them even if they
+// are ignored or excluded, since they are often kept out of git.
+var toolFiles = []string{".envrc", ".tool-versions", "mise.toml", ".mise.toml", "mise.local.toml", ".mise.local.toml"}
+
+// toolTrusters are the commands that allow a directory's tool config, by
+// the file that needs them. direnv and mise refuse to load config from a
+// directory they have not been told to trust, and each worktree is a new
+// directory; asdf reads .tool-versions without asking.
+var toolTrusters = []struct{ marker, tool, command string }{
+	{".envrc", "direnv", "direnv allow ."},
+	{"mise.toml", "mise", "mise trust"},
+	{".mise.toml", "mise", "mise trust"},
+	{"mise.local.toml", "mise", "mise trust"},
+	{".mise.local.toml", "mise", "mise trust"},
+}
+
+// trustWorktree runs, with --trust, the commands that let direnv and mise
+// load the new worktree's config at dst, so its toolchain works without a
+// manual trust step. Tools that are not installed are skipped, and
+// failures are only warnings.
+func trustWorktree(dst string, log logger) {
+	if !trustTools {
+		return
+	}
+	ran := make(map[string]bool)
+	for _, truster := range toolTrusters {
+		if _, err := os.Stat(filepath.Join(dst, truster.marker)); err != nil || ran[truster.command] {
+			continue
+		}
+		ran[truster.command] = true
+		if _, err := exec.LookPath(truster.tool); err != nil {
+			log.verbosef(1, "trust: %s is not installed, skipping %s", truster.tool, truster.command)
+			continue
+		}
+		cmd := shellCommand([]string{truster.command})
+		cmd.Dir = dst
+		if out, err := cmd.CombinedOutput(); err != nil {
+			log.warnf("%s: %v: %s", truster.command, err, strings.TrimSpace(string(out)))
+			continue
+		}
+		log.infof("trust:        %s", truster.command)
+	}
+}
@@ -0,0 +1,118 @@
+package fastworktree
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// lastAdd records the worktrees the last add created, for undo.
+type lastAdd struct {
+	Started   time.Time `json:"started"`
+	Worktrees []string  `json:"worktrees"`
+}
+
+// lastAddPath returns where lastAdd is kept, in the main repository's
+// .git/fast-worktree.
+func lastAddPath() (string, error) {
+	common, err := gitCommonDir()
+	if err != nil {
+		return "", notRepo(err)
+	}
+	return filepath.Join(common, "fast-worktree", "last-add.json"), nil
+}
+
+// recordLastAdd records that an add started at started created the
+// worktrees at paths, warning rather than failing since they are complete.
+func recordLastAdd(started time.Time, paths []string) {
+	if len(paths) == 0 {
+		return
+	}
+	path, err := lastAddPath()
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(path), 0o755)
+	}
+	if err == nil {
+		data, _ := json.MarshalIndent(lastAdd{Started: started, Worktrees: paths}, "", "  ")
+		err = os.WriteFile(path, append(data, '\n'), 0o644)
+	}
+	if err != nil {
+		console.warnf("could not record this add for undo: %v", err)
+	}
+}
+
+var undoCmd = &cobra.Command{
+	Use:   "undo [flags]",
+	Short: "Remove the worktrees the last add created",
+	Long: "Removes the worktrees the last add in this repository created, and the branches\n" +
+		"it created for them with -b if nothing has been committed to them since. Like\n" +
+		"remove, it refuses worktrees with changes unless -f is given, and locked ones\n" +
+		"unless it is given twice. A worktree that has since been removed or replaced is\n" +
+		"skipped.",
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path, err := lastAddPath()
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			return fmt.Errorf("fatal: nothing to undo")
+		}
+		var last lastAdd
+		if err == nil {
+			err = json.Unmarshal(data, &last)
+		}
+		if err != nil {
+			return fmt.Errorf("fatal: reading %s: %w", path, err)
+		}
+		// What would be lost says more than the usage would.
+		cmd.SilenceUsage = true
+
+		for _, dst := range last.Worktrees {
+			gitdir, err := worktreeGitdir(dst)
+			meta, ok := readMetadata(gitdir)
+			if err != nil || !ok || meta.Created.Before(last.Started) {
+				console.warnf("skipping %s: it is no longer the worktree add created", dst)
+				continue
+			}
+			if err := runRemove(dst); err != nil {
+				return err
+			}
+			if meta.NewBranch && meta.Branch != "" {
+				undoBranch(meta.Branch, meta.Commit)
+			}
+		}
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("error removing %s: %w", path, err)
+		}
+		return nil
+	},
+}
+
+// undoBranch deletes the branch add created at commit, unless there have
+// been commits to it since.
+func undoBranch(branch, commit string) {
+	out, err := gitCommand("rev-parse", "--verify", "-q", "refs/heads/"+branch).Output()
+	if err != nil {
+		return
+	}
+	if tip := strings.TrimSpace(string(out)); tip != commit {
+		console.infof("kept branch %s: it has moved on from %.7s", branch, commit)
+		return
+	}
+	if out, err := gitCommand("branch", "-D", branch).CombinedOutput(); err != nil {
+		console.warnf("could not delete branch %s: %s", branch, strings.TrimSpace(string(out)))
+		return
+	}
+	console.infof("deleted branch: %s", branch)
+}
+
+func init() {
+	undoCmd.Flags().CountVarP(&removeForce, "force", "f", "remove a worktree with uncommitted changes, stashes or unpushed commits; give twice to remove a locked one")
+}
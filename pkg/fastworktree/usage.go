@@ -0,0 +1,55 @@
+package fastworktree
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+)
+
+// DiskUsage is the size of a tree. Logical is the sum of file sizes;
+// Private is the part of that not shared with any clone, i.e. the space
+// deleting the tree would actually free.
+type DiskUsage struct {
+	Logical int64 `json:"logical"`
+	Private int64 `json:"private"`
+}
+
+// measureUsage walks root and adds up the logical and private size of every
+// regular file in it.
+func measureUsage(root string) (DiskUsage, error) {
+	var u DiskUsage
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		private, err := privateSize(path)
+		if err != nil {
+			return err
+		}
+		u.Logical += info.Size()
+		u.Private += min(private, info.Size())
+		return nil
+	})
+	return u, err
+}
+
+// formatBytes formats n using binary units, e.g. 1.5G.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%c", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,81 @@
+//go:build linux
+
+package fastworktree
+
+import (
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// FIEMAP definitions from <linux/fiemap.h>.
+const (
+	fsIocFiemap        = 0xc020660b
+	fiemapFlagSync     = 0x1
+	fiemapExtentLast   = 0x1
+	fiemapExtentShared = 0x2000
+	fiemapBatch        = 64
+)
+
+type fiemap struct {
+	Start         uint64
+	Length        uint64
+	Flags         uint32
+	MappedExtents uint32
+	ExtentCount   uint32
+	Reserved      uint32
+}
+
+type fiemapExtent struct {
+	Logical    uint64
+	Physical   uint64
+	Length     uint64
+	Reserved64 [2]uint64
+	Flags      uint32
+	Reserved   [3]uint32
+}
+
+// privateSize returns the number of bytes of path stored in extents that
+// are not shared with any reflink, as reported by FIEMAP. Filesystems that
+// do not support FIEMAP are assumed not to share anything.
+func privateSize(path string) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var req struct {
+		fiemap
+		Extents [fiemapBatch]fiemapExtent
+	}
+	var private int64
+	for {
+		req.fiemap = fiemap{Start: req.Start, Length: ^uint64(0) - req.Start, Flags: fiemapFlagSync, ExtentCount: fiemapBatch}
+		if _, _, errno := unix.Syscall(unix.SYS_IOCTL, f.Fd(), fsIocFiemap, uintptr(unsafe.Pointer(&req))); errno != 0 {
+			return allocatedSize(f)
+		}
+		if req.MappedExtents == 0 {
+			return private, nil
+		}
+		for _, e := range req.Extents[:req.MappedExtents] {
+			if e.Flags&fiemapExtentShared == 0 {
+				private += int64(e.Length)
+			}
+			if e.Flags&fiemapExtentLast != 0 {
+				return private, nil
+			}
+			req.Start = e.Logical + e.Length
+		}
+	}
+}
+
+// allocatedSize returns the space allocated to f.
+func allocatedSize(f *os.File) (int64, error) {
+	var st unix.Stat_t
+	if err := unix.Fstat(int(f.Fd()), &st); err != nil {
+		return 0, err
+	}
+	return st.Blocks * 512, nil
+}
@@ -0,0 +1,15 @@
+//go:build !darwin && !linux
+
+package fastworktree
+
+import "os"
+
+// privateSize cannot tell shared from private blocks on this platform, so
+// files are reported as entirely private.
+func privateSize(path string) (int64, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
@@ -0,0 +1,217 @@
+package fastworktree
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify <path>",
+	Short: "Check that a worktree's files match its index and HEAD",
+	Long: "Hashes every tracked file in the worktree in parallel and compares it with\n" +
+		"the index, and the index with HEAD, reporting anything that differs: files\n" +
+		"changed on disk, missing or of the wrong type, and staged changes. Exits\n" +
+		"non-zero if anything differs.",
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path, err := filepath.Abs(args[0])
+		if err != nil {
+			return fmt.Errorf("error resolving path: %w", err)
+		}
+		if _, err := worktreeGitdir(path); err != nil {
+			return fmt.Errorf("fatal: %w", err)
+		}
+
+		start := time.Now()
+		diffs, files, err := verifyWorktree(path)
+		if err != nil {
+			return err
+		}
+		for _, d := range diffs {
+			console.printf("%-11s%s", d.kind+":", d.path)
+		}
+		if len(diffs) > 0 {
+			cmd.SilenceUsage = true
+			return fmt.Errorf("fatal: %d paths in '%s' differ from the index or HEAD", len(diffs), path)
+		}
+		console.infof("verified: %s (%d files, %v)", path, files, time.Since(start).Round(time.Millisecond))
+		return nil
+	},
+}
+
+// pathDiff is a path whose contents are not what the index or HEAD says.
+type pathDiff struct {
+	kind string
+	path string
+}
+
+// indexEntry is a file in the index, as listed by git ls-files -s.
+type indexEntry struct {
+	mode   string
+	object string
+	path   string
+}
+
+// verifyWorktree compares the worktree at dir with its index and the index
+// with HEAD, returning the differences and the number of files checked.
+func verifyWorktree(dir string) ([]pathDiff, int, error) {
+	out, err := gitCommand("-C", dir, "ls-files", "-t", "-s", "-z").Output()
+	if err != nil {
+		return nil, 0, fmt.Errorf("git ls-files: %w", err)
+	}
+	var entries []indexEntry
+	var diffs []pathDiff
+	for _, line := range strings.Split(strings.TrimSuffix(string(out), "\x00"), "\x00") {
+		// <tag> SP <mode> SP <object> SP <stage> TAB <path>
+		meta, path, ok := strings.Cut(line, "\t")
+		fields := strings.Fields(meta)
+		if !ok || len(fields) != 4 {
+			continue
+		}
+		tag, mode, object, stage := fields[0], fields[1], fields[2], fields[3]
+		switch {
+		case stage != "0":
+			// Conflicts list each path once per stage.
+			if len(diffs) == 0 || diffs[len(diffs)-1].path != path {
+				diffs = append(diffs, pathDiff{"unmerged", path})
+			}
+		case tag == "S" || mode == "160000":
+			// Outside the sparse-checkout, or a submodule.
+		default:
+			entries = append(entries, indexEntry{mode, object, path})
+		}
+	}
+
+	format := "sha1"
+	if out, err := gitCommand("-C", dir, "rev-parse", "--show-object-format").Output(); err == nil {
+		format = strings.TrimSpace(string(out))
+	}
+	out, _ = gitCommand("-C", dir, "config", "--bool", "core.fileMode").Output()
+	fileMode := runtime.GOOS != "windows" && strings.TrimSpace(string(out)) != "false"
+
+	changed := make([]string, len(entries))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range runtime.NumCPU() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				changed[i] = checkEntry(dir, entries[i], format, fileMode)
+			}
+		}()
+	}
+	for i := range entries {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	// A file whose bytes differ may still be unchanged once git's clean
+	// filters and eol conversion are applied, as git status would see it.
+	var recheck []int
+	for i, kind := range changed {
+		if kind == "modified" {
+			recheck = append(recheck, i)
+		}
+	}
+	if len(recheck) > 0 {
+		paths := make([]string, len(recheck))
+		for j, i := range recheck {
+			paths[j] = entries[i].path
+		}
+		cmd := gitCommand("-C", dir, "hash-object", "--stdin-paths")
+		cmd.Stdin = strings.NewReader(strings.Join(paths, "\n") + "\n")
+		out, err := cmd.Output()
+		if err != nil {
+			return nil, 0, fmt.Errorf("git hash-object: %w", err)
+		}
+		for j, object := range strings.Fields(string(out)) {
+			if j < len(recheck) && object == entries[recheck[j]].object {
+				changed[recheck[j]] = ""
+			}
+		}
+	}
+	for i, kind := range changed {
+		if kind != "" {
+			diffs = append(diffs, pathDiff{kind, entries[i].path})
+		}
+	}
+
+	// Staged changes, such as ones carried over from the source.
+	out, err = gitCommand("-C", dir, "diff-index", "--cached", "--name-only", "-z", "HEAD").Output()
+	if err == nil {
+		for _, path := range strings.Split(strings.TrimSuffix(string(out), "\x00"), "\x00") {
+			if path != "" {
+				diffs = append(diffs, pathDiff{"staged", path})
+			}
+		}
+	}
+	return diffs, len(entries), nil
+}
+
+// checkEntry compares the file for e in dir with its index entry, returning
+// how it differs or "" if it does not.
+func checkEntry(dir string, e indexEntry, format string, fileMode bool) string {
+	path := filepath.Join(dir, filepath.FromSlash(e.path))
+	info, err := os.Lstat(path)
+	if err != nil {
+		return "deleted"
+	}
+	var object string
+	switch {
+	case e.mode == "120000":
+		if info.Mode()&fs.ModeSymlink == 0 {
+			return "typechange"
+		}
+		target, err := os.Readlink(path)
+		if err != nil {
+			return "unreadable"
+		}
+		object = hashBlob(format, strings.NewReader(filepath.ToSlash(target)), int64(len(target)))
+	case !info.Mode().IsRegular():
+		return "typechange"
+	default:
+		if fileMode && (e.mode == "100755") != (info.Mode().Perm()&0o111 != 0) {
+			return "mode"
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return "unreadable"
+		}
+		defer f.Close()
+		object = hashBlob(format, bufio.NewReader(f), info.Size())
+	}
+	if object != e.object {
+		return "modified"
+	}
+	return ""
+}
+
+// hashBlob returns the git blob object name of the size bytes read from r,
+// in the repository's object format.
+func hashBlob(format string, r io.Reader, size int64) string {
+	var h hash.Hash
+	if format == "sha256" {
+		h = sha256.New()
+	} else {
+		h = sha1.New()
+	}
+	fmt.Fprintf(h, "blob %d\x00", size)
+	io.Copy(h, r)
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,37 @@
+package fastworktree
+
+import "fmt"
+
+// volumeInfo describes the filesystem that holds a path.
+type volumeInfo struct {
+	fsType  string
+	network bool
+}
+
+// legacyFilesystems are local filesystems that cannot share blocks between
+// files at all, mapped to the name users know them by.
+var legacyFilesystems = map[string]string{
+	"hfs":   "HFS+",
+	"exfat": "exFAT",
+	"msdos": "FAT",
+	"vfat":  "FAT",
+	"FAT":   "FAT",
+	"FAT32": "FAT",
+	"exFAT": "exFAT",
+}
+
+// checkVolume returns an error explaining why path is on a volume that no
+// copy-on-write backend can ever use, or nil if it might be.
+func checkVolume(path string) error {
+	v, err := describeVolume(path)
+	if err != nil {
+		return nil
+	}
+	if v.network {
+		return fmt.Errorf("%s is on a network volume (%s); copy-on-write clones cannot be made over the network", path, v.fsType)
+	}
+	if name, ok := legacyFilesystems[v.fsType]; ok {
+		return fmt.Errorf("%s is on %s, which does not support copy-on-write clones", path, name)
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+//go:build darwin || freebsd
+
+package fastworktree
+
+import "golang.org/x/sys/unix"
+
+func describeVolume(path string) (volumeInfo, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return volumeInfo{}, err
+	}
+	return volumeInfo{
+		fsType:  unix.ByteSliceToString(st.Fstypename[:]),
+		network: st.Flags&unix.MNT_LOCAL == 0,
+	}, nil
+}
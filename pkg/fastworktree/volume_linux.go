@@ -0,0 +1,72 @@
+//go:build linux
+
+package fastworktree
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// networkFilesystems are the mountinfo filesystem types of network and
+// remote FUSE mounts.
+var networkFilesystems = map[string]bool{
+	"nfs":        true,
+	"nfs4":       true,
+	"cifs":       true,
+	"smb3":       true,
+	"smbfs":      true,
+	"9p":         true,
+	"afs":        true,
+	"ceph":       true,
+	"glusterfs":  true,
+	"fuse.sshfs": true,
+}
+
+func describeVolume(path string) (volumeInfo, error) {
+	fsType, _, err := mountEntry(path)
+	if err != nil {
+		return volumeInfo{}, err
+	}
+	return volumeInfo{fsType: fsType, network: networkFilesystems[fsType]}, nil
+}
+
+// mountEntry returns the filesystem type and mount source of the mount that
+// holds path, found by matching the device of path against
+// /proc/self/mountinfo.
+func mountEntry(path string) (fsType, source string, err error) {
+	var stat unix.Stat_t
+	if err := unix.Stat(path, &stat); err != nil {
+		return "", "", err
+	}
+	dev := fmt.Sprintf("%d:%d", unix.Major(stat.Dev), unix.Minor(stat.Dev))
+
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return "", "", err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// 36 35 0:44 / /tank/src rw,relatime shared:1 - zfs tank/src rw,xattr
+		mount, super, ok := strings.Cut(scanner.Text(), " - ")
+		if !ok {
+			continue
+		}
+		fields, superFields := strings.Fields(mount), strings.Fields(super)
+		if len(fields) < 3 || len(superFields) < 2 {
+			continue
+		}
+		if fields[2] == dev {
+			return superFields[0], superFields[1], nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", "", err
+	}
+	return "", "", fmt.Errorf("%s: no entry in /proc/self/mountinfo", path)
+}
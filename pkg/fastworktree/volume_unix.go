@@ -0,0 +1,18 @@
+//go:build darwin || linux || freebsd
+
+package fastworktree
+
+import "golang.org/x/sys/unix"
+
+// sameVolume reports whether a and b are on the same filesystem, by
+// comparing their statfs f_fsid.
+func sameVolume(a, b string) (bool, error) {
+	var sa, sb unix.Statfs_t
+	if err := unix.Statfs(a, &sa); err != nil {
+		return false, err
+	}
+	if err := unix.Statfs(b, &sb); err != nil {
+		return false, err
+	}
+	return sa.Fsid == sb.Fsid, nil
+}
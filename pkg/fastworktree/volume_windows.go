@@ -0,0 +1,56 @@
+//go:build windows
+
+package fastworktree
+
+import "golang.org/x/sys/windows"
+
+// sameVolume reports whether a and b are on the same volume, by comparing
+// the serial numbers of the volumes that contain them.
+func sameVolume(a, b string) (bool, error) {
+	sa, err := volumeSerial(a)
+	if err != nil {
+		return false, err
+	}
+	sb, err := volumeSerial(b)
+	if err != nil {
+		return false, err
+	}
+	return sa == sb, nil
+}
+
+func volumeSerial(path string) (uint32, error) {
+	root, err := volumeRoot(path)
+	if err != nil {
+		return 0, err
+	}
+	var serial uint32
+	if err := windows.GetVolumeInformation(root, nil, 0, &serial, nil, nil, nil, 0); err != nil {
+		return 0, err
+	}
+	return serial, nil
+}
+
+func describeVolume(path string) (volumeInfo, error) {
+	root, err := volumeRoot(path)
+	if err != nil {
+		return volumeInfo{}, err
+	}
+	name := make([]uint16, windows.MAX_PATH+1)
+	if err := windows.GetVolumeInformation(root, nil, 0, nil, nil, nil, &name[0], uint32(len(name))); err != nil {
+		return volumeInfo{}, err
+	}
+	return volumeInfo{
+		fsType:  windows.UTF16ToString(name),
+		network: windows.GetDriveType(root) == windows.DRIVE_REMOTE,
+	}, nil
+}
+
+// volumeRoot returns the root of the volume containing path, e.g. C:\ or the
+// directory a volume is mounted on.
+func volumeRoot(path string) (*uint16, error) {
+	buf := make([]uint16, windows.MAX_PATH+1)
+	if err := windows.GetVolumePathName(windows.StringToUTF16Ptr(path), &buf[0], uint32(len(buf))); err != nil {
+		return nil, err
+	}
+	return &buf[0], nil
+}
@@ -0,0 +1,91 @@
+package fastworktree
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// cloneTree recreates the tree rooted at src at dst for backends that can
+// only clone individual files. Directories and symlinks are recreated as-is
+// and every regular file is handed to cloneFile. Other file types (sockets,
+// fifos, devices) are skipped since they are never part of a checkout.
+func cloneTree(src, dst string, cloneFile func(src, dst string) error) error {
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case info.Mode()&fs.ModeSymlink != 0:
+		target, err := os.Readlink(src)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(target, dst)
+
+	case info.IsDir():
+		// Create the directory writable so read-only directories can still
+		// be populated, then restore the real mode once it is filled in.
+		if err := os.Mkdir(dst, 0o700); err != nil {
+			return err
+		}
+		entries, err := os.ReadDir(src)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if err := cloneTree(filepath.Join(src, e.Name()), filepath.Join(dst, e.Name()), cloneFile); err != nil {
+				return err
+			}
+		}
+		if err := os.Chmod(dst, info.Mode().Perm()); err != nil {
+			return err
+		}
+		return os.Chtimes(dst, info.ModTime(), info.ModTime())
+
+	case info.Mode().IsRegular():
+		if err := cloneFile(src, dst); err != nil {
+			return err
+		}
+		return os.Chtimes(dst, info.ModTime(), info.ModTime())
+	}
+	return nil
+}
+
+// openPair opens src for reading and creates dst with the same permissions,
+// returning the source's FileInfo for backends that need its size.
+func openPair(src, dst string, flag int) (in, out *os.File, info fs.FileInfo, err error) {
+	in, err = os.Open(src)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	info, err = in.Stat()
+	if err != nil {
+		in.Close()
+		return nil, nil, nil, err
+	}
+	out, err = os.OpenFile(dst, flag|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		in.Close()
+		return nil, nil, nil, err
+	}
+	return in, out, info, nil
+}
+
+// copyFile copies the contents of a regular file for filesystems (or volumes)
+// that cannot share blocks at all.
+func copyFile(src, dst string) error {
+	in, out, _, err := openPair(src, dst, os.O_WRONLY)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,29 @@
+package fastworktree
+
+import (
+	"fmt"
+	"os"
+)
+
+// warmWorktree enables the untracked cache in the new worktree at dst and
+// starts a git status in the background. Its index refresh records the stat
+// information of every file and fills the untracked cache, so editors and
+// shell prompts that run git status get an answer straight away.
+func warmWorktree(dst string, log logger) error {
+	if out, err := gitCommand("-C", dst, "update-index", "--untracked-cache").CombinedOutput(); err != nil {
+		return fmt.Errorf("git update-index --untracked-cache: %v: %s", err, out)
+	}
+	devNull, err := os.Open(os.DevNull)
+	if err != nil {
+		return err
+	}
+	defer devNull.Close()
+	cmd := gitCommand("-C", dst, "status", "--porcelain")
+	cmd.Stdout, cmd.Stderr = devNull, devNull
+	detach(cmd.Cmd)
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("git status: %w", err)
+	}
+	log.infof("warm:         git status running in the background")
+	return cmd.Process.Release()
+}
@@ -0,0 +1,98 @@
+package fastworktree
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/spf13/cobra"
+)
+
+var withCmd = &cobra.Command{
+	Use:   "with [flags] <commit-ish> -- <command> [<args>...]",
+	Short: "Run a command in a temporary worktree, then remove it",
+	Long: "Creates a temporary worktree at <commit-ish>, runs the command inside it and\n" +
+		"removes the worktree afterwards, even if the command fails or is interrupted.\n" +
+		"The command's exit code is passed through.",
+	Example: "  git-fast-worktree with origin/main -- go test ./...",
+	Args:    cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if cmd.ArgsLenAtDash() != 1 {
+			return fmt.Errorf("expected <commit-ish> -- <command>")
+		}
+		commitish, command := args[0], args[1:]
+
+		src, err := sourceWorktree(fromWorktree)
+		if err != nil {
+			return err
+		}
+		toClone, sparse, err := sourceClone(src)
+		if err != nil {
+			return err
+		}
+
+		// Create the worktree next to the repository so it is on the same
+		// volume. MkdirTemp only reserves a unique name; add needs the
+		// destination not to exist.
+		tmp, err := os.MkdirTemp(filepath.Dir(src), "."+filepath.Base(src)+"-with-")
+		if err != nil {
+			return fmt.Errorf("error creating temporary worktree path: %w", err)
+		}
+		os.Remove(tmp)
+
+		defer func() {
+			gitdir, err := worktreeGitdir(tmp)
+			if err != nil {
+				os.RemoveAll(tmp)
+				return
+			}
+			if err := removeWorktree(tmp, gitdir); err != nil {
+				console.warnf("could not remove temporary worktree %s: %v", tmp, err)
+			}
+		}()
+
+		// An interrupted clone is rolled back like add's.
+		stop := handleInterrupts()
+		err = addWorktree(src, worktreeSpec{dst: tmp, commitish: commitish, sparse: sparse, partial: partialClone(src)}, toClone, console)
+		stop()
+		if err != nil {
+			return err
+		}
+
+		// The command runs in the foreground process group, so Ctrl-C
+		// reaches it directly. This process only needs to survive long
+		// enough to clean up.
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		defer signal.Stop(signals)
+
+		run := exec.Command(command[0], command[1:]...)
+		run.Dir = tmp
+		run.Stdin, run.Stdout, run.Stderr = os.Stdin, os.Stdout, os.Stderr
+		err = run.Run()
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			cmd.SilenceErrors, cmd.SilenceUsage = true, true
+			return &exitCodeError{code: exitErr.ExitCode()}
+		}
+		return err
+	},
+}
+
+// exitCodeError makes the process exit with code without printing anything,
+// for commands that pass through the exit status of a child.
+type exitCodeError struct {
+	code int
+}
+
+func (e *exitCodeError) Error() string {
+	return fmt.Sprintf("exit status %d", e.code)
+}
+
+func init() {
+	withCmd.Flags().StringVar(&fromWorktree, "from", "", "clone the files of another worktree: main, a worktree path, or a branch checked out in one (default: the current worktree)")
+}
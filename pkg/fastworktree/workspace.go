@@ -0,0 +1,55 @@
+package fastworktree
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	editorSettings bool
+	codeWorkspace  bool
+)
+
+// editorDirs are the editor settings directories --editor-settings makes
+// sure a new worktree has. They are usually ignored by git, so they are
+// left out by --include-only, --exclude or an ignore file like anything
+// else that is not tracked.
+var editorDirs = []string{".vscode", ".idea", ".fleet", ".zed"}
+
+// writeCodeWorkspace writes a VS Code workspace file for the worktree at
+// dst next to it, <dst>.code-workspace, whose window title names the
+// worktree's branch, so windows on several worktrees can be told apart.
+// Settings of a workspace file next to the source worktree are kept. It
+// returns the file's path.
+func writeCodeWorkspace(src, dst string) (string, error) {
+	workspace := map[string]any{}
+	if data, err := os.ReadFile(src + ".code-workspace"); err == nil {
+		// Best effort: VS Code allows comments, which this cannot read.
+		json.Unmarshal(data, &workspace)
+	}
+	settings, _ := workspace["settings"].(map[string]any)
+	if settings == nil {
+		settings = map[string]any{}
+	}
+	out, _ := gitCommand("-C", dst, "branch", "--show-current").Output()
+	name := strings.TrimSpace(string(out))
+	if name == "" {
+		name = filepath.Base(dst)
+	}
+	settings["window.title"] = name + " — ${activeEditorShort}${separator}${rootName}"
+	workspace["settings"] = settings
+	workspace["folders"] = []map[string]string{{"path": filepath.Base(dst)}}
+
+	data, err := json.MarshalIndent(workspace, "", "\t")
+	if err != nil {
+		return "", err
+	}
+	path := dst + ".code-workspace"
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return "", fmt.Errorf("writing %s: %w", path, err)
+	}
+	return path, nil
+}
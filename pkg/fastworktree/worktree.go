@@ -0,0 +1,143 @@
+package fastworktree
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// worktreeGitdir returns the administrative directory of the linked worktree
+// at path (.git/worktrees/<name> in the main repository), as recorded in its
+// .git file.
+func worktreeGitdir(path string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(path, ".git"))
+	if err != nil {
+		if info, serr := os.Stat(filepath.Join(path, ".git")); serr == nil && info.IsDir() {
+			return "", fmt.Errorf("'%s' is a main working tree", path)
+		}
+		return "", fmt.Errorf("'%s' is not a working tree", path)
+	}
+	gitdir, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "gitdir: ")
+	if !ok {
+		return "", fmt.Errorf("'%s' has an invalid .git file", path)
+	}
+	if !filepath.IsAbs(gitdir) {
+		gitdir = filepath.Join(path, gitdir)
+	}
+	return filepath.Clean(gitdir), nil
+}
+
+// worktreeEntry is one worktree as reported by git worktree list.
+type worktreeEntry struct {
+	Path       string
+	Head       string
+	Branch     string // short branch name, empty when detached
+	Bare       bool
+	Locked     bool
+	LockReason string
+	Prunable   string
+}
+
+// listWorktrees returns every worktree of the repository containing dir,
+// main worktree first.
+func listWorktrees(dir string) ([]worktreeEntry, error) {
+	out, err := gitCommand("-C", dir, "worktree", "list", "--porcelain").Output()
+	if err != nil {
+		return nil, fmt.Errorf("git worktree list: %w", err)
+	}
+
+	var entries []worktreeEntry
+	var cur *worktreeEntry
+	for _, line := range strings.Split(string(out), "\n") {
+		key, value, _ := strings.Cut(line, " ")
+		switch key {
+		case "worktree":
+			entries = append(entries, worktreeEntry{Path: filepath.FromSlash(value)})
+			cur = &entries[len(entries)-1]
+		case "HEAD":
+			cur.Head = value
+		case "branch":
+			cur.Branch = strings.TrimPrefix(value, "refs/heads/")
+		case "bare":
+			cur.Bare = true
+		case "locked":
+			cur.Locked = true
+			cur.LockReason = value
+		case "prunable":
+			cur.Prunable = value
+		}
+	}
+	return entries, nil
+}
+
+// realPath resolves symlinks in path, which need not exist yet, the way git
+// records worktree paths.
+func realPath(path string) string {
+	existing := existingAncestor(path)
+	resolved, err := filepath.EvalSymlinks(existing)
+	if err != nil {
+		return path
+	}
+	rest, err := filepath.Rel(existing, path)
+	if err != nil {
+		return path
+	}
+	return filepath.Join(resolved, rest)
+}
+
+// isWithin reports whether path is dir or below it.
+func isWithin(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// errNoSource is returned by sourceWorktree for a bare repository that has
+// no worktree yet to clone from.
+var errNoSource = errors.New("fatal: this bare repository has no worktree to clone from")
+
+// sourceWorktree returns the working tree to clone from. By default that is
+// the current one, or in a bare repository the first of its worktrees;
+// from selects the main working tree ("main"), the worktree at a path, or
+// the worktree that has a branch checked out.
+func sourceWorktree(from string) (string, error) {
+	if from == "" {
+		src, err := gitToplevel()
+		if err == nil {
+			return src, nil
+		}
+		out, _ := gitCommand("rev-parse", "--is-bare-repository").Output()
+		if strings.TrimSpace(string(out)) != "true" {
+			return "", notRepo(err)
+		}
+	}
+
+	common, err := gitCommonDir()
+	if err != nil {
+		return "", notRepo(err)
+	}
+	entries, err := listWorktrees(common)
+	if err != nil {
+		return "", err
+	}
+	path := from
+	if abs, err := filepath.Abs(from); err == nil {
+		path = realPath(abs)
+	}
+	for i, e := range entries {
+		if e.Bare || e.Prunable != "" {
+			continue
+		}
+		if from == "" || (from == "main" && i == 0) || e.Branch == from || realPath(e.Path) == path {
+			return e.Path, nil
+		}
+	}
+	if from == "" {
+		return "", errNoSource
+	}
+	if from == "main" && entries[0].Bare {
+		return "", fmt.Errorf("fatal: --from main: the main repository is bare, name one of its worktrees instead")
+	}
+	return "", fmt.Errorf("fatal: --from '%s' is not a worktree of this repository or a branch checked out in one", from)
+}
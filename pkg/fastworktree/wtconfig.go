@@ -0,0 +1,82 @@
+package fastworktree
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+var wtConfig []string
+
+// parseWtConfig splits the --wt-config key=value pairs.
+func parseWtConfig(pairs []string) ([][2]string, error) {
+	var parsed [][2]string
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || !strings.Contains(strings.Trim(key, "."), ".") {
+			return nil, fmt.Errorf("fatal: invalid --wt-config '%s' (expected <section>.<key>=<value>)", pair)
+		}
+		parsed = append(parsed, [2]string{key, value})
+	}
+	return parsed, nil
+}
+
+// applyWtConfig sets the --wt-config keys in the worktree at dst alone,
+// enabling extensions.worktreeConfig first if the repository does not have
+// it.
+func applyWtConfig(dst string, log logger) error {
+	pairs, err := parseWtConfig(wtConfig)
+	if err != nil || len(pairs) == 0 {
+		return err
+	}
+	if err := enableWorktreeConfig(dst, log); err != nil {
+		return err
+	}
+	var keys []string
+	for _, kv := range pairs {
+		keys = append(keys, kv[0])
+		if out, err := gitCommand("-C", dst, "config", "--worktree", kv[0], kv[1]).CombinedOutput(); err != nil {
+			return fmt.Errorf("fatal: git config --worktree %s: %s", kv[0], strings.TrimSpace(string(out)))
+		}
+	}
+	log.infof("wt-config:    %s", strings.Join(keys, ", "))
+	return nil
+}
+
+// enableWorktreeConfig turns on extensions.worktreeConfig for the
+// repository of dst. As git-worktree(1) asks, core.bare and core.worktree
+// move from the shared config to the main worktree's own first, since
+// every worktree would otherwise read them.
+func enableWorktreeConfig(dst string, log logger) error {
+	out, _ := gitCommand("-C", dst, "config", "--bool", "extensions.worktreeConfig").Output()
+	if strings.TrimSpace(string(out)) == "true" {
+		return nil
+	}
+	out, err := gitCommand("-C", dst, "rev-parse", "--path-format=absolute", "--git-common-dir").Output()
+	if err != nil {
+		return gitFailed("git rev-parse --git-common-dir")
+	}
+	common := strings.TrimSpace(string(out))
+	shared := filepath.Join(common, "config")
+	for _, key := range []string{"core.bare", "core.worktree"} {
+		out, err := gitCommand("config", "--file", shared, key).Output()
+		if err != nil {
+			continue // not set
+		}
+		value := strings.TrimSpace(string(out))
+		if key == "core.bare" && value != "true" {
+			continue // false is what every linked worktree should read
+		}
+		if err := gitCommand("config", "--file", filepath.Join(common, "config.worktree"), key, value).Run(); err != nil {
+			return fmt.Errorf("fatal: moving %s to config.worktree: %w", key, err)
+		}
+		if err := gitCommand("config", "--file", shared, "--unset", key).Run(); err != nil {
+			return fmt.Errorf("fatal: moving %s to config.worktree: %w", key, err)
+		}
+	}
+	if err := gitCommand("config", "--file", shared, "extensions.worktreeConfig", "true").Run(); err != nil {
+		return gitFailed("git config extensions.worktreeConfig")
+	}
+	log.infof("wt-config:    enabled extensions.worktreeConfig for the repository")
+	return nil
+}
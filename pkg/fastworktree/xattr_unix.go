@@ -0,0 +1,48 @@
+//go:build !windows
+
+package fastworktree
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+)
+
+// stripXattrs removes the extended attributes from everything under root,
+// returning how many were removed.
+func stripXattrs(root string) (int, error) {
+	var removed int
+	buf := make([]byte, 4096)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		n, err := unix.Llistxattr(path, buf)
+		if errors.Is(err, unix.ERANGE) {
+			if n, err = unix.Llistxattr(path, nil); err == nil {
+				buf = make([]byte, n)
+				n, err = unix.Llistxattr(path, buf)
+			}
+		}
+		if errors.Is(err, unix.ENOTSUP) || errors.Is(err, unix.EOPNOTSUPP) {
+			return nil
+		}
+		if err != nil {
+			return &fs.PathError{Op: "listxattr", Path: path, Err: err}
+		}
+		for _, name := range bytes.Split(bytes.TrimSuffix(buf[:n], []byte{0}), []byte{0}) {
+			if len(name) == 0 {
+				continue
+			}
+			if err := unix.Lremovexattr(path, string(name)); err != nil {
+				return &fs.PathError{Op: "removexattr", Path: path, Err: err}
+			}
+			removed++
+		}
+		return nil
+	})
+	return removed, err
+}
@@ -0,0 +1,9 @@
+package fastworktree
+
+import "errors"
+
+// stripXattrs is not supported on Windows, where files have alternate data
+// streams rather than extended attributes.
+func stripXattrs(root string) (int, error) {
+	return 0, errors.New("removing extended attributes is not supported on Windows")
+}
@@ -0,0 +1,66 @@
+//go:build linux || freebsd
+
+package fastworktree
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+var (
+	zfsPoolsMu sync.Mutex
+	zfsPools   = map[string]bool{}
+)
+
+// zfsCloner clones each regular file with copy_file_range, which OpenZFS
+// 2.2+ services with block cloning when the pool has the feature enabled.
+type zfsCloner struct{}
+
+func (zfsCloner) Name() string      { return "zfs" }
+func (zfsCloner) SupportsDir() bool { return false }
+
+func (zfsCloner) Probe(volume string) error {
+	dataset, ok := zfsDataset(volume)
+	if !ok {
+		return fmt.Errorf("%s is not on ZFS", volume)
+	}
+	pool, _, _ := strings.Cut(dataset, "/")
+	if !zfsBlockCloning(pool) {
+		return fmt.Errorf("ZFS pool %s does not have feature@block_cloning enabled", pool)
+	}
+	return nil
+}
+
+func (zfsCloner) Clone(src, dst string) error {
+	in, out, info, err := openPair(src, dst, os.O_WRONLY)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	if err := copyFileRange(out, in, info.Size()); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// zfsBlockCloning reports whether pool has the OpenZFS 2.2 block_cloning
+// feature enabled. Without it copy_file_range silently falls back to a full
+// copy.
+func zfsBlockCloning(pool string) bool {
+	zfsPoolsMu.Lock()
+	defer zfsPoolsMu.Unlock()
+	if ok, seen := zfsPools[pool]; seen {
+		return ok
+	}
+
+	out, err := exec.Command("zpool", "get", "-H", "-o", "value", "feature@block_cloning", pool).Output()
+	value := strings.TrimSpace(string(out))
+	ok := err == nil && (value == "enabled" || value == "active")
+	zfsPools[pool] = ok
+	return ok
+}
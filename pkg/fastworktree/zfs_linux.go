@@ -0,0 +1,12 @@
+//go:build linux
+
+package fastworktree
+
+// zfsDataset returns the ZFS dataset backing path.
+func zfsDataset(path string) (string, bool) {
+	fsType, source, err := mountEntry(path)
+	if err != nil || fsType != "zfs" {
+		return "", false
+	}
+	return source, true
+}